@@ -0,0 +1,642 @@
+package linesqueak
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Action is an editing command which keys are bound to. Its String method returns the readline command name.
+type Action int
+
+// Editing actions. Most of them are bound to keys by default.
+const (
+	// ActionNone does nothing. Keys which aren't bound to any action result in ActionNone.
+	ActionNone Action = iota
+
+	// ActionAcceptLine returns the user input from Line unless Validate rejects it. Enter is bound to it.
+	ActionAcceptLine
+
+	// ActionInterrupt is bound to Ctrl-C. See InterruptMode.
+	ActionInterrupt
+
+	// ActionInsert inserts the typed character. Printable characters are bound to it.
+	ActionInsert
+
+	// ActionInsertNewline inserts a newline. Alt-Enter is bound to it.
+	ActionInsertNewline
+
+	// ActionBackspace deletes the character before the cursor. Backspace and Ctrl-H are bound to it.
+	ActionBackspace
+
+	// ActionDelete deletes the character under the cursor. Delete is bound to it.
+	ActionDelete
+
+	// ActionDeleteOrEOF deletes the character under the cursor or returns io.EOF from Line if the user input is empty.
+	// Ctrl-D is bound to it.
+	ActionDeleteOrEOF
+
+	// ActionSwap swaps the character under the cursor with the previous one. Ctrl-T is bound to it.
+	ActionSwap
+
+	// ActionSuspend is bound to Ctrl-Z. See Editor.Suspend.
+	ActionSuspend
+
+	// ActionMoveLeft is bound to Left and Ctrl-B.
+	ActionMoveLeft
+
+	// ActionMoveRight is bound to Right and Ctrl-F.
+	ActionMoveRight
+
+	// ActionMoveUp moves the cursor to the previous line or goes back in History. Up and Ctrl-P are bound to it.
+	ActionMoveUp
+
+	// ActionMoveDown moves the cursor to the next line or goes forward in History. Down and Ctrl-N are bound to it.
+	ActionMoveDown
+
+	// ActionMoveHome is bound to Home and Ctrl-A.
+	ActionMoveHome
+
+	// ActionMoveEnd is bound to End and Ctrl-E.
+	ActionMoveEnd
+
+	// ActionMoveWordBackward is bound to Alt-b and Ctrl-Left.
+	ActionMoveWordBackward
+
+	// ActionMoveWordForward is bound to Alt-f and Ctrl-Right.
+	ActionMoveWordForward
+
+	// ActionMoveTokenBackward is bound to Alt-Ctrl-B.
+	ActionMoveTokenBackward
+
+	// ActionMoveTokenForward is bound to Alt-Ctrl-F.
+	ActionMoveTokenForward
+
+	// ActionKillLine deletes the whole user input. Ctrl-U is bound to it unless UniversalArgument is enabled.
+	ActionKillLine
+
+	// ActionKillLineForward deletes the text from the cursor to the end of the line. Ctrl-K is bound to it.
+	ActionKillLineForward
+
+	// ActionKillPrevWord deletes the whitespace-delimited word before the cursor. Ctrl-W is bound to it.
+	ActionKillPrevWord
+
+	// ActionKillWordBackward deletes the word before the cursor. Alt-Backspace is bound to it.
+	ActionKillWordBackward
+
+	// ActionKillWordForward deletes the word after the cursor. Alt-d is bound to it.
+	ActionKillWordForward
+
+	// ActionUpcaseWord is bound to Alt-u.
+	ActionUpcaseWord
+
+	// ActionDowncaseWord is bound to Alt-l.
+	ActionDowncaseWord
+
+	// ActionCapitalizeWord is bound to Alt-c.
+	ActionCapitalizeWord
+
+	// ActionClearScreen is bound to Ctrl-L.
+	ActionClearScreen
+
+	// ActionUndo is bound to Ctrl-_ and Ctrl-X Ctrl-U.
+	ActionUndo
+
+	// ActionRedo is bound to Ctrl-X Ctrl-R.
+	ActionRedo
+
+	// ActionEditExternal is bound to Ctrl-X Ctrl-E. See Editor.ExternalEditor.
+	ActionEditExternal
+
+	// ActionComplete is bound to Tab.
+	ActionComplete
+
+	// ActionListCandidates is bound to Alt-? and Alt-=.
+	ActionListCandidates
+
+	// ActionCopy copies the whole user input to the clipboard. Alt-w is bound to it. See Clipboard.
+	ActionCopy
+
+	// ActionUniversalArgument starts a numeric argument. Ctrl-U is bound to it if UniversalArgument is enabled.
+	ActionUniversalArgument
+
+	// ActionDigitArgument starts a numeric argument with the typed digit. Alt-digits are bound to it.
+	ActionDigitArgument
+
+	// ActionPaste inserts pasted text. It's triggered by bracketed paste. See BracketedPaste.
+	ActionPaste
+
+	// ActionHistoryPrev replaces the user input with the previous History entry. No keys are bound to it.
+	ActionHistoryPrev
+
+	// ActionHistoryNext replaces the user input with the next History entry. No keys are bound to it.
+	ActionHistoryNext
+
+	// ActionHistorySearchPrev replaces the user input with the previous History entry
+	// which starts with the text before the cursor. No keys are bound to it. See HistoryPrefixSearch.
+	ActionHistorySearchPrev
+
+	// ActionHistorySearchNext replaces the user input with the next History entry
+	// which starts with the text before the cursor. No keys are bound to it. See HistoryPrefixSearch.
+	ActionHistorySearchNext
+
+	// ActionInsertComment comments out the user input with CommentBegin and accepts it so that it's saved in History.
+	// Alt-# is bound to it.
+	ActionInsertComment
+
+	// ActionSearchBackward searches History backward incrementally. Ctrl-R is bound to it.
+	ActionSearchBackward
+
+	// ActionSearchForward searches History forward incrementally. Ctrl-S is bound to it.
+	// Note that terminals with flow control enabled don't send Ctrl-S.
+	ActionSearchForward
+
+	// ActionHistorySubstringPrev goes back to the previous History entry which contains the text before the cursor.
+	// Alt-p is bound to it.
+	ActionHistorySubstringPrev
+
+	// ActionHistorySubstringNext goes forward to the next History entry which contains the text before the cursor.
+	// Alt-n is bound to it.
+	ActionHistorySubstringNext
+
+	// ActionHistoryMenu lists recent History entries with numbers and loads the one user chooses. No keys are bound to it.
+	ActionHistoryMenu
+)
+
+// actionUnknown is the result of an escape sequence which isn't known.
+const actionUnknown Action = -1
+
+// errAccept tells Line to return the user input.
+var errAccept = errors.New("accept")
+
+// dispatch performs the action which k is bound to in Keymap or by default.
+// BeforeAction and AfterAction are called around it.
+func (e *Editor) dispatch(ctx context.Context, k KeyEvent) error {
+	if k.csi != nil && k.internal() && !isPaste(*k.csi) {
+		return e.editInternal(*k.csi)
+	}
+
+	if ok, err := e.lookup(e.Keymap, k, func(b Binding) error {
+		return e.doBinding(ctx, b, k)
+	}); ok {
+		return err
+	}
+
+	a, err := e.keyAction(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	switch a {
+	case ActionNone:
+		return nil
+	case actionUnknown:
+		return e.unknownSequence(k.Sequence)
+	}
+
+	return e.perform(ctx, a, k)
+}
+
+// Do performs a as if a key bound to it were typed so that custom key bindings, macros and tests can trigger editing actions.
+// BeforeAction and AfterAction are called around it.
+// It's safe to call from OnKey or another goroutine. If the action ends Line e.g. ActionAcceptLine,
+// Line returns as soon as OnKey returns or, if it's called from another goroutine, on the next key stroke.
+// Actions which read following key strokes e.g. ActionComplete should be performed from OnKey.
+// ActionInsert and ActionDigitArgument do nothing since there's no typed character.
+func (e *Editor) Do(a Action) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	e.init()
+
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	err := e.perform(ctx, a, KeyEvent{})
+	if err != nil && e.running {
+		e.exit = err
+	}
+	if errors.Is(err, errAccept) {
+		return nil
+	}
+	return err
+}
+
+// perform performs a calling BeforeAction and AfterAction around it.
+func (e *Editor) perform(ctx context.Context, a Action, k KeyEvent) error {
+	if e.BeforeAction != nil {
+		ok := true
+		e.unlocked(func() {
+			ok = e.BeforeAction(a)
+		})
+		if !ok {
+			return nil
+		}
+	}
+
+	n, redo := len(e.undo), e.redo
+	finish := func(err error) error {
+		e.dropUndo(n, redo)
+		e.lastAction = a
+
+		if e.AfterAction != nil && (err == nil || errors.Is(err, errAccept)) {
+			e.unlocked(func() {
+				e.AfterAction(a)
+			})
+		}
+
+		return err
+	}
+
+	m := e.mode
+	err := e.do(ctx, a, k)
+	if err == nil && e.mode != m && e.mode != nil {
+		// It's finished once the mode is done.
+		e.finish = finish
+		return nil
+	}
+	return finish(err)
+}
+
+// keyAction returns the action which k is bound to by default.
+// Ctrl-X starts reading the following key stroke to decide the action and returns ActionNone.
+func (e *Editor) keyAction(ctx context.Context, k KeyEvent) (Action, error) {
+	switch {
+	case k.csi != nil:
+		return csiAction(*k.csi), nil
+	case k.ss3 != 0:
+		switch k.Key {
+		case KeyUp:
+			return ActionMoveUp, nil
+		case KeyDown:
+			return ActionMoveDown, nil
+		case KeyRight:
+			return ActionMoveRight, nil
+		case KeyLeft:
+			return ActionMoveLeft, nil
+		case KeyHome:
+			return ActionMoveHome, nil
+		case KeyEnd:
+			return ActionMoveEnd, nil
+		case 0:
+			return actionUnknown, nil
+		}
+		return ActionNone, nil // known but not bound.
+	case k.Sequence != "":
+		return actionUnknown, nil
+	case k.Mod&ModAlt != 0:
+		return metaAction(k.Rune), nil
+	}
+
+	switch k.Key {
+	case KeyEnter:
+		return ActionAcceptLine, nil
+	case KeyCtrlC:
+		return ActionInterrupt, nil
+	case KeyBackspace, KeyCtrlH:
+		return ActionBackspace, nil
+	case KeyCtrlD:
+		return ActionDeleteOrEOF, nil
+	case KeyCtrlT:
+		return ActionSwap, nil
+	case KeyCtrlZ:
+		return ActionSuspend, nil
+	case KeyCtrlB:
+		return ActionMoveLeft, nil
+	case KeyCtrlF:
+		return ActionMoveRight, nil
+	case KeyCtrlP:
+		return ActionMoveUp, nil
+	case KeyCtrlN:
+		return ActionMoveDown, nil
+	case KeyCtrlU:
+		if e.UniversalArgument {
+			return ActionUniversalArgument, nil
+		}
+		return ActionKillLine, nil
+	case KeyCtrlK:
+		return ActionKillLineForward, nil
+	case KeyCtrlA:
+		return ActionMoveHome, nil
+	case KeyCtrlE:
+		return ActionMoveEnd, nil
+	case KeyCtrlL:
+		return ActionClearScreen, nil
+	case KeyCtrlW:
+		return ActionKillPrevWord, nil
+	case KeyCtrlR:
+		return ActionSearchBackward, nil
+	case KeyCtrlS:
+		return ActionSearchForward, nil
+	case KeyCtrlUnderscore:
+		return ActionUndo, nil
+	case KeyCtrlX:
+		e.chord(ctrlXKeymap, func(b Binding) error {
+			if b.Action == ActionNone {
+				return nil
+			}
+			return e.perform(ctx, b.Action, k)
+		})
+		return ActionNone, nil
+	case KeyTab:
+		return ActionComplete, nil
+	case KeyEsc:
+		return ActionNone, nil // Esc by itself isn't bound by default.
+	default:
+		return ActionInsert, nil
+	}
+}
+
+// metaAction returns the action which Meta with r is bound to.
+func metaAction(r rune) Action {
+	switch r {
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return ActionDigitArgument
+	case 'b':
+		return ActionMoveWordBackward
+	case 'f':
+		return ActionMoveWordForward
+	case 'd':
+		return ActionKillWordForward
+	case 'u':
+		return ActionUpcaseWord
+	case 'l':
+		return ActionDowncaseWord
+	case 'c':
+		return ActionCapitalizeWord
+	case ctrlB:
+		return ActionMoveTokenBackward
+	case ctrlF:
+		return ActionMoveTokenForward
+	case backspace, ctrlH:
+		return ActionKillWordBackward
+	case enter:
+		return ActionInsertNewline
+	case 'w':
+		return ActionCopy
+	case '?', '=':
+		return ActionListCandidates
+	case '#':
+		return ActionInsertComment
+	case 'p':
+		return ActionHistorySubstringPrev
+	case 'n':
+		return ActionHistorySubstringNext
+	}
+	return ActionNone
+}
+
+// csiAction returns the action which the control sequence sent by a special key is bound to.
+func csiAction(c csi) Action {
+	if c.private != 0 || c.intermediates != "" {
+		return actionUnknown
+	}
+
+	ps := c.params
+
+	// xterm encodes modifier keys in the second parameter as 1 + (shift: 1, alt: 2, ctrl: 4).
+	var word bool
+	if len(ps) > 1 && (ps[1]-1)&(2|4) != 0 {
+		word = true
+	}
+
+	switch c.final {
+	case 'A':
+		return ActionMoveUp
+	case 'B':
+		return ActionMoveDown
+	case 'C':
+		if word {
+			return ActionMoveWordForward
+		}
+		return ActionMoveRight
+	case 'D':
+		if word {
+			return ActionMoveWordBackward
+		}
+		return ActionMoveLeft
+	case 'H':
+		return ActionMoveHome
+	case 'F':
+		return ActionMoveEnd
+	case '~':
+		if len(ps) == 0 {
+			break
+		}
+
+		switch ps[0] {
+		case 1, 7:
+			return ActionMoveHome
+		case 3:
+			return ActionDelete
+		case 4, 8:
+			return ActionMoveEnd
+		case 200:
+			return ActionPaste
+		}
+	}
+
+	if c.key() != 0 {
+		return ActionNone // known but not bound e.g. function keys.
+	}
+
+	return actionUnknown
+}
+
+// isPaste tells if c is the beginning of pasted text.
+func isPaste(c csi) bool {
+	return c.private == 0 && c.final == '~' && len(c.params) > 0 && c.params[0] == 200
+}
+
+// editInternal handles reports from the terminal e.g. mouse events and cursor position reports.
+func (e *Editor) editInternal(c csi) error {
+	if c.private == '<' || (c.private == 0 && c.final == 'M' && len(c.params) == 0) {
+		return e.editMouse(c)
+	}
+
+	if c.private == 0 && c.intermediates == "" && c.final == 'R' && len(c.params) == 2 {
+		e.cursorReported(c.params[0], c.params[1])
+		return nil
+	}
+
+	return e.unknownSequence("\x1b[" + c.raw)
+}
+
+// do performs a.
+// k is the key stroke which triggered a e.g. the character to be inserted by ActionInsert.
+// It returns errAccept if Line should return the user input.
+func (e *Editor) do(ctx context.Context, a Action, k KeyEvent) error {
+	switch a {
+	case ActionAcceptLine:
+		if e.Validate != nil {
+			var err error
+			l := string(e.Buffer)
+			e.unlocked(func() {
+				err = e.Validate(l)
+			})
+			if errors.Is(err, ErrIncomplete) {
+				return e.editInsertNewline()
+			} else if err != nil {
+				return e.showMessage(err.Error())
+			}
+		}
+
+		dirty := e.prevMessage != "" || e.Indicator != IndicatorNone || e.flashing // the message, the indicator and the flash have to be cleared.
+
+		if e.OnAccept != nil {
+			var s string
+			var err error
+			l := string(e.Buffer)
+			e.unlocked(func() {
+				s, err = e.OnAccept(l)
+			})
+			if err != nil {
+				return e.showMessage(err.Error())
+			}
+			if s != string(e.Buffer) {
+				e.saveUndo()
+				e.Buffer = []rune(s)
+				e.Pos = len(e.Buffer)
+				dirty = true
+			}
+		}
+
+		if dirty {
+			e.flashing = false
+			e.accepting = true
+			err := e.refreshLine()
+			e.accepting = false
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := e.moveToBottom(); err != nil {
+			return err
+		}
+		return errAccept
+	case ActionInterrupt:
+		return e.interrupt()
+	case ActionInsert:
+		if k.Rune == 0 {
+			return nil
+		}
+		return e.editType(k.Rune)
+	case ActionInsertNewline:
+		return e.editInsertNewline()
+	case ActionBackspace:
+		return e.editBackspace()
+	case ActionDelete:
+		return e.editDelete()
+	case ActionDeleteOrEOF:
+		if len(e.Buffer) == 0 {
+			if e.IgnoreEOF {
+				return e.beep()
+			}
+			return io.EOF
+		}
+		return e.editDelete()
+	case ActionSwap:
+		return e.editSwap()
+	case ActionSuspend:
+		return e.suspend()
+	case ActionMoveLeft:
+		return e.editMoveLeft()
+	case ActionMoveRight:
+		return e.editMoveRight()
+	case ActionMoveUp:
+		return e.editMoveUp()
+	case ActionMoveDown:
+		return e.editMoveDown()
+	case ActionMoveHome:
+		return e.editMoveHome()
+	case ActionMoveEnd:
+		return e.editMoveEnd()
+	case ActionMoveWordBackward:
+		return e.editMoveWordBackward()
+	case ActionMoveWordForward:
+		return e.editMoveWordForward()
+	case ActionMoveTokenBackward:
+		return e.editMoveTokenBackward()
+	case ActionMoveTokenForward:
+		return e.editMoveTokenForward()
+	case ActionKillLine:
+		if err := e.kill(e.Buffer); err != nil {
+			return err
+		}
+		return e.editReset()
+	case ActionKillLineForward:
+		return e.editKillForward()
+	case ActionKillPrevWord:
+		return e.editDeletePrevWord()
+	case ActionKillWordBackward:
+		return e.editKillWordBackward()
+	case ActionKillWordForward:
+		return e.editKillWordForward()
+	case ActionUpcaseWord:
+		return e.editUpcaseWord()
+	case ActionDowncaseWord:
+		return e.editDowncaseWord()
+	case ActionCapitalizeWord:
+		return e.editCapitalizeWord()
+	case ActionClearScreen:
+		if err := e.clearScreen(); err != nil {
+			return err
+		}
+		return e.refreshLine()
+	case ActionUndo:
+		return e.Undo()
+	case ActionRedo:
+		return e.Redo()
+	case ActionEditExternal:
+		return e.editExternal()
+	case ActionComplete:
+		return e.completeLine(ctx)
+	case ActionListCandidates:
+		return e.editListCandidates(ctx)
+	case ActionCopy:
+		return e.editCopy()
+	case ActionUniversalArgument:
+		return e.editArgument(4, true)
+	case ActionDigitArgument:
+		if !isDigit(k.Rune) {
+			return nil
+		}
+		return e.editArgument(int(k.Rune-'0'), false)
+	case ActionPaste:
+		return e.editPaste()
+	case ActionHistoryPrev:
+		return e.editHistoryPrev()
+	case ActionHistoryNext:
+		return e.editHistoryNext()
+	case ActionHistorySearchPrev:
+		return e.editHistorySearchPrev()
+	case ActionHistorySearchNext:
+		return e.editHistorySearchNext()
+	case ActionSearchBackward:
+		return e.editSearch(searchBackward)
+	case ActionSearchForward:
+		return e.editSearch(searchForward)
+	case ActionHistorySubstringPrev:
+		return e.editHistorySubstring(true)
+	case ActionHistorySubstringNext:
+		return e.editHistorySubstring(false)
+	case ActionHistoryMenu:
+		return e.editHistoryMenu()
+	case ActionInsertComment:
+		if err := e.editInsertComment(); err != nil {
+			return err
+		}
+		if err := e.moveToBottom(); err != nil {
+			return err
+		}
+		return errAccept
+	}
+	return nil
+}
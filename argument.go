@@ -0,0 +1,89 @@
+package linesqueak
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxArgument limits numeric arguments so that a huge count doesn't exhaust memory.
+const maxArgument = 1000
+
+// editArgument reads a numeric argument following Meta-digit or Ctrl-U and repeats the next command accordingly.
+// n is the argument so far. If universal is true, n is multiplied by 4 on every Ctrl-U until a digit is typed.
+func (e *Editor) editArgument(n int, universal bool) error {
+	e.argPrompt = fmt.Sprintf("(arg: %d) ", n)
+	if err := e.refreshLine(); err != nil {
+		return err
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+
+			if r == esc {
+				d, err := e.readRune(ctx)
+				if err != nil {
+					return false, err
+				}
+				if !isDigit(d) {
+					e.unreadRune(d)
+					e.unreadRune(r)
+					return true, e.endArgument(n)
+				}
+				r = d
+			}
+
+			switch {
+			case isDigit(r):
+				if universal {
+					n, universal = 0, false
+				}
+				n = n*10 + int(r-'0')
+			case universal && r == ctrlU:
+				n *= 4
+			default:
+				e.unreadRune(r)
+				return true, e.endArgument(n)
+			}
+
+			if n > maxArgument {
+				n = maxArgument
+			}
+
+			e.argPrompt = fmt.Sprintf("(arg: %d) ", n)
+			return false, e.refreshLine()
+		},
+	})
+	return nil
+}
+
+// endArgument makes the next command repeated n times.
+func (e *Editor) endArgument(n int) error {
+	e.argPrompt = ""
+	if err := e.refreshLine(); err != nil {
+		return err
+	}
+
+	// The next command will be recorded and replayed.
+	e.count = n
+	e.recording = []rune{}
+	return nil
+}
+
+// replay repeats the recorded command so that it's executed as many times as the numeric argument.
+func (e *Editor) replay() {
+	for i := 1; i < e.count; i++ {
+		for j := len(e.recording) - 1; j >= 0; j-- {
+			e.unread = append(e.unread, readResult{r: e.recording[j]})
+		}
+	}
+	e.count = 0
+	e.recording = nil
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
@@ -0,0 +1,71 @@
+package linesqueak
+
+// autoClosePairs are the opening characters and the closing ones which AutoClose inserts.
+var autoClosePairs = map[rune]rune{
+	'(':  ')',
+	'[':  ']',
+	'{':  '}',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// isCloser tells if r is one of the closing characters which AutoClose inserts.
+func isCloser(r rune) bool {
+	for _, c := range autoClosePairs {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
+
+// editType inserts the typed character r.
+// If AutoClose is on, it also inserts the closing character of an opening one,
+// or moves the cursor over the closing character if user types the one under the cursor.
+func (e *Editor) editType(r rune) error {
+	if !e.AutoClose {
+		return e.editInsert(r)
+	}
+
+	if e.Pos < len(e.Buffer) && e.Buffer[e.Pos] == r && isCloser(r) {
+		e.Pos++
+		return e.refreshLine()
+	}
+
+	c, ok := autoClosePairs[r]
+	if !ok || !e.autoCloses(r) {
+		return e.editInsert(r)
+	}
+
+	// Consecutive insertions are reverted at once.
+	if !e.inserting || e.insertEnd != e.Pos {
+		e.saveUndo()
+	}
+
+	e.Buffer = append(e.Buffer, 0, 0)
+	copy(e.Buffer[e.Pos+2:], e.Buffer[e.Pos:])
+	e.Buffer[e.Pos], e.Buffer[e.Pos+1] = r, c
+
+	e.Pos++
+	e.inserting = true
+	e.insertEnd = e.Pos
+	return e.refreshEdit()
+}
+
+// autoCloses tells if the opening character r typed at the cursor should be closed.
+// By default, it's not closed inside quotes and a quote right after a word character e.g. don't isn't closed either.
+func (e *Editor) autoCloses(r rune) bool {
+	if e.AutoCloseFilter != nil {
+		return e.AutoCloseFilter(string(e.Buffer), e.Pos, r)
+	}
+
+	if ts := Tokenize(e.Buffer[:e.Pos]); len(ts) > 0 && ts[len(ts)-1].Quote != 0 {
+		return false
+	}
+
+	if (r == '"' || r == '\'') && e.Pos > 0 && isWordRune(e.Buffer[e.Pos-1]) {
+		return false
+	}
+
+	return true
+}
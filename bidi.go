@@ -0,0 +1,156 @@
+package linesqueak
+
+import "unicode"
+
+// BasicBidi returns the indices of line in the order they're displayed by a simplified
+// Unicode Bidirectional Algorithm https://unicode.org/reports/tr9/ for a left-to-right paragraph.
+// Runs of right-to-left characters e.g. Hebrew and Arabic are reversed along with spaces and punctuation between them,
+// and numbers in the runs stay left to right. Combining marks and emoji sequences stay with the characters before them.
+// Explicit embeddings and mirroring of brackets aren't supported.
+func BasicBidi(line []rune) []int {
+	type cluster struct {
+		start, end int
+		class      bidiClass
+		level      int
+	}
+
+	var cs []cluster
+	for i := 0; i < len(line); {
+		j := i + 1
+		for j < len(line) && extends(line[j-1], line[j]) {
+			j++
+		}
+		cs = append(cs, cluster{start: i, end: j, class: classify(line[i])})
+		i = j
+	}
+
+	// Numbers following right-to-left characters are left to right in the right-to-left run.
+	strong := bidiL
+	for i, c := range cs {
+		switch c.class {
+		case bidiL:
+			strong = bidiL
+		case bidiR:
+			strong = bidiR
+			cs[i].level = 1
+		case bidiNumber:
+			if strong == bidiR {
+				cs[i].level = 2
+			}
+		}
+	}
+
+	// Neutrals between characters of the same direction follow them. Otherwise, they're left to right.
+	for i := 0; i < len(cs); {
+		if cs[i].class != bidiNeutral {
+			i++
+			continue
+		}
+		j := i
+		for j < len(cs) && cs[j].class == bidiNeutral {
+			j++
+		}
+		if i > 0 && j < len(cs) && cs[i-1].level > 0 && cs[j].level > 0 {
+			for k := i; k < j; k++ {
+				cs[k].level = 1
+			}
+		}
+		i = j
+	}
+
+	// Reverse the runs from the highest level to the lowest odd level.
+	for l := 2; l > 0; l-- {
+		for i := 0; i < len(cs); {
+			if cs[i].level < l {
+				i++
+				continue
+			}
+			j := i
+			for j < len(cs) && cs[j].level >= l {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				cs[a], cs[b] = cs[b], cs[a]
+			}
+			i = j
+		}
+	}
+
+	order := make([]int, 0, len(line))
+	for _, c := range cs {
+		for i := c.start; i < c.end; i++ {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// bidiClass is a simplified bidirectional character type.
+type bidiClass int
+
+const (
+	bidiL bidiClass = iota // left to right
+	bidiR                  // right to left
+	bidiNumber
+	bidiNeutral
+)
+
+// classify returns the bidirectional character type of r.
+func classify(r rune) bidiClass {
+	switch {
+	case unicode.IsDigit(r):
+		return bidiNumber
+	case unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko):
+		return bidiR
+	case unicode.IsLetter(r), unicode.IsMark(r):
+		return bidiL
+	default:
+		return bidiNeutral
+	}
+}
+
+// visualOrder returns the indices of Buffer in the order they're displayed or nil if it's the same as Buffer.
+// Each line is reordered by Bidi.
+func (e *Editor) visualOrder() []int {
+	if e.Bidi == nil {
+		return nil
+	}
+
+	order := make([]int, 0, len(e.Buffer))
+	var start int
+	for i := 0; i <= len(e.Buffer); i++ {
+		if i < len(e.Buffer) && e.Buffer[i] != '\n' {
+			continue
+		}
+		vs := e.Bidi(e.Buffer[start:i])
+		if !permutation(vs, i-start) {
+			vs = nil
+			for j := range e.Buffer[start:i] {
+				vs = append(vs, j)
+			}
+		}
+		for _, v := range vs {
+			order = append(order, start+v)
+		}
+		if i < len(e.Buffer) {
+			order = append(order, i)
+		}
+		start = i + 1
+	}
+	return order
+}
+
+// permutation tells if vs contains each of 0 to n-1 exactly once.
+func permutation(vs []int, n int) bool {
+	if len(vs) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, v := range vs {
+		if v < 0 || v >= n || seen[v] {
+			return false
+		}
+		seen[v] = true
+	}
+	return true
+}
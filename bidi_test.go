@@ -0,0 +1,27 @@
+package linesqueak_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestBasicBidi(t *testing.T) {
+	for _, tc := range []struct {
+		line  string
+		order []int
+	}{
+		{line: "", order: []int{}},
+		{line: "abc", order: []int{0, 1, 2}},
+		{line: "אבג", order: []int{2, 1, 0}},
+		{line: "a אב c", order: []int{0, 1, 3, 2, 4, 5}},
+		{line: "אב 12 גד", order: []int{7, 6, 5, 3, 4, 2, 1, 0}},
+		{line: "a 12 b", order: []int{0, 1, 2, 3, 4, 5}},
+		{line: "אָב", order: []int{2, 0, 1}}, // the vowel point stays with the letter.
+	} {
+		if order := linesqueak.BasicBidi([]rune(tc.line)); !reflect.DeepEqual(order, tc.order) {
+			t.Errorf("%q: expected %v got %v", tc.line, tc.order, order)
+		}
+	}
+}
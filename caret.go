@@ -0,0 +1,25 @@
+package linesqueak
+
+// caretNotationOn and caretNotationOff surround control characters in caret notation
+// so that they're distinguishable from ordinary characters.
+const (
+	caretNotationOn  = "\x1b[7m"
+	caretNotationOff = "\x1b[27m"
+)
+
+// caret returns the caret notation of r e.g. ^C if r is a control character other than newline and tab.
+// C1 control characters are prefixed with M- like readline. Otherwise, it returns "".
+func caret(r rune) string {
+	switch {
+	case r == '\n', r == tab:
+		return ""
+	case r < 0x20:
+		return "^" + string(r+0x40)
+	case r == 0x7f:
+		return "^?"
+	case 0x80 <= r && r < 0xa0:
+		return "M-^" + string(r-0x40)
+	default:
+		return ""
+	}
+}
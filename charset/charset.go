@@ -0,0 +1,103 @@
+// Package charset lets linesqueak.Editor talk to terminals which don't use UTF-8
+// e.g. legacy telnet clients in Shift_JIS, Latin-1 or CP437.
+//
+// Input is decoded into UTF-8 and output is encoded with the terminal's encoding so that Editor keeps working on runes.
+// Since such terminals can't display most of Unicode, set Editor's Profile with Unicode false
+// so that Editor falls back to ASCII for its own indicators.
+package charset
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+
+	"github.com/ichiban/linesqueak"
+)
+
+// Transcode makes e talk to a terminal which uses enc by wrapping e's In and Out.
+// It has to be called before e is used.
+//
+//	e, err := telnet.NewEditor(conn)
+//	if err != nil {
+//		// ...
+//	}
+//	charset.Transcode(e, japanese.ShiftJIS)
+func Transcode(e *linesqueak.Editor, enc encoding.Encoding) {
+	e.In = bufio.NewReader(NewReader(e.In, enc))
+	e.Out = bufio.NewWriter(NewWriter(e.Out, enc))
+}
+
+// NewReader returns a reader which decodes r in enc into UTF-8.
+// Unlike transform.Reader, errors from r e.g. read deadlines are not sticky so that Editor can keep reading after them.
+func NewReader(r io.Reader, enc encoding.Encoding) io.Reader {
+	return &reader{r: r, t: enc.NewDecoder()}
+}
+
+// maxSrc is the number of bytes decoded at once and maxDst is large enough for the result
+// since a byte never results in more than 4 bytes of UTF-8.
+const (
+	maxSrc = 64
+	maxDst = 4 * maxSrc
+)
+
+type reader struct {
+	r   io.Reader
+	t   transform.Transformer
+	src [maxSrc]byte
+	n   int    // the number of bytes in src which aren't decoded yet e.g. the first byte of a 2-byte character.
+	dst []byte // decoded but not read yet.
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.dst) == 0 {
+		n, err := r.r.Read(r.src[r.n:])
+		r.n += n
+
+		var buf [maxDst]byte
+		nDst, nSrc, terr := r.t.Transform(buf[:], r.src[:r.n], errors.Is(err, io.EOF))
+		if terr != nil && !errors.Is(terr, transform.ErrShortSrc) {
+			return 0, terr
+		}
+		r.dst = append(r.dst, buf[:nDst]...)
+		r.n = copy(r.src[:], r.src[nSrc:r.n])
+
+		if err != nil && len(r.dst) == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.dst)
+	r.dst = r.dst[n:]
+	return n, nil
+}
+
+// NewWriter returns a writer which encodes UTF-8 into enc and writes it to w.
+// Characters which enc can't represent are replaced.
+// If w is buffered e.g. *bufio.Writer, it's flushed on every write so that output isn't held back.
+func NewWriter(w io.Writer, enc encoding.Encoding) io.Writer {
+	tw := transform.NewWriter(w, encoding.ReplaceUnsupported(enc.NewEncoder()))
+	if f, ok := w.(flusher); ok {
+		return &flushWriter{w: tw, f: f}
+	}
+	return tw
+}
+
+type flusher interface {
+	Flush() error
+}
+
+type flushWriter struct {
+	w io.Writer
+	f flusher
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, w.f.Flush()
+}
@@ -0,0 +1,34 @@
+package charset_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/ichiban/linesqueak"
+	"github.com/ichiban/linesqueak/charset"
+)
+
+func TestTranscode(t *testing.T) {
+	var out bytes.Buffer
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(bytes.NewReader([]byte("caf\xe9\r"))),
+		Out:    bufio.NewWriter(&out),
+		Prompt: "» ",
+	}
+	charset.Transcode(e, charmap.ISO8859_1)
+
+	l, err := e.Line()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != "café" {
+		t.Errorf(`expected "café" got %#v`, l)
+	}
+
+	if !bytes.Contains(out.Bytes(), []byte("\r\xbb caf\xe9\x1b[0K")) {
+		t.Errorf("unexpected %q", out.Bytes())
+	}
+}
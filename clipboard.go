@@ -0,0 +1,50 @@
+package linesqueak
+
+import "encoding/base64"
+
+// CopyToClipboard copies s to the clipboard of the terminal via OSC 52.
+// It works regardless of Clipboard as long as the terminal supports it.
+// It's safe to call from another goroutine while Line is running.
+func (e *Editor) CopyToClipboard(s string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	return e.copyToClipboard(s)
+}
+
+// copyToClipboard is CopyToClipboard while mu is held.
+func (e *Editor) copyToClipboard(s string) error {
+	if _, err := e.Out.WriteString(osc52(s)); err != nil {
+		return ioError("write", err)
+	}
+	return ioError("write", e.Out.Flush())
+}
+
+// kill copies killed text to the clipboard if Clipboard is enabled and the user input isn't masked.
+func (e *Editor) kill(rs []rune) error {
+	if !e.Clipboard || e.Mask != 0 || len(rs) == 0 {
+		return nil
+	}
+
+	// It'll be flushed along with the following refresh.
+	_, err := e.Out.WriteString(osc52(string(rs)))
+	return ioError("write", err)
+}
+
+// editCopy copies the whole user input to the clipboard.
+func (e *Editor) editCopy() error {
+	if !e.Clipboard || e.Mask != 0 || len(e.Buffer) == 0 {
+		return e.beep()
+	}
+
+	return e.copyToClipboard(string(e.Buffer))
+}
+
+// osc52 returns an escape sequence to set the clipboard to s.
+func osc52(s string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\a"
+}
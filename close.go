@@ -0,0 +1,41 @@
+package linesqueak
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClosed is returned by Line, Write, etc. after Close.
+var ErrClosed = errors.New("editor closed")
+
+// Close restores the terminal so that it isn't left in a weird state e.g. when the session is torn down.
+// It turns off the modes Line enables e.g. bracketed paste and mouse reporting, restores the window title
+// saved by SetTitle, moves the cursor below the editor region and flushes the output.
+// After that, Line, Write, etc. return ErrClosed.
+// It's safe to call from another goroutine while Line is running. In that case, Line returns ErrClosed
+// on the next key stroke. Close the connection or cancel the context of LineContext to interrupt it right away.
+func (e *Editor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	ew := errWriter{w: e.Out}
+	if e.running {
+		_, off := e.modes()
+		ew.writeString(off)
+		if e.MaxRows-e.cursorRow > 0 {
+			ew.writeString(fmt.Sprintf("\x1b[%dB", e.MaxRows-e.cursorRow))
+		}
+		ew.writeString("\r\n")
+	}
+	if e.titleSaved {
+		ew.writeString("\x1b[23;0t") // pop the title from the stack
+		e.titleSaved = false
+	}
+	ew.flush()
+	return ew.err
+}
@@ -0,0 +1,61 @@
+package linesqueak
+
+import "unicode"
+
+const (
+	zwj  = '\u200d' // zero width joiner which joins emojis into one e.g. 👩‍💻.
+	vs16 = '\ufe0f' // variation selector-16 which requests emoji presentation e.g. ❤️.
+)
+
+// extends tells if r is displayed in the same cell as the preceding prev
+// e.g. a combining mark, a variation selector, a skin tone modifier or an emoji joined by ZWJ.
+func extends(prev, r rune) bool {
+	switch {
+	case r == '\n' || prev == '\n':
+		return false
+	case prev == zwj, r == zwj:
+		return true
+	case 0xfe00 <= r && r <= 0xfe0f: // variation selectors
+		return true
+	case 0x1f3fb <= r && r <= 0x1f3ff: // emoji modifiers
+		return true
+	default:
+		return unicode.In(r, unicode.Mn, unicode.Me)
+	}
+}
+
+// prevCluster returns the beginning of the cluster of runes which ends at p.
+func (e *Editor) prevCluster(p int) int {
+	for p--; p > 0 && extends(e.Buffer[p-1], e.Buffer[p]); p-- {
+	}
+	return p
+}
+
+// nextCluster returns the end of the cluster of runes which begins at p.
+func (e *Editor) nextCluster(p int) int {
+	for p++; p < len(e.Buffer) && extends(e.Buffer[p-1], e.Buffer[p]); p++ {
+	}
+	return p
+}
+
+// joining returns a function which measures a series of runes with f but an emoji sequence occupies a single cell.
+// An emoji following ZWJ or a skin tone modifier is displayed in the same cell as the emoji before it,
+// and VS16 makes a narrow character e.g. ❤ an emoji as wide as the others.
+func joining(f func(rune) int) func(rune) int {
+	var prev rune
+	var cell int // the width of the cell the last rune is displayed in.
+	return func(r rune) int {
+		w := f(r)
+		switch {
+		case extends(prev, r) && (prev == zwj || 0x1f3fb <= r && r <= 0x1f3ff):
+			w = 0
+		case r == vs16 && cell == 1 && prev > unicode.MaxASCII:
+			w = 1
+			cell = 2
+		case w > 0:
+			cell = w
+		}
+		prev = r
+		return w
+	}
+}
@@ -0,0 +1,106 @@
+package linesqueak
+
+import (
+	"fmt"
+	"sort"
+)
+
+// actionNames are the names of actions. They're the conventional readline command names if there are.
+var actionNames = map[Action]string{
+	ActionAcceptLine:           "accept-line",
+	ActionInterrupt:            "interrupt",
+	ActionInsert:               "self-insert",
+	ActionInsertNewline:        "insert-newline",
+	ActionBackspace:            "backward-delete-char",
+	ActionDelete:               "delete-char",
+	ActionDeleteOrEOF:          "delete-char-or-eof",
+	ActionSwap:                 "transpose-chars",
+	ActionSuspend:              "suspend",
+	ActionMoveLeft:             "backward-char",
+	ActionMoveRight:            "forward-char",
+	ActionMoveUp:               "up-line-or-history",
+	ActionMoveDown:             "down-line-or-history",
+	ActionMoveHome:             "beginning-of-line",
+	ActionMoveEnd:              "end-of-line",
+	ActionMoveWordBackward:     "backward-word",
+	ActionMoveWordForward:      "forward-word",
+	ActionMoveTokenBackward:    "shell-backward-word",
+	ActionMoveTokenForward:     "shell-forward-word",
+	ActionKillLine:             "kill-whole-line",
+	ActionKillLineForward:      "kill-line",
+	ActionKillPrevWord:         "unix-word-rubout",
+	ActionKillWordBackward:     "backward-kill-word",
+	ActionKillWordForward:      "kill-word",
+	ActionUpcaseWord:           "upcase-word",
+	ActionDowncaseWord:         "downcase-word",
+	ActionCapitalizeWord:       "capitalize-word",
+	ActionClearScreen:          "clear-screen",
+	ActionUndo:                 "undo",
+	ActionRedo:                 "redo",
+	ActionEditExternal:         "edit-command-line",
+	ActionComplete:             "complete",
+	ActionListCandidates:       "possible-completions",
+	ActionCopy:                 "copy-line",
+	ActionUniversalArgument:    "universal-argument",
+	ActionDigitArgument:        "digit-argument",
+	ActionPaste:                "bracketed-paste-begin",
+	ActionHistoryPrev:          "previous-history",
+	ActionHistoryNext:          "next-history",
+	ActionHistorySearchPrev:    "history-search-backward",
+	ActionHistorySearchNext:    "history-search-forward",
+	ActionInsertComment:        "insert-comment",
+	ActionSearchBackward:       "reverse-search-history",
+	ActionSearchForward:        "forward-search-history",
+	ActionHistorySubstringPrev: "history-substring-search-backward",
+	ActionHistorySubstringNext: "history-substring-search-forward",
+	ActionHistoryMenu:          "history-menu",
+}
+
+// actionsByName is the reverse lookup of actionNames.
+var actionsByName = func() map[string]Action {
+	m := make(map[string]Action, len(actionNames))
+	for a, n := range actionNames {
+		m[n] = a
+	}
+	return m
+}()
+
+// String returns the name of the action e.g. "backward-kill-word".
+func (a Action) String() string {
+	if n, ok := actionNames[a]; ok {
+		return n
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ActionByName returns the action named name e.g. "backward-kill-word". See Action.String.
+func ActionByName(name string) (Action, bool) {
+	a, ok := actionsByName[name]
+	return a, ok
+}
+
+// ActionNames returns the names of all the actions in alphabetical order e.g. for documentation.
+func ActionNames() []string {
+	ns := make([]string, 0, len(actionNames))
+	for _, n := range actionNames {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// Command is a named command defined by application.
+// It's called without locking the editor so that it can call Do, Write or Refresh.
+type Command func(e *Editor) error
+
+// DoCommand performs the command named name. Commands takes precedence over the actions of the same names.
+// It returns an error if there's no such command.
+func (e *Editor) DoCommand(name string) error {
+	if c, ok := e.Commands[name]; ok {
+		return c(e)
+	}
+	if a, ok := ActionByName(name); ok {
+		return e.Do(a)
+	}
+	return fmt.Errorf("unknown command: %s", name)
+}
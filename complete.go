@@ -0,0 +1,573 @@
+package linesqueak
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CompletionMode represents how completion suggestions are presented.
+type CompletionMode int
+
+const (
+	// CompletionCycle replaces the user input with each suggestion in turn on every Tab and in reverse order on every Shift-Tab.
+	// Esc reverts to the original input and any other key accepts the current suggestion. See CompletionKeys.
+	CompletionCycle CompletionMode = iota
+
+	// CompletionPrefix inserts the longest common prefix of the suggestions on the first Tab
+	// and lists the suggestions on the second Tab like bash.
+	CompletionPrefix
+)
+
+// Candidate is a completion suggestion.
+type Candidate struct {
+	// InsertText replaces the user input when the candidate is chosen.
+	InsertText string
+
+	// Display is shown in place of InsertText when candidates are listed.
+	// Display is OPTIONAL. If it's empty, InsertText is shown instead.
+	Display string
+
+	// Description is shown next to the candidate.
+	// Description is OPTIONAL.
+	Description string
+}
+
+func (c *Candidate) label() string {
+	if c.Display != "" {
+		return c.Display
+	}
+	return c.InsertText
+}
+
+// completingIndicator is displayed while CompleteContext is running.
+// completingIndicatorASCII is displayed instead if the terminal can't display Unicode.
+const (
+	completingIndicator      = "completing…"
+	completingIndicatorASCII = "completing..."
+)
+
+// completes tells if any of the completion functions is provided or CompleteFromHistory is on.
+func (e *Editor) completes() bool {
+	return e.Complete != nil || e.CompleteCandidates != nil || e.CompleteAt != nil || e.CompleteContext != nil || e.CompleteFromHistory
+}
+
+// candidates returns completion suggestions from CompleteContext, CompleteAt, CompleteCandidates, Complete or History
+// filtered by CompleteFilter and sorted by CompleteSort.
+// If user types while CompleteContext is running, it returns false and the key stroke is left to be read later.
+// If CompleteAt fails, the error is displayed and it returns false.
+func (e *Editor) candidates(ctx context.Context) ([]Candidate, bool, error) {
+	var cs []Candidate
+	switch {
+	case e.CompleteContext != nil:
+		var ok bool
+		var err error
+		cs, ok, err = e.candidatesAsync(ctx)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+	case e.CompleteAt != nil:
+		var err error
+		s, p := string(e.Buffer), e.Pos
+		e.unlocked(func() {
+			cs, err = e.CompleteAt(s, p)
+		})
+		if err != nil {
+			return nil, false, e.showMessage(err.Error())
+		}
+	case e.CompleteCandidates != nil:
+		s := string(e.Buffer)
+		e.unlocked(func() {
+			cs = e.CompleteCandidates(s)
+		})
+	case e.Complete == nil:
+		cs = e.historyCandidates()
+	default:
+		var opts []string
+		s := string(e.Buffer)
+		e.unlocked(func() {
+			opts = e.Complete(s)
+		})
+		cs = make([]Candidate, len(opts))
+		for i, o := range opts {
+			cs[i] = Candidate{InsertText: o}
+		}
+	}
+
+	e.unlocked(func() {
+		if e.CompleteFilter != nil {
+			fs := make([]Candidate, 0, len(cs))
+			for _, c := range cs {
+				if e.CompleteFilter(c) {
+					fs = append(fs, c)
+				}
+			}
+			cs = fs
+		}
+
+		if e.CompleteSort != nil {
+			sort.SliceStable(cs, func(i, j int) bool {
+				return e.CompleteSort(cs[i], cs[j])
+			})
+		}
+	})
+
+	return cs, true, nil
+}
+
+// historyCandidates returns the History entries which start with the user input, the most recent first without duplicates.
+func (e *Editor) historyCandidates() []Candidate {
+	e.syncHistory()
+	s := string(e.Buffer)
+	var cs []Candidate
+	seen := map[string]bool{}
+	ents := e.History.entries()
+	for i := len(ents) - 1; i >= 0; i-- {
+		l := ents[i]
+		if l == s || seen[l] || !strings.HasPrefix(l, s) {
+			continue
+		}
+		seen[l] = true
+		cs = append(cs, Candidate{InsertText: l})
+	}
+	return cs
+}
+
+func (e *Editor) candidatesAsync(ctx context.Context) ([]Candidate, bool, error) {
+	if len(e.unread) > 0 {
+		// user has already typed something else.
+		return nil, false, nil
+	}
+
+	if e.feeder != nil {
+		// Feeder can't wait for CompleteContext in the background.
+		var cs []Candidate
+		s := string(e.Buffer)
+		e.unlocked(func() {
+			cs = e.CompleteContext(ctx, s)
+		})
+		return cs, true, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan []Candidate, 1)
+	go func(s string) {
+		results <- e.CompleteContext(ctx, s)
+	}(string(e.Buffer))
+
+	e.message = e.ascii(completingIndicator, completingIndicatorASCII)
+	err := e.refreshLine()
+	e.message = ""
+	if err != nil {
+		return nil, false, err
+	}
+
+	runes := e.background()
+	var cs []Candidate
+	var res readResult
+	var completed, received bool
+	e.unlocked(func() {
+		select {
+		case cs = <-results:
+			completed = true
+		case res = <-runes:
+			received = true
+		case <-ctx.Done():
+		}
+	})
+
+	switch {
+	case completed:
+		return cs, true, nil
+	case received:
+		e.received(res)
+		e.unreadResult(res)
+		return nil, false, e.refreshLine()
+	default:
+		return nil, false, ctx.Err()
+	}
+}
+
+func (e *Editor) completeLine(ctx context.Context) error {
+	if !e.completes() {
+		return e.editInsert(tab)
+	}
+
+	if e.CompletionMode == CompletionPrefix {
+		return e.completePrefix(ctx)
+	}
+
+	opts, ok, err := e.candidates(ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	if len(opts) == 0 {
+		return e.beep()
+	}
+	opts = append(opts, Candidate{InsertText: string(e.Buffer)})
+
+	keys := e.CompletionKeys.withDefaults()
+	pos := 0
+
+	show := func() error {
+		c := opts[pos]
+		e.message = c.Description
+		err := e.refreshLineString(c.InsertText)
+		e.message = ""
+		return err
+	}
+
+	if err := show(); err != nil {
+		return err
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+
+			k := KeyEvent{Key: control(r), Rune: r}
+			raw := []rune{r}
+			if r == esc {
+				k, err = e.readEscape(ctx)
+				if err != nil {
+					return false, err
+				}
+				switch {
+				case k.Sequence != "":
+					raw = []rune(k.Sequence)
+				case k.Mod == ModAlt:
+					// Esc followed by a key. The following key is handled as usual.
+					e.unreadRune(k.Rune)
+					k = KeyEvent{Key: KeyEsc, Rune: esc}
+				}
+			}
+
+			key := k.Key
+			if key == 0 && k.Mod == 0 {
+				key = Key(k.Rune)
+			}
+
+			switch {
+			case hasKey(keys.Next, key):
+				pos = (pos + 1) % len(opts)
+				return false, show()
+			case hasKey(keys.Prev, key):
+				pos = (pos + len(opts) - 1) % len(opts)
+				return false, show()
+			case hasKey(keys.Cancel, key):
+				return true, e.refreshLine()
+			case hasKey(keys.Accept, key):
+				// The key is consumed.
+			default:
+				// Other keys accept the current suggestion and are handled as usual.
+				for i := len(raw) - 1; i >= 0; i-- {
+					e.unreadRune(raw[i])
+				}
+			}
+
+			e.saveUndo()
+			e.Buffer = []rune(opts[pos].InsertText)
+			e.Pos = len(e.Buffer)
+			return true, nil
+		},
+	})
+	return nil
+}
+
+// CompletionKeys are the keys which control CompletionCycle.
+// Keys which aren't listed accept the current suggestion and are handled as usual.
+// Printable characters are identified by their code points e.g. Key(' ') as in Keymap.
+type CompletionKeys struct {
+	// Next shows the next suggestion. By default, it's Tab.
+	Next []Key
+
+	// Prev shows the previous suggestion. By default, it's Shift-Tab.
+	Prev []Key
+
+	// Accept accepts the current suggestion without being handled as usual. By default, there's none.
+	Accept []Key
+
+	// Cancel reverts to the original input. By default, it's Esc.
+	Cancel []Key
+}
+
+func (c CompletionKeys) withDefaults() CompletionKeys {
+	if c.Next == nil {
+		c.Next = []Key{KeyTab}
+	}
+	if c.Prev == nil {
+		c.Prev = []Key{KeyShiftTab}
+	}
+	if c.Cancel == nil {
+		c.Cancel = []Key{KeyEsc}
+	}
+	return c
+}
+
+// hasKey tells if ks contains k.
+func hasKey(ks []Key, k Key) bool {
+	if k == 0 {
+		return false
+	}
+	for _, e := range ks {
+		if e == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Editor) completePrefix(ctx context.Context) error {
+	opts, ok, err := e.candidates(ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	if len(opts) == 0 {
+		return e.beep()
+	}
+
+	ss := make([]string, len(opts))
+	for i, o := range opts {
+		ss[i] = o.InsertText
+	}
+
+	p := []rune(commonPrefix(ss))
+	if len(p) > len(e.Buffer) {
+		e.saveUndo()
+		e.Buffer = p
+		e.Pos = len(e.Buffer)
+		if err := e.refreshLine(); err != nil {
+			return err
+		}
+	} else if err := e.beep(); err != nil {
+		return err
+	}
+
+	if len(opts) == 1 {
+		return nil
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+
+			if r != tab {
+				e.unreadRune(r)
+				return true, nil
+			}
+
+			return true, e.showCandidates(opts)
+		},
+	})
+	return nil
+}
+
+// editListCandidates lists all the completion suggestions below the user input without changing the user input.
+// The list is cleared on the next key stroke.
+func (e *Editor) editListCandidates(ctx context.Context) error {
+	if !e.completes() {
+		return nil
+	}
+
+	opts, ok, err := e.candidates(ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	if len(opts) == 0 {
+		return e.beep()
+	}
+
+	return e.showCandidates(opts)
+}
+
+// morePrompt is displayed below a page of completion suggestions if there are more.
+const morePrompt = "--More--"
+
+// showCandidates lists opts below the user input.
+// If there are more than CompletionQueryItems, it asks user if they should be listed.
+// If they don't fit in the terminal, they're displayed page by page:
+// Space shows the next page, Enter shows the next line and any other key stops paging.
+func (e *Editor) showCandidates(opts []Candidate) error {
+	if e.CompletionQueryItems <= 0 || len(opts) <= e.CompletionQueryItems {
+		return e.pageCandidates(opts)
+	}
+
+	e.message = fmt.Sprintf("Display all %d possibilities? (y or n)", len(opts))
+	err := e.refreshLine()
+	e.message = ""
+	if err != nil {
+		return err
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+			if r != 'y' && r != 'Y' {
+				return true, e.refreshLine()
+			}
+			return true, e.pageCandidates(opts)
+		},
+	})
+	return nil
+}
+
+// pageCandidates lists opts below the user input page by page.
+func (e *Editor) pageCandidates(opts []Candidate) error {
+	ls := strings.Split(e.listCandidates(opts), "\n")
+
+	// The rest of the screen below the user input leaving a row for morePrompt.
+	_, p := e.positions(validUTF8(e.prompt()))
+	n := e.Rows - p.rows - 2
+	if n < 1 {
+		n = 1
+	}
+
+	var top int
+	page := func() (bool, error) {
+		if len(ls)-top <= n+1 {
+			e.message = strings.Join(ls[top:], "\n")
+			return true, e.refreshLine()
+		}
+
+		e.message = strings.Join(ls[top:top+n], "\n") + "\n" + morePrompt
+		err := e.refreshLine()
+		e.message = ""
+		return false, err
+	}
+
+	if done, err := page(); done || err != nil {
+		return err
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+
+			switch r {
+			case ' ':
+				top += n
+			case enter, '\n':
+				top++
+			case 'q', 'Q':
+				return true, e.refreshLine()
+			default:
+				e.unreadRune(r)
+				return true, e.refreshLine()
+			}
+
+			return page()
+		},
+	})
+	return nil
+}
+
+// listCandidates formats opts to be displayed below the user input.
+// Candidates without descriptions are listed in columns fitting in the terminal width like bash.
+// Candidates with descriptions are listed one per line with their descriptions aligned.
+func (e *Editor) listCandidates(opts []Candidate) string {
+	var desc bool
+	var lw int
+	f := e.width()
+	for _, o := range opts {
+		if o.Description != "" {
+			desc = true
+		}
+		var w int
+		for _, r := range o.label() {
+			w += f(r)
+		}
+		if w > lw {
+			lw = w
+		}
+	}
+
+	ls := make([]string, len(opts))
+	for i, o := range opts {
+		ls[i] = o.label()
+	}
+
+	if !desc {
+		return e.columns(ls, lw)
+	}
+
+	for i, o := range opts {
+		if o.Description == "" {
+			continue
+		}
+		var w int
+		for _, r := range ls[i] {
+			w += f(r)
+		}
+		ls[i] += strings.Repeat(" ", lw-w) + "  " + o.Description
+	}
+	return strings.Join(ls, "\n")
+}
+
+// columnGap is the number of spaces between columns of candidates.
+const columnGap = 2
+
+// columns lays out ls in as many columns of width lw as fit in the terminal width.
+// The labels are sorted top to bottom, then left to right.
+func (e *Editor) columns(ls []string, lw int) string {
+	cols := (e.Cols + columnGap) / (lw + columnGap)
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(ls) + cols - 1) / cols
+
+	f := e.width()
+	var b strings.Builder
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString("\n")
+		}
+		for i := r; i < len(ls); i += rows {
+			b.WriteString(ls[i])
+			if i+rows >= len(ls) {
+				break
+			}
+			var w int
+			for _, r := range ls[i] {
+				w += f(r)
+			}
+			b.WriteString(strings.Repeat(" ", lw-w+columnGap))
+		}
+	}
+	return b.String()
+}
+
+// commonPrefix returns the longest common prefix of ss.
+func commonPrefix(ss []string) string {
+	p := []rune(ss[0])
+	for _, s := range ss[1:] {
+		rs := []rune(s)
+		if len(rs) < len(p) {
+			p = p[:len(rs)]
+		}
+		for i := range p {
+			if p[i] != rs[i] {
+				p = p[:i]
+				break
+			}
+		}
+	}
+	return string(p)
+}
@@ -0,0 +1,162 @@
+// Package completers provides ready-made completion functions for linesqueak.Editor.
+package completers
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ichiban/linesqueak"
+)
+
+// Path completes a file path at the end of the user input.
+// It understands paths quoted with ' or " and spaces escaped with \ like shells do.
+//
+//	e := &linesqueak.Editor{
+//		// ...
+//		Complete: (&completers.Path{Base: "/srv/ftp"}).Complete,
+//	}
+type Path struct {
+	// Base is the directory which paths are resolved against.
+	// Paths can't go out of Base i.e. / and .. at the top of Base point Base itself
+	// and symbolic links which point outside Base or by absolute paths aren't followed.
+	// Base is OPTIONAL. If it's empty, paths are resolved against the current working directory of the process
+	// and the whole file system is visible.
+	Base string
+
+	// DirsOnly limits suggestions to directories.
+	DirsOnly bool
+}
+
+// Complete returns the user input with the path at the end completed.
+// It's meant to be used as Editor.Complete.
+func (p *Path) Complete(s string) []string {
+	var ret []string
+	for _, c := range p.CompleteCandidates(s) {
+		ret = append(ret, c.InsertText)
+	}
+	return ret
+}
+
+// CompleteCandidates is like Complete but the candidates are displayed as file names.
+// It's meant to be used as Editor.CompleteCandidates.
+func (p *Path) CompleteCandidates(s string) []linesqueak.Candidate {
+	rs := []rune(s)
+	start, word, quote := len(rs), "", rune(0)
+	if ts := linesqueak.Tokenize(rs); len(ts) > 0 && ts[len(ts)-1].End == len(rs) {
+		t := ts[len(ts)-1]
+		start, word, quote = t.Start, t.Value, t.Quote
+	}
+	head := string(rs[:start])
+
+	dir, prefix := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dir, prefix = word[:i+1], word[i+1:]
+	}
+
+	var root *os.Root
+	if p.Base != "" {
+		var err error
+		root, err = os.OpenRoot(p.Base)
+		if err != nil {
+			return nil
+		}
+		defer func() {
+			_ = root.Close()
+		}()
+	}
+
+	entries, err := p.readDir(root, dir)
+	if err != nil {
+		return nil
+	}
+
+	var cs []linesqueak.Candidate
+	for _, ent := range entries {
+		name := ent.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		// hidden files are shown only if they're asked explicitly.
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+
+		isDir := ent.IsDir()
+		if !isDir && ent.Type()&os.ModeSymlink != 0 {
+			if fi, err := p.stat(root, dir+name); err == nil {
+				isDir = fi.IsDir()
+			}
+		}
+
+		if p.DirsOnly && !isDir {
+			continue
+		}
+
+		if isDir {
+			name += "/"
+		}
+
+		cs = append(cs, linesqueak.Candidate{
+			InsertText: head + requote(dir+name, quote, !isDir),
+			Display:    name,
+		})
+	}
+	return cs
+}
+
+// readDir reads dir in the user input. If Base is provided, dir is read in root opened at Base.
+func (p *Path) readDir(root *os.Root, dir string) ([]os.DirEntry, error) {
+	if root == nil {
+		if dir == "" {
+			dir = "."
+		}
+		return os.ReadDir(dir)
+	}
+	return fs.ReadDir(root.FS(), rootPath(dir))
+}
+
+// stat returns the file info of name in the user input following symbolic links.
+// If Base is provided, name is looked up in root opened at Base.
+func (p *Path) stat(root *os.Root, name string) (os.FileInfo, error) {
+	if root == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(root.FS(), rootPath(name))
+}
+
+// rootPath converts name in the user input to a path in Base. / and .. at the top of Base point Base itself.
+func rootPath(name string) string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+// requote quotes or escapes w so that it stays one word.
+// If the path is complete i.e. not a directory, the quote is closed.
+func requote(w string, quote rune, complete bool) string {
+	switch quote {
+	case '\'':
+		w = "'" + strings.Replace(w, "'", `'\''`, -1)
+	case '"':
+		w = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(w)
+	default:
+		var b strings.Builder
+		for _, r := range w {
+			if strings.ContainsRune(" \t'\"\\$`&|;<>()*?[]!#~", r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	if complete {
+		w += string(quote)
+	}
+	return w
+}
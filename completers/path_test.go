@@ -0,0 +1,83 @@
+package completers_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ichiban/linesqueak/completers"
+)
+
+func TestPath_Complete(t *testing.T) {
+	base := t.TempDir()
+	for _, d := range []string{"docs", "my docs", ".git"} {
+		if err := os.Mkdir(filepath.Join(base, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"docs/readme.txt", "my docs/notes.txt", "main.go"} {
+		if err := os.WriteFile(filepath.Join(base, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := completers.Path{Base: base}
+
+	for _, tc := range []struct {
+		input    string
+		expected []string
+	}{
+		{input: "cat ", expected: []string{`cat docs/`, `cat main.go`, `cat my\ docs/`}},
+		{input: "cat m", expected: []string{`cat main.go`, `cat my\ docs/`}},
+		{input: "cat my\\ d", expected: []string{`cat my\ docs/`}},
+		{input: "cat 'my d", expected: []string{`cat 'my docs/`}},
+		{input: "cat \"my docs/n", expected: []string{`cat "my docs/notes.txt"`}},
+		{input: "cat docs/", expected: []string{`cat docs/readme.txt`}},
+		{input: "cat .", expected: []string{`cat .git/`}},
+		{input: "cat ../../", expected: []string{`cat ../../docs/`, `cat ../../main.go`, `cat ../../my\ docs/`}},
+		{input: "cat x", expected: nil},
+	} {
+		if cs := p.Complete(tc.input); !reflect.DeepEqual(cs, tc.expected) {
+			t.Errorf("%q: expected %q got %q", tc.input, tc.expected, cs)
+		}
+	}
+
+	p.DirsOnly = true
+	if cs := p.Complete("cd m"); !reflect.DeepEqual(cs, []string{`cd my\ docs/`}) {
+		t.Errorf(`expected ["cd my\\ docs/"] got %q`, cs)
+	}
+}
+
+func TestPath_Complete_Symlink(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := t.TempDir()
+	if err := os.Mkdir(filepath.Join(base, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs", filepath.Join(base, "in")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(base, "out")); err != nil {
+		t.Skip(err)
+	}
+
+	p := completers.Path{Base: base}
+
+	for _, tc := range []struct {
+		input    string
+		expected []string
+	}{
+		{input: "cd i", expected: []string{`cd in/`}},
+		{input: "cd o", expected: []string{`cd out`}},
+		{input: "cat out/", expected: nil},
+	} {
+		if cs := p.Complete(tc.input); !reflect.DeepEqual(cs, tc.expected) {
+			t.Errorf("%q: expected %q got %q", tc.input, tc.expected, cs)
+		}
+	}
+}
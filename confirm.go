@@ -0,0 +1,91 @@
+package linesqueak
+
+import (
+	"context"
+	"io"
+)
+
+// Confirm asks user a yes/no question. prompt is followed by [Y/n] or [y/N] depending on def.
+// User answers with a single key: y or n, or Enter for def. The answer is displayed after prompt.
+// Ctrl-C returns ErrInterrupt and Ctrl-D returns io.EOF. Other keys ring the bell.
+// The normal prompt and Buffer are kept intact for the following Line.
+func (e *Editor) Confirm(prompt string, def bool) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return false, ErrClosed
+	}
+
+	e.running = true
+	defer func() {
+		e.running = false
+	}()
+
+	yn := " [y/N] "
+	if def {
+		yn = " [Y/n] "
+	}
+
+	b, p := e.Buffer, e.Pos
+	e.question = prompt + yn
+	defer func() {
+		e.question = ""
+		e.Buffer, e.Pos = b, p
+	}()
+
+	e.MaxRows = 0
+	e.cursorRow = 0
+	e.topKnown = false
+	e.scroll = 0
+	e.init()
+	e.Buffer = nil
+	e.OldPos = 0
+	e.Pos = 0
+	if err := e.refreshLine(); err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	for {
+		r, err := e.readRune(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		var ok bool
+		switch r {
+		case 'y', 'Y':
+			ok = true
+		case 'n', 'N':
+			ok = false
+		case enter:
+			ok = def
+		case ctrlC:
+			return false, ErrInterrupt
+		case ctrlD:
+			return false, io.EOF
+		case esc:
+			// Ignore special keys e.g. arrow keys.
+			if _, err := e.readEscape(ctx); err != nil {
+				return false, err
+			}
+			continue
+		default:
+			if err := e.beep(); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		e.Buffer = []rune("n")
+		if ok {
+			e.Buffer = []rune("y")
+		}
+		e.Pos = len(e.Buffer)
+		if err := e.refreshLine(); err != nil {
+			return false, err
+		}
+		return ok, e.moveToBottom()
+	}
+}
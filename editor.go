@@ -4,11 +4,15 @@ package linesqueak
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 // Editor interacts with VT100 like terminals via io.Reader & io.Writer and displays an input line.
@@ -21,11 +25,40 @@ type Editor struct {
 	// Out displays current editor states to the terminal.
 	Out *bufio.Writer
 
+	// Conn is the connection behind In e.g. net.Conn.
+	// If it's provided, Editor sets a read deadline on every read so that context cancellation and IdleTimeout
+	// interrupt the blocking read itself instead of leaving a goroutine reading In in the background.
+	// If it fails to set a deadline e.g. the connection doesn't support deadlines, Editor falls back to the goroutine.
+	// Conn is OPTIONAL.
+	Conn ReadDeadliner
+
 	// Prompt is prepended to each editor state on the terminal.
 	// Prompt is not part of user inputs but part of UI. so it doesn't appear in result input lines.
 	Prompt string
 
+	// PromptFunc is called on every refresh to get the prompt so that it can change dynamically
+	// e.g. to show the current directory.
+	// PromptFunc is OPTIONAL. If no PromptFunc is provided, Prompt is used.
+	// Prompts may contain escape sequences for colors. They don't count as width.
+	PromptFunc func() string
+
+	// ContinuationPrompt is prepended to each line following a newline in Buffer.
+	// A newline can be inserted with Alt-Enter.
+	ContinuationPrompt string
+
+	// ContinuationPromptFunc is called on every refresh to get the prompt for each line following a newline in Buffer.
+	// line is the line number counting from 1 so that the second line is 2 e.g. to display "  2> ".
+	// ContinuationPromptFunc is OPTIONAL. If no ContinuationPromptFunc is provided, ContinuationPrompt is used.
+	// Like Prompt, it may contain escape sequences for colors. They don't count as width.
+	ContinuationPromptFunc func(line int) string
+
+	// LineNumbers displays the line numbers on the left of ContinuationPrompt for each line following a newline.
+	// By default, lines aren't numbered.
+	LineNumbers LineNumbers
+
 	// Buffer keeps the current user input.
+	// Insertions grow it in place, so a key stroke in the middle of a long line costs a copy of the runes after
+	// the cursor, which is dwarfed by redrawing the line anyway.
 	Buffer []rune
 
 	// Pos points the current cursor position in Buffer.
@@ -37,217 +70,740 @@ type Editor struct {
 
 	// Rows is the terminal height.
 	// If it's not provided, Editor assumes it's 24.
+	// Use Resize to change Cols and Rows while Line is running.
 	Rows int
 
 	// History holds previous input lines so that user can reuse or tweak it later.
-	// It is your task to add lines to History, save History, or load it from disks.
+	// It is your task to add lines to History. It can be saved and loaded with SaveFile and LoadFile.
 	History History
 
+	// SharedHistory is History shared with other Editors e.g. to share History among SSH sessions.
+	// If it's provided, History is replaced with its snapshot every time user starts going through History
+	// so that entries added by other Editors appear. Add input lines to SharedHistory instead of History.
+	// SharedHistory is OPTIONAL.
+	SharedHistory *SharedHistory
+
+	// AcceptHistory decides if an input line is added to History by AddHistory e.g. to keep passwords out of History.
+	// AcceptHistory is OPTIONAL. If no AcceptHistory is provided, every line is added. See HistoryIgnore.
+	AcceptHistory func(l string) bool
+
+	// HistoryPrefixSearch makes Up/Down recall only History entries which start with the text before the cursor
+	// while Buffer is not empty, like history-beginning-search of zsh. The cursor stays where it is.
+	// If Buffer is empty, Up/Down go through all the entries as usual.
+	HistoryPrefixSearch bool
+
+	// OnKey will be called with every key stroke before Editor handles it
+	// so that you can implement your own key bindings e.g. F5 to refresh a dashboard.
+	// If it returns true, Editor considers the key stroke handled and ignores it.
+	// OnKey can call Write to print something above the editor region.
+	// Key strokes which are read as a part of multi-key commands e.g. Ctrl-X Ctrl-U are not passed to OnKey.
+	// OnKey is OPTIONAL.
+	OnKey func(k KeyEvent) (handled bool)
+
+	// BeforeAction will be called before Editor performs an editing action bound to a key stroke.
+	// If it returns false, the action is vetoed and the key stroke is ignored
+	// so that you can implement modes e.g. a read-only prompt which allows only cursor movements.
+	// BeforeAction is OPTIONAL.
+	BeforeAction func(a Action) bool
+
+	// AfterAction will be called after Editor performed an editing action successfully e.g. to collect metrics.
+	// AfterAction is OPTIONAL.
+	AfterAction func(a Action)
+
+	// AutoClose inserts the closing character when user types an opening one i.e. (, [, {, " or '
+	// and moves the cursor over the closing character when user types it right before the one already there.
+	AutoClose bool
+
+	// AutoCloseFilter tells if the opening character r typed at pos in s should be closed by AutoClose
+	// e.g. false inside strings of your language. If it's nil, characters aren't closed inside quotes.
+	// AutoCloseFilter is OPTIONAL.
+	AutoCloseFilter func(s string, pos int, r rune) bool
+
+	// AutoIndent indents the line inserted by Enter with incomplete input or Alt-Enter
+	// with the leading whitespaces of the line above.
+	AutoIndent bool
+
+	// Indent returns the indentation of the line inserted at pos in s e.g. one more level after a block opener.
+	// It takes precedence over AutoIndent.
+	// Indent is OPTIONAL.
+	Indent func(s string, pos int) string
+
+	// CommentBegin is inserted at the beginning of each line of the user input by Alt-#.
+	// CommentBegin is OPTIONAL. If it's empty, "#" is used.
+	CommentBegin string
+
+	// EscapeTimeout is the time to wait for the following character after ESC.
+	// If nothing follows in time, it's Esc by itself which can be bound by Keymap or handled by OnKey
+	// e.g. to cancel the input. Otherwise, ESC always starts an escape sequence or Meta with a key.
+	// EscapeTimeout is OPTIONAL.
+	EscapeTimeout time.Duration
+
+	// Keymap binds key strokes to actions or commands. Its bindings take precedence over the default ones.
+	// Multi-key bindings can be defined by nested keymaps e.g. Keymap{KeyCtrlX: {Keymap: Keymap{KeyCtrlS: {Command: "save"}}}}.
+	// Keymap is OPTIONAL.
+	Keymap Keymap
+
+	// KeymapTimeout is the time to wait for the following key stroke of a multi-key binding e.g. Ctrl-X Ctrl-E.
+	// If it passes, the multi-key binding is cancelled. If it's 0, Editor waits indefinitely.
+	KeymapTimeout time.Duration
+
+	// Commands are named commands defined by application in addition to the actions e.g. "insert-date".
+	// They can be performed by DoCommand. See ActionByName for the names of the actions.
+	// Commands is OPTIONAL.
+	Commands map[string]Command
+
+	// OnUnknownSequence will be called with escape sequences which Editor doesn't recognize
+	// e.g. special keys of exotic terminals or unsolicited reports so that you can log or handle them.
+	// Such sequences are read entirely and never inserted into Buffer.
+	// OnUnknownSequence is OPTIONAL.
+	OnUnknownSequence func(seq string)
+
 	// Complete will be called when user wants you to complete their inputs.
 	// It takes the current user input and returns some completion suggestions.
-	// Complete is OPTIONAL. If no Complete is provided, completion will be disabled.
+	// Complete is OPTIONAL. If no Complete is provided, completion will be disabled unless CompleteFromHistory is on.
 	Complete func(s string) []string
 
+	// CompleteCandidates is like Complete but returns suggestions with descriptions.
+	// If both are provided, CompleteCandidates takes precedence.
+	CompleteCandidates func(s string) []Candidate
+
+	// CompleteAt is like CompleteCandidates but also receives the cursor position in runes and can fail.
+	// If it returns an error, the error is displayed below the user input until the next key stroke
+	// so that user can tell a failure e.g. an unreachable backend from no suggestions.
+	// If provided, CompleteAt takes precedence over CompleteCandidates and Complete.
+	CompleteAt func(s string, pos int) ([]Candidate, error)
+
+	// CompleteContext is like CompleteCandidates but called in a separate goroutine
+	// so that it can take time e.g. querying a database or calling a remote procedure.
+	// While it's running, an indicator is displayed and user can keep typing.
+	// In that case, ctx will be cancelled and the suggestions will be discarded.
+	// If provided, CompleteContext takes precedence over CompleteAt, CompleteCandidates and Complete.
+	CompleteContext func(ctx context.Context, s string) []Candidate
+
+	// CompleteFromHistory completes the user input with History entries which start with it
+	// if none of Complete, CompleteCandidates, CompleteAt and CompleteContext is provided.
+	CompleteFromHistory bool
+
+	// CompleteFilter decides if a completion suggestion is presented e.g. to hide deprecated commands.
+	// CompleteFilter is OPTIONAL. If no CompleteFilter is provided, all the suggestions are presented.
+	CompleteFilter func(c Candidate) bool
+
+	// CompleteSort reports whether a should be presented before b e.g. to rank suggestions by frequency.
+	// CompleteSort is OPTIONAL. If no CompleteSort is provided, suggestions are presented in the order they're returned.
+	CompleteSort func(a, b Candidate) bool
+
+	// CompletionMode decides how completion suggestions are presented.
+	// By default, Tab cycles through the suggestions.
+	// Regardless of CompletionMode, Meta-? lists all the suggestions in columns below the user input.
+	CompletionMode CompletionMode
+
+	// CompletionKeys changes the keys which go through completion suggestions in CompletionCycle.
+	// By default, Tab and Shift-Tab go forward and backward, and Esc cancels.
+	CompletionKeys CompletionKeys
+
+	// CompletionQueryItems is the number of completion suggestions above which user is asked
+	// "Display all N possibilities? (y or n)" before they're listed.
+	// By default, user is never asked. Suggestions which don't fit in the terminal are paged with "--More--" anyway.
+	CompletionQueryItems int
+
 	// Hint will be called while user is typing and displayed on the right of the user input.
 	// Hint is OPTIONAL. If no Hint is provided, no hint will be shown.
 	Hint func(s string) *Hint
 
+	// HintContext is like Hint but receives ctx passed to LineContext so that it can respect cancellation
+	// e.g. when it queries a remote service. If HintDelay is positive, ctx is also cancelled as soon as user types.
+	// If provided, HintContext takes precedence over Hint.
+	HintContext func(ctx context.Context, s string) *Hint
+
+	// HintBelow displays every hint on the row beneath the user input. See Hint.Below.
+	HintBelow bool
+
+	// HintTruncate truncates a hint which doesn't fit in the rest of the row with an ellipsis
+	// so that it doesn't wrap and increase the height of the editor region.
+	// By default, a long hint wraps to the following rows.
+	HintTruncate bool
+
+	// Indicator displays the cursor position or the length of the user input on the row beneath the user input
+	// e.g. "col 12/80" so that user can keep lines within the limit of line-oriented protocols.
+	// By default, nothing is displayed.
+	Indicator Indicator
+
+	// HintDelay makes Hint asynchronous.
+	// If it's positive, Hint is called in a separate goroutine once user stops typing for HintDelay
+	// so that expensive hints don't slow down every key stroke.
+	// By default, Hint is called synchronously on every change.
+	HintDelay time.Duration
+
+	// Validate will be called when user presses Enter to check if the input line is ready to be returned.
+	// If it returns ErrIncomplete, a newline will be inserted so that user can continue on the next line.
+	// If it returns other errors, the error will be displayed below the user input.
+	// Validate is OPTIONAL. If no Validate is provided, Enter always confirms the input line.
+	// ValidateShell is available for shell-like input.
+	Validate func(s string) error
+
+	// OnAccept will be called with the user input when user presses Enter after Validate accepted it.
+	// The user input is replaced with the result e.g. trimmed or with aliases expanded before it's returned by Line
+	// and added to History by Run. If it returns an error, the error will be displayed below the user input.
+	// OnAccept is OPTIONAL.
+	OnAccept func(s string) (string, error)
+
+	// InterruptMode decides what Ctrl-C does. By default, Line returns ErrInterrupt.
+	InterruptMode InterruptMode
+
+	// OnInterrupt will be called with the current user input when user presses Ctrl-C.
+	// If it returns an error, Line returns the error. Otherwise, the user input is cleared and editing continues.
+	// OnInterrupt is OPTIONAL. If provided, it takes precedence over InterruptMode.
+	OnInterrupt func(s string) error
+
+	// IgnoreEOF makes Ctrl-D on an empty line beep instead of returning io.EOF like ignoreeof of bash.
+	IgnoreEOF bool
+
+	// IdleTimeout makes Line return ErrIdleTimeout if user doesn't type anything for IdleTimeout
+	// so that servers can reap abandoned sessions. The user input is kept in Buffer.
+	// By default, Line waits for key strokes forever.
+	IdleTimeout time.Duration
+
+	// Suspend will be called when user presses Ctrl-Z so that you can implement job control
+	// e.g. suspend the process behind the session. The terminal modes turned on by Line are turned off while it's running
+	// and the editor states are redrawn after it returns. If it returns an error, Line returns the error.
+	// Suspend is OPTIONAL. If no Suspend is provided, Ctrl-Z beeps.
+	Suspend func() error
+
+	// UniversalArgument makes Ctrl-U start a numeric argument like Emacs instead of killing the line.
+	// Ctrl-U alone repeats the next command 4 times, and each following Ctrl-U multiplies it by 4.
+	// Digits following Ctrl-U specify the count. Regardless of UniversalArgument, Meta-digits start a numeric argument.
+	UniversalArgument bool
+
+	// ExternalEditor will be called with the user input when user presses Ctrl-X Ctrl-E
+	// so that user can edit it with a full-fledged editor e.g. $EDITOR on the host or a web based one.
+	// The user input is replaced with the result and the editor states are redrawn.
+	// If it returns an error, the error will be displayed below the user input which is left as it is.
+	// ExternalEditor is OPTIONAL. If no ExternalEditor is provided, Ctrl-X Ctrl-E beeps.
+	ExternalEditor func(s string) (string, error)
+
+	// BracketedPaste enables bracketed paste mode of the terminal while Line is running
+	// so that pasted text is inserted as it is instead of being interpreted as key strokes.
+	BracketedPaste bool
+
+	// OnPaste will be called with pasted text when BracketedPaste is enabled.
+	// It returns the text to be inserted e.g. without newlines. If it returns "", nothing will be inserted.
+	// OnPaste is OPTIONAL. If no OnPaste is provided, pasted text is inserted as it is.
+	OnPaste func(s string) string
+
+	// Mask is displayed in place of each character of the user input e.g. '*' so that passwords aren't revealed.
+	// Mask is OPTIONAL. By default, the user input is displayed as it is. See ReadPassword.
+	Mask rune
+
+	// Clipboard enables copying to the clipboard of the terminal via OSC 52.
+	// If it's enabled, killed text is copied and Alt-w copies the whole user input.
+	// Note that some terminals don't support OSC 52 or need to be configured to allow it.
+	Clipboard bool
+
+	// Mouse enables mouse reporting of the terminal while Line is running.
+	// If it's enabled, clicking on the user input moves the cursor there and the wheel goes through History.
+	// Terminals which don't support mouse reporting simply ignore it.
+	Mouse bool
+
+	// SynchronizedOutput wraps every redraw in synchronized output mode (DEC private mode 2026)
+	// so that multi-row redraws appear atomically without flicker.
+	// Terminals which don't support it simply ignore it.
+	SynchronizedOutput bool
+
+	// HorizontalScroll makes the user input never wrap. Instead, it scrolls horizontally
+	// so that the cursor is always visible in a single row like linenoise without multiline mode.
+	// If Buffer has newlines, only the line with the cursor is displayed.
+	HorizontalScroll bool
+
+	// ScrollEllipsis displays … at the ends of the line cut off by HorizontalScroll
+	// so that user can tell there's more to the line.
+	ScrollEllipsis bool
+
+	// TabWidth is the distance between tab stops.
+	// If it's not provided, Editor assumes it's 8.
+	TabWidth int
+
+	// ShowTabs displays tabs as » followed by spaces so that they're distinguishable from spaces.
+	ShowTabs bool
+
+	// ShowWhitespace displays spaces and tabs with faint markers e.g. · and » so that invisible characters stand out.
+	// By default, they're displayed as they are.
+	ShowWhitespace Whitespace
+
+	// RefreshInterval limits how often the editor states are redrawn while input keeps arriving
+	// e.g. a client blasting bytes so that it can't pin a CPU core re-rendering.
+	// Redraws for typing and cursor motions are skipped while more input is pending if the last redraw was within
+	// RefreshInterval, and the editor states are redrawn once the pending input is processed.
+	// By default, Editor redraws on every key stroke.
+	RefreshInterval time.Duration
+
+	// Style decides the appearance of the prompt, hints, etc. so that you can brand your console.
+	// By default, they're displayed as they are.
+	Style Style
+
+	// NoColor strips all the colors and text attributes e.g. bold and reverse video from the output
+	// including prompts, hints and Write while the layout stays the same. See https://no-color.org/
+	NoColor bool
+
+	// Profile describes the capabilities of the terminal e.g. TermProfileFor(term) where term is TERM of the client.
+	// Features the terminal lacks are turned off or replaced with simpler ones
+	// e.g. BracketedPaste and SynchronizedOutput are ignored and hints are displayed without colors.
+	// Profile is OPTIONAL. If no Profile is provided, Editor assumes the terminal supports everything.
+	Profile *TermProfile
+
+	// Bell decides how Editor alerts user e.g. when the cursor can't move any further or there's no completion.
+	// By default, it rings the terminal bell.
+	Bell Bell
+
+	// InvalidUTF8 decides what to do with invalid UTF-8 from the terminal.
+	// By default, invalid bytes are replaced with U+FFFD.
+	InvalidUTF8 InvalidUTF8Policy
+
 	// Width calculates character width on the terminal.
+	// Control characters in Buffer are displayed in caret notation e.g. ^C and tabs are expanded to the next tab stop
+	// regardless of Width.
 	// A lot of CJK characters and emojis are twice as wide as ASCII characters.
-	// Width is OPTIONAL. By default,
-	// it calculates the character width as 1 for all characters except tab which width is 4.
+	// Emoji sequences e.g. 👩‍💻 joined by ZWJ and ❤️ with VS16 are measured as a single emoji regardless of Width.
+	// Width is OPTIONAL. By default, it calculates the character width with RuneWidth or EastAsianRuneWidth.
 	Width func(rune) int
 
+	// Bidi returns the indices of a line in the order the characters are displayed e.g. BasicBidi
+	// so that right-to-left text e.g. Hebrew and Arabic reads correctly on terminals which display characters as they are.
+	// Each line of Buffer is reordered and the cursor is displayed on the character at Pos wherever it is on the row.
+	// Bidi is OPTIONAL. By default, characters are displayed in the order in Buffer.
+	// Leave it nil for terminals which reorder characters by themselves.
+	Bidi func(line []rune) []int
+
+	// AmbiguousWide makes East Asian Ambiguous characters e.g. Greek letters and ○ 2 columns wide.
+	// CJK terminal emulators often display them as wide characters and the cursor goes off if Editor guesses wrong.
+	// It's ignored if Width is provided.
+	AmbiguousWide bool
+
 	// OldPos points the previous cursor position in Buffer.
 	OldPos int
 
 	// MaxRows is the height of editor status on the terminal.
 	MaxRows int
+
+	mu      sync.Mutex // serializes Line with Resize and Write.
+	running bool       // Line or Feeder is editing an input line. Line holds mu except while it's waiting for key strokes.
+
+	undo, redo []snapshot
+	inserting  bool
+	insertEnd  int
+
+	runes  chan readResult
+	unread []readResult
+	feeder *Feeder // the Feeder which drives Editor if any.
+
+	mode   *mode             // the modal command which handles the following key strokes if any.
+	finish func(error) error // finishes the action which started mode once it's done.
+
+	count     int    // the numeric argument for the recorded command.
+	recording []rune // the key strokes of the command which is repeated by a numeric argument.
+	argPrompt string
+
+	searchPrompt string       // the prompt of incremental search while it's running.
+	lastSearch   string       // the query of the last incremental search.
+	highlights   []MatchRange // the parts of Buffer highlighted as matches.
+
+	lastAction     Action // the action performed last.
+	substringQuery string // the query of the repeated substring search.
+
+	cursorRow   int
+	message     string
+	prevMessage string // message displayed before the current key stroke.
+	exit        error  // the error which ends Line set by Do.
+	accepting   bool   // the user input is being redrawn for the last time.
+
+	hinted   bool
+	hintFor  string
+	lastHint *Hint
+
+	ctx context.Context // ctx passed to LineContext while Line is running.
+
+	question string // the prompt of Confirm while it's running.
+
+	spinner *Spinner // the spinner displayed by StartSpinner if any.
+	fresh   bool     // the cursor is at the beginning of a line below the last editor region.
+
+	closed bool // Close has been called.
+
+	historyEdits map[int]string // working copies of History entries edited during the current Line.
+
+	titleSaved bool
+
+	handedOver bool // the terminal is used by ExternalEditor or Suspend.
+
+	flashing bool // the prompt is flashed for BellVisible.
+	flashes  int  // the number of flashes so that only the timer of the last one ends flashing.
+
+	scroll int // the position of the first visible rune in HorizontalScroll mode.
+
+	refreshed time.Time // when the editor states were redrawn last time.
+	stale     bool      // the redraw has been skipped due to RefreshInterval.
+
+	top      int // the row of the top of the editor region on the screen.
+	topKnown bool
 }
 
+var (
+	// ErrIncomplete is returned by Validate to tell that the input line continues to the next line.
+	ErrIncomplete = errors.New("incomplete input")
+
+	// ErrInterrupt is returned by Line when user presses Ctrl-C.
+	// Line returns io.EOF when user presses Ctrl-D on an empty line.
+	// Other errors from In or Out are wrapped so that they can be checked with errors.Is.
+	ErrInterrupt = errors.New("interrupted")
+
+	// ErrIdleTimeout is returned by Line when user doesn't type anything for IdleTimeout.
+	ErrIdleTimeout = errors.New("idle timeout")
+)
+
 // Line reads user key strokes and returns a confirmed input line while displaying editor states on the terminal.
 func (e *Editor) Line() (string, error) {
-	if err := e.editReset(); err != nil {
-		return string(e.Buffer), err
+	return e.LineContext(context.Background())
+}
+
+// LineContext is like Line but returns ctx.Err() as soon as ctx is done
+// e.g. when the connection is torn down or the server is shutting down.
+// Key strokes which arrive after that are kept for the next call.
+func (e *Editor) LineContext(ctx context.Context) (string, error) {
+	return e.LineContextWithDefault(ctx, "")
+}
+
+// LineWithDefault is like Line but starts with initial in Buffer and the cursor at the end of it
+// so that user can edit an existing value.
+func (e *Editor) LineWithDefault(initial string) (string, error) {
+	return e.LineContextWithDefault(context.Background(), initial)
+}
+
+// LineContextWithDefault is a combination of LineContext and LineWithDefault.
+func (e *Editor) LineContextWithDefault(ctx context.Context, initial string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return "", ErrClosed
+	}
+
+	if err := e.begin(ctx, initial); err != nil {
+		return e.end(err)
 	}
-line:
 	for {
-		r, _, err := e.In.ReadRune()
+		if err := e.step(ctx); err != nil {
+			return e.end(err)
+		}
+	}
+}
+
+// begin starts editing a new input line. It turns on terminal modes required while Line is running.
+func (e *Editor) begin(ctx context.Context, initial string) error {
+	e.running = true
+
+	if on, _ := e.modes(); on != "" {
+		if _, err := e.Out.WriteString(on); err != nil {
+			return ioError("write", err)
+		}
+	}
+
+	e.ctx = ctx
+	e.fresh = false
+	e.MaxRows = 0
+	e.cursorRow = 0
+	e.topKnown = false
+	e.hinted = false
+	e.historyEdits = nil
+	e.exit = nil
+	e.lastAction = ActionNone
+	e.undo, e.redo = nil, nil
+	e.mode, e.finish = nil, nil
+	e.count, e.recording = 0, nil
+	e.scroll = 0
+	e.init()
+	e.Buffer = []rune(initial)
+	e.OldPos = 0
+	e.Pos = len(e.Buffer)
+	return e.refreshLine()
+}
+
+// step reads a key stroke and handles it. It returns errAccept if the input line is done.
+func (e *Editor) step(ctx context.Context) error {
+	if e.mode != nil {
+		if err := e.stepMode(ctx); err != nil {
+			return err
+		}
+	} else {
+		if len(e.recording) > 0 {
+			e.replay()
+		}
+
+		k, err := e.readKey(ctx)
 		if err != nil {
-			return string(e.Buffer), err
+			return err
 		}
 
-		switch r {
-		case enter:
-			break line
-		case ctrlC:
-			return string(e.Buffer), errors.New("try again")
-		case backspace, ctrlH:
-			if err := e.editBackspace(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlD:
-			if len(e.Buffer) == 0 {
-				return string(e.Buffer), io.EOF
-			}
+		e.prevMessage = e.message
+		e.message = ""
 
-			if err := e.editDelete(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlT:
-			if err := e.editSwap(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlB:
-			if err := e.editMoveLeft(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlF:
-			if err := e.editMoveRight(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlP:
-			if err := e.editHistoryPrev(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlN:
-			if err := e.editHistoryNext(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlU:
-			if err := e.editReset(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlK:
-			if err := e.editKillForward(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlA:
-			if err := e.editMoveHome(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlE:
-			if err := e.editMoveEnd(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlL:
-			if err := e.clearScreen(); err != nil {
-				return string(e.Buffer), err
-			}
+		var handled bool
+		if e.OnKey != nil && !k.internal() {
+			e.unlocked(func() {
+				handled = e.OnKey(k)
+			})
+		}
 
-			if err := e.refreshLine(); err != nil {
-				return string(e.Buffer), err
-			}
-		case ctrlW:
-			if err := e.editDeletePrevWord(); err != nil {
-				return string(e.Buffer), err
-			}
-		case esc:
-			r, _, err := e.In.ReadRune()
-			if err != nil {
-				return string(e.Buffer), err
+		if !handled {
+			if err := e.dispatch(ctx, k); err != nil {
+				return err
 			}
+		}
+	}
 
-			switch r {
-			case '[':
-				r, _, err := e.In.ReadRune()
-				if err != nil {
-					return string(e.Buffer), err
-				}
+	// Do or a command may have performed an action which ends Line.
+	err := e.exit
+	e.exit = nil
+	return err
+}
 
-				switch r {
-				case '0', '1', '2', '4', '5', '6', '7', '8', '9':
-					_, _, err := e.In.ReadRune()
-					if err != nil {
-						return string(e.Buffer), err
-					}
-				case '3':
-					r, _, err := e.In.ReadRune()
-					if err != nil {
-						return string(e.Buffer), err
-					}
-
-					switch r {
-					case '~':
-						if err := e.editDelete(); err != nil {
-							return string(e.Buffer), err
-						}
-					}
-				case 'A':
-					if err := e.editHistoryPrev(); err != nil {
-						return string(e.Buffer), err
-					}
-				case 'B':
-					if err := e.editHistoryNext(); err != nil {
-						return string(e.Buffer), err
-					}
-				case 'C':
-					if err := e.editMoveRight(); err != nil {
-						return string(e.Buffer), err
-					}
-				case 'D':
-					if err := e.editMoveLeft(); err != nil {
-						return string(e.Buffer), err
-					}
-				case 'H':
-					if err := e.editMoveHome(); err != nil {
-						return string(e.Buffer), err
-					}
-				case 'F':
-					if err := e.editMoveEnd(); err != nil {
-						return string(e.Buffer), err
-					}
-				}
-			case 'O':
-				r, _, err := e.In.ReadRune()
-				if err != nil {
-					return string(e.Buffer), err
-				}
+// end finishes the input line ended by err and returns the user input.
+// It turns off the terminal modes turned on by begin.
+func (e *Editor) end(err error) (string, error) {
+	if e.mode != nil || e.finish != nil {
+		err = e.endMode(err)
+	}
+	if errors.Is(err, errAccept) {
+		err = nil
+	}
+	l := string(e.Buffer)
 
-				switch r {
-				case 'H':
-					if err := e.editMoveHome(); err != nil {
-						return string(e.Buffer), err
-					}
-				case 'F':
-					if err := e.editMoveEnd(); err != nil {
-						return string(e.Buffer), err
-					}
-				}
-			}
-		case tab:
-			if err := e.completeLine(); err != nil {
-				return string(e.Buffer), err
-			}
-		default:
-			if err := e.editInsert(r); err != nil {
-				return string(e.Buffer), err
-			}
+	e.ctx = nil
+	if on, off := e.modes(); on != "" && !e.closed {
+		// Close has already turned off the modes otherwise.
+		if _, werr := e.Out.WriteString(off); werr != nil && err == nil {
+			err = ioError("write", werr)
+		}
+		if werr := e.Out.Flush(); werr != nil && err == nil {
+			err = ioError("write", werr)
+		}
+	}
+	e.running = false
+
+	if e.closed {
+		return l, err
+	}
+
+	if werr := e.leaveSpinner(); werr != nil && err == nil {
+		err = werr
+	}
+
+	return l, err
+}
+
+// modes returns escape sequences to turn on and off terminal modes required while Line is running.
+func (e *Editor) modes() (string, string) {
+	var on, off string
+	if e.BracketedPaste && e.profile().BracketedPaste {
+		on += bracketedPasteOn
+		off = bracketedPasteOff + off
+	}
+	if e.Mouse {
+		// The cursor position tells where the editor region is on the screen.
+		on += mouseOn + cursorPositionRequest
+		off = mouseOff + off
+	}
+	return on, off
+}
+
+// suspend handles Ctrl-Z.
+func (e *Editor) suspend() error {
+	if e.Suspend == nil {
+		return e.beep()
+	}
+
+	if err := e.handOver(e.Suspend); err != nil {
+		return err
+	}
+	return e.refreshLine()
+}
+
+// editExternal hands the user input to ExternalEditor and replaces it with the result.
+func (e *Editor) editExternal() error {
+	if e.ExternalEditor == nil {
+		return e.beep()
+	}
+
+	var s string
+	b := string(e.Buffer)
+	if err := e.handOver(func() error {
+		var err error
+		s, err = e.ExternalEditor(b)
+		return err
+	}); err != nil {
+		return e.showMessage(err.Error())
+	}
+
+	e.saveUndo()
+	e.Buffer = []rune(s)
+	e.Pos = len(e.Buffer)
+	return e.refreshLine()
+}
+
+// handOver lets f use the terminal. The terminal modes turned on by Line are turned off while f is running.
+// f is called without holding mu so that it can write to Editor.
+// Since the screen may have been changed, the editor states have to be redrawn afterwards.
+func (e *Editor) handOver(f func() error) error {
+	if err := e.moveToBottom(); err != nil {
+		return err
+	}
+
+	on, off := e.modes()
+	if _, err := e.Out.WriteString("\r\n" + off); err != nil {
+		return ioError("write", err)
+	}
+	if err := e.Out.Flush(); err != nil {
+		return ioError("write", err)
+	}
+
+	e.MaxRows = 0
+	e.cursorRow = 0
+	e.topKnown = false
+
+	var err error
+	e.handedOver = true
+	e.unlocked(func() {
+		err = f()
+	})
+	e.handedOver = false
+
+	if _, err := e.Out.WriteString(on); err != nil {
+		return ioError("write", err)
+	}
+
+	return err
+}
+
+// InterruptMode represents what Ctrl-C does.
+type InterruptMode int
+
+const (
+	// InterruptReturn makes Line return ErrInterrupt.
+	InterruptReturn InterruptMode = iota
+
+	// InterruptClear clears the user input and continues editing.
+	InterruptClear
+)
+
+// interrupt handles Ctrl-C. It returns an error if Line should return.
+func (e *Editor) interrupt() error {
+	if e.OnInterrupt != nil {
+		var err error
+		s := string(e.Buffer)
+		e.unlocked(func() {
+			err = e.OnInterrupt(s)
+		})
+		if err != nil {
+			return err
 		}
+		return e.editReset()
+	}
+
+	if e.InterruptMode == InterruptClear {
+		return e.editReset()
 	}
 
-	return string(e.Buffer), nil
+	return ErrInterrupt
+}
+
+// unknownSequence passes an escape sequence which Editor doesn't know to OnUnknownSequence.
+func (e *Editor) unknownSequence(seq string) error {
+	if e.OnUnknownSequence != nil {
+		e.OnUnknownSequence(seq)
+	}
+	return nil
 }
 
 var curPosPattern = regexp.MustCompile("\x1b\\[(\\d+);(\\d+)R")
 
+// Resize updates Cols and Rows and redraws the editor states if Line is running.
+// It's safe to call from another goroutine e.g. a handler of window-change requests of SSH.
+func (e *Editor) Resize(cols, rows int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.Cols, e.Rows = cols, rows
+	if !e.running || e.handedOver {
+		return nil
+	}
+
+	// The rows above the top of the screen are gone and the screen position of the editor region is unknown.
+	if rows > 0 && e.MaxRows > rows-1 {
+		e.MaxRows = rows - 1
+	}
+	if e.cursorRow > e.MaxRows {
+		e.cursorRow = e.MaxRows
+	}
+	e.topKnown = false
+
+	return e.refreshLine()
+}
+
+// Refresh redraws the editor states in place so that changes to Prompt, Buffer, Pos, etc. made by the application
+// appear on the terminal. It's safe to call from another goroutine while Line is running.
+// To print something while Line is running, use Write instead which redraws the editor states below the output.
+func (e *Editor) Refresh() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	e.init()
+	if e.Pos < 0 {
+		e.Pos = 0
+	}
+	if e.Pos > len(e.Buffer) {
+		e.Pos = len(e.Buffer)
+	}
+	return e.redraw()
+}
+
+// unlocked calls f without holding mu while Line is waiting for key strokes or OnKey
+// so that Resize and Write don't have to wait. f must not touch the editor states without locking mu.
+func (e *Editor) unlocked(f func()) {
+	if !e.running {
+		f()
+		return
+	}
+	e.mu.Unlock()
+	defer e.mu.Lock()
+	f()
+}
+
 // Adjust queries the terminal about rows and cols and updates Editor's Rows and Cols.
 func (e *Editor) Adjust() error {
 	// https://groups.google.com/forum/#!topic/comp.os.vms/bDKSY6nG13k
 	if _, err := e.Out.WriteString("\x1b7\x1b[999;999H\x1b[6n"); err != nil {
-		return err
+		return ioError("write", err)
 	}
 
 	if err := e.Out.Flush(); err != nil {
-		return err
+		return ioError("write", err)
 	}
 
-	res, err := e.In.ReadString('R')
-	if err != nil {
-		return err
+	var res []rune
+	for len(res) == 0 || res[len(res)-1] != 'R' {
+		r, err := e.readRune(context.Background())
+		if err != nil {
+			return err
+		}
+		res = append(res, r)
 	}
 
-	ms := curPosPattern.FindStringSubmatch(res)
+	ms := curPosPattern.FindStringSubmatch(string(res))
+	if ms == nil {
+		return fmt.Errorf("unexpected cursor position report: %q", string(res))
+	}
 	r, err := strconv.Atoi(ms[1])
 	if err != nil {
 		return err
@@ -258,7 +814,7 @@ func (e *Editor) Adjust() error {
 	}
 
 	if _, err := e.Out.WriteString("\x1b8"); err != nil {
-		return err
+		return ioError("write", err)
 	}
 
 	e.Cols = c
@@ -267,24 +823,122 @@ func (e *Editor) Adjust() error {
 	return nil
 }
 
+// Write prints b above the editor region and redraws the editor states below it
+// so that asynchronous output e.g. chat messages or logs doesn't mess up the user input.
+// A newline is appended if b doesn't end with one so that the output isn't overwritten by the prompt.
+// It's safe to call from another goroutine while Line is running as well as from OnKey.
 func (e *Editor) Write(b []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return 0, ErrClosed
+	}
+
 	e.init()
-	ew := errWriter{w:e.Out}
-	ew.writeString("\r\x1b[0K")
-	ew.write(bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1))
+	ew := errWriter{w: e.Out}
+	if e.SynchronizedOutput && e.profile().SynchronizedOutput {
+		// It'll be turned off at the end of the following refresh.
+		ew.writeString(synchronizedOutputOn)
+	}
+	if e.cursorRow > 0 {
+		ew.writeString(fmt.Sprintf("\x1b[%dA", e.cursorRow))
+	}
+	if e.MaxRows > 0 {
+		ew.writeString("\r\x1b[0J") // clear the whole editor region
+	} else {
+		ew.writeString("\r\x1b[0K")
+	}
+	ew.writeString(e.uncolor(string(bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1))))
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		ew.writeString("\r\n")
+	}
+	if e.Mouse {
+		// The editor region has moved.
+		ew.writeString(cursorPositionRequest)
+		e.topKnown = false
+	}
 	ew.flush()
 	if ew.err != nil {
 		return 0, ew.err
 	}
-	return len(b), e.refreshLine()
+	e.MaxRows = 0
+	e.cursorRow = 0
+	e.fresh = true
+	return len(b), e.redraw()
+}
+
+// Undo reverts the last change made to Buffer and Pos.
+func (e *Editor) Undo() error {
+	if len(e.undo) == 0 {
+		return e.beep()
+	}
+
+	e.redo = append(e.redo, e.snapshot())
+	e.restore(e.undo[len(e.undo)-1])
+	e.undo = e.undo[:len(e.undo)-1]
+	return e.refreshLine()
+}
+
+// Redo reapplies the last change reverted by Undo.
+func (e *Editor) Redo() error {
+	if len(e.redo) == 0 {
+		return e.beep()
+	}
+
+	e.undo = append(e.undo, e.snapshot())
+	e.restore(e.redo[len(e.redo)-1])
+	e.redo = e.redo[:len(e.redo)-1]
+	return e.refreshLine()
+}
+
+// snapshot is a copy of the editor state which Undo and Redo go back and forth.
+type snapshot struct {
+	buffer []rune
+	pos    int
+}
+
+func (e *Editor) snapshot() snapshot {
+	return snapshot{
+		buffer: append([]rune{}, e.Buffer...),
+		pos:    e.Pos,
+	}
+}
+
+func (e *Editor) restore(s snapshot) {
+	e.Buffer = append([]rune{}, s.buffer...)
+	e.Pos = s.pos
+	e.inserting = false
+}
+
+// saveUndo records the current state before a change so that Undo can revert it.
+func (e *Editor) saveUndo() {
+	e.undo = append(e.undo, e.snapshot())
+	e.redo = nil
+	e.inserting = false
+}
+
+// dropUndo discards the state saved by an action which didn't change anything after all
+// e.g. Ctrl-K at the end of the line so that Undo doesn't have to be pressed for nothing.
+// n and redo are the length of undo and redo before the action.
+func (e *Editor) dropUndo(n int, redo []snapshot) {
+	if len(e.undo) != n+1 {
+		return
+	}
+	s := e.undo[n]
+	if s.pos != e.Pos || string(s.buffer) != string(e.Buffer) {
+		return
+	}
+	e.undo = e.undo[:n]
+	e.redo = redo
 }
 
 func (e *Editor) editReset() error {
 	e.init()
+	e.saveUndo()
 	e.Buffer = []rune{}
 	e.OldPos = 0
 	e.Pos = 0
-	e.MaxRows = 0
 	return e.refreshLine()
 }
 
@@ -302,12 +956,16 @@ func (e *Editor) editBackspace() error {
 		return e.beep()
 	}
 
-	e.Pos--
+	e.saveUndo()
+
+	// An emoji sequence or a character with combining marks is deleted as a whole.
+	p := e.Pos
+	e.Pos = e.prevCluster(p)
 
 	// Delete https://github.com/golang/go/wiki/SliceTricks
-	e.Buffer = e.Buffer[:e.Pos+copy(e.Buffer[e.Pos:], e.Buffer[e.Pos+1:])]
+	e.Buffer = e.Buffer[:e.Pos+copy(e.Buffer[e.Pos:], e.Buffer[p:])]
 
-	return e.refreshLine()
+	return e.refreshEdit()
 }
 
 func (e *Editor) editDelete() error {
@@ -315,27 +973,30 @@ func (e *Editor) editDelete() error {
 		return e.beep()
 	}
 
+	e.saveUndo()
+
 	// Delete https://github.com/golang/go/wiki/SliceTricks
-	e.Buffer = e.Buffer[:e.Pos+copy(e.Buffer[e.Pos:], e.Buffer[e.Pos+1:])]
+	e.Buffer = e.Buffer[:e.Pos+copy(e.Buffer[e.Pos:], e.Buffer[e.nextCluster(e.Pos):])]
 
-	return e.refreshLine()
+	return e.refreshEdit()
 }
 
 func (e *Editor) editSwap() error {
 	p := e.Pos
-	if p == len(e.Buffer) {
-		p = len(e.Buffer) - 1
+	if p == len(e.Buffer) && p > 0 {
+		p = e.prevCluster(p)
 	}
 
 	if p == 0 {
 		return e.beep()
 	}
 
-	e.Buffer[p-1], e.Buffer[p] = e.Buffer[p], e.Buffer[p-1]
-
-	if e.Pos < len(e.Buffer) {
-		e.Pos++
-	}
+	// Swap the clusters before and at p.
+	s, t := e.prevCluster(p), e.nextCluster(p)
+	e.saveUndo()
+	swapped := append(append([]rune{}, e.Buffer[p:t]...), e.Buffer[s:p]...)
+	copy(e.Buffer[s:t], swapped)
+	e.Pos = t
 
 	return e.refreshLine()
 }
@@ -345,9 +1006,9 @@ func (e *Editor) editMoveLeft() error {
 		return e.beep()
 	}
 
-	e.Pos--
+	e.Pos = e.prevCluster(e.Pos)
 
-	return e.refreshLine()
+	return e.refreshEdit()
 }
 
 func (e *Editor) editMoveRight() error {
@@ -355,263 +1016,696 @@ func (e *Editor) editMoveRight() error {
 		return e.beep()
 	}
 
-	e.Pos++
+	e.Pos = e.nextCluster(e.Pos)
 
-	return e.refreshLine()
+	return e.refreshEdit()
 }
 
 func (e *Editor) editHistoryPrev() error {
-	e.History.Save(string(e.Buffer))
+	e.syncHistory()
+	e.leaveHistoryEntry()
 	if err := e.History.Prev(); err != nil {
 		return e.beep()
 	}
-	e.Buffer = []rune(e.History.Get())
+	e.saveUndo()
+	e.Buffer = []rune(e.historyEntry())
 	e.Pos = len(e.Buffer)
 	return e.refreshLine()
 }
 
 func (e *Editor) editHistoryNext() error {
+	e.leaveHistoryEntry()
 	if err := e.History.Next(); err != nil {
 		return e.beep()
 	}
-	e.Buffer = []rune(e.History.Get())
+	e.saveUndo()
+	e.Buffer = []rune(e.historyEntry())
 	e.Pos = len(e.Buffer)
 	return e.refreshLine()
 }
 
-func (e *Editor) editKillForward() error {
-	e.Buffer = e.Buffer[:e.Pos]
-	return e.refreshLine()
+// syncHistory takes a snapshot of SharedHistory unless user is already going through History.
+func (e *Editor) syncHistory() {
+	if e.SharedHistory == nil || e.History.Pos < len(e.History.Lines)-1 {
+		return
+	}
+	// Only the entries are synced so that MaxLen, Tag and Sanitize of the session are kept.
+	s := e.SharedHistory.Snapshot()
+	e.History.Lines, e.History.Pos, e.History.meta = s.Lines, s.Pos, s.meta
+	e.History.trim()
+	e.historyEdits = nil // the indices may have changed.
 }
 
-func (e *Editor) editMoveHome() error {
-	if e.Pos == 0 {
-		return e.beep()
+// AddHistory adds l to SharedHistory if it's provided or History otherwise unless AcceptHistory rejects it.
+func (e *Editor) AddHistory(l string) {
+	if e.AcceptHistory != nil && !e.AcceptHistory(l) {
+		return
 	}
 
-	e.Pos = 0
-	return e.refreshLine()
-}
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-func (e *Editor) editMoveEnd() error {
-	if e.Pos == len(e.Buffer) {
-		return e.beep()
+	if e.SharedHistory != nil {
+		// SharedHistory doesn't know Sanitize of the session.
+		if s := e.History.Sanitize; s != nil {
+			var ok bool
+			if l, ok = s(l); !ok {
+				return
+			}
+		}
+		e.SharedHistory.AddEntry(HistoryEntry{Line: l, Time: time.Now(), Tag: e.History.Tag})
+		return
 	}
 
-	e.Pos = len(e.Buffer)
-	return e.refreshLine()
+	e.History.Add(l)
 }
 
-func (e *Editor) editDeletePrevWord() error {
-	var w bool
-	var p int
-	for i := e.Pos - 1; i >= 0; i-- {
-		if e.Buffer[i] != space {
-			w = true // found a word to delete
-			continue
+// leaveHistoryEntry keeps the user input as a working copy of the current History entry
+// so that the edits are restored when user comes back to the entry during the current Line.
+// History entries themselves are left intact.
+func (e *Editor) leaveHistoryEntry() {
+	e.History.Save(string(e.Buffer))
+	if e.History.Pos >= len(e.History.Lines)-1 {
+		return
+	}
+	if s := string(e.Buffer); s != e.History.Get() {
+		if e.historyEdits == nil {
+			e.historyEdits = map[int]string{}
 		}
-
-		if !w {
-			continue
+		e.historyEdits[e.History.Pos] = s
+		return
+	}
+	delete(e.historyEdits, e.History.Pos)
+}
+
+// historyEntry returns the working copy of the current History entry if it's edited or the entry otherwise.
+func (e *Editor) historyEntry() string {
+	if s, ok := e.historyEdits[e.History.Pos]; ok {
+		return s
+	}
+	return e.History.Get()
+}
+
+// editHistorySearchPrev goes back to the previous History entry which starts with the text before the cursor.
+func (e *Editor) editHistorySearchPrev() error {
+	prefix := string(e.Buffer[:e.Pos])
+	e.syncHistory()
+	e.leaveHistoryEntry()
+	if err := e.History.PrevPrefix(prefix); err != nil {
+		return e.beep()
+	}
+	e.saveUndo()
+	e.Buffer = []rune(e.historyEntry())
+	return e.refreshLine()
+}
+
+// editHistorySearchNext goes forward to the next History entry which starts with the text before the cursor.
+func (e *Editor) editHistorySearchNext() error {
+	prefix := string(e.Buffer[:e.Pos])
+	e.leaveHistoryEntry()
+	if err := e.History.NextPrefix(prefix); err != nil {
+		return e.beep()
+	}
+	e.saveUndo()
+	e.Buffer = []rune(e.historyEntry())
+	if e.Pos > len(e.Buffer) {
+		e.Pos = len(e.Buffer)
+	}
+	return e.redraw()
+}
+
+// editHistorySubstring goes to the previous or next History entry which contains the text before the cursor.
+// The query is kept while it's repeated so that user can go through the matches. The cursor is placed after the match.
+func (e *Editor) editHistorySubstring(prev bool) error {
+	if e.lastAction != ActionHistorySubstringPrev && e.lastAction != ActionHistorySubstringNext {
+		e.substringQuery = string(e.Buffer[:e.Pos])
+	}
+	q := e.substringQuery
+
+	e.syncHistory()
+	e.leaveHistoryEntry()
+	f := e.History.NextSubstring
+	if prev {
+		f = e.History.PrevSubstring
+	}
+	if err := f(q); err != nil {
+		return e.beep()
+	}
+	e.saveUndo()
+	l := e.historyEntry()
+	e.Buffer = []rune(l)
+	e.Pos = len(e.Buffer)
+	if i := strings.Index(l, q); i >= 0 && q != "" {
+		e.Pos = len([]rune(l[:i+len(q)]))
+	}
+	return e.refreshLine()
+}
+
+// editMoveUp moves the cursor to the previous line in Buffer.
+// If the cursor is already on the first line, it goes back in History instead.
+func (e *Editor) editMoveUp() error {
+	s := e.lineStart(e.Pos)
+	if s == 0 {
+		if e.HistoryPrefixSearch && len(e.Buffer) > 0 {
+			return e.editHistorySearchPrev()
+		}
+		return e.editHistoryPrev()
+	}
+
+	e.Pos = e.posAtColumn(e.lineStart(s-1), e.column(s, e.Pos))
+	return e.refreshLine()
+}
+
+// editMoveDown moves the cursor to the next line in Buffer.
+// If the cursor is already on the last line, it goes forward in History instead.
+func (e *Editor) editMoveDown() error {
+	end := e.lineEnd(e.Pos)
+	if end == len(e.Buffer) {
+		if e.HistoryPrefixSearch && len(e.Buffer) > 0 {
+			return e.editHistorySearchNext()
 		}
+		return e.editHistoryNext()
+	}
+
+	e.Pos = e.posAtColumn(end+1, e.column(e.lineStart(e.Pos), e.Pos))
+	return e.refreshLine()
+}
 
-		p = i + 1
-		break
+// lineStart returns the position of the beginning of the line which contains p.
+func (e *Editor) lineStart(p int) int {
+	for p > 0 && e.Buffer[p-1] != '\n' {
+		p--
 	}
+	return p
+}
+
+// lineEnd returns the position of the end of the line which contains p.
+func (e *Editor) lineEnd(p int) int {
+	for p < len(e.Buffer) && e.Buffer[p] != '\n' {
+		p++
+	}
+	return p
+}
+
+// column returns the width of Buffer between start and p.
+func (e *Editor) column(start, p int) int {
+	f := e.width()
+	var c int
+	for _, r := range e.Buffer[start:p] {
+		if r == tab {
+			c = e.tabStop(c)
+			continue
+		}
+		c += f(r)
+	}
+	return c
+}
 
-	e.Buffer = e.Buffer[:p]
+// posAtColumn returns the position in the line beginning at start which is closest to the column c.
+func (e *Editor) posAtColumn(start, c int) int {
+	f := e.width()
+	p := start
+	var col int
+	for p < len(e.Buffer) && e.Buffer[p] != '\n' {
+		// The cursor doesn't land inside a cluster e.g. on VS16.
+		q := e.nextCluster(p)
+		var w int
+		for _, r := range e.Buffer[p:q] {
+			w += f(r)
+		}
+		if e.Buffer[p] == tab {
+			w = e.tabStop(col) - col
+		}
+		col += w
+		if c < w {
+			break
+		}
+		c -= w
+		p = q
+	}
+	return p
+}
+
+func (e *Editor) editKillForward() error {
+	if err := e.kill(e.Buffer[e.Pos:]); err != nil {
+		return err
+	}
+
+	e.saveUndo()
+	e.Buffer = e.Buffer[:e.Pos]
+	return e.refreshLine()
+}
+
+func (e *Editor) editMoveHome() error {
+	if e.Pos == 0 {
+		return e.beep()
+	}
+
+	e.Pos = 0
+	return e.refreshEdit()
+}
+
+func (e *Editor) editMoveEnd() error {
+	if e.Pos == len(e.Buffer) {
+		return e.beep()
+	}
+
+	e.Pos = len(e.Buffer)
+	return e.refreshEdit()
+}
+
+// editDeletePrevWord deletes a shell-like word before the cursor.
+func (e *Editor) editDeletePrevWord() error {
+	if e.Pos == 0 {
+		return e.beep()
+	}
+
+	p := e.tokenBackward()
+	if err := e.kill(e.Buffer[p:e.Pos]); err != nil {
+		return err
+	}
+
+	e.saveUndo()
+	e.Buffer = append(e.Buffer[:p], e.Buffer[e.Pos:]...)
 	e.Pos = p
 	return e.refreshLine()
 }
 
-func (e *Editor) editInsert(r rune) error {
-	// Insert https://github.com/golang/go/wiki/SliceTricks
-	e.Buffer = append(e.Buffer, 0)
-	copy(e.Buffer[e.Pos+1:], e.Buffer[e.Pos:])
-	e.Buffer[e.Pos] = r
+func (e *Editor) editMoveTokenBackward() error {
+	if e.Pos == 0 {
+		return e.beep()
+	}
 
-	e.Pos++
+	e.Pos = e.tokenBackward()
 	return e.refreshLine()
 }
 
-func (e *Editor) completeLine() error {
-	if e.Complete == nil {
-		return e.editInsert(tab)
+func (e *Editor) editMoveTokenForward() error {
+	if e.Pos == len(e.Buffer) {
+		return e.beep()
 	}
 
-	opts := e.Complete(string(e.Buffer))
+	e.Pos = e.tokenForward()
+	return e.refreshLine()
+}
 
-	if len(opts) == 0 {
+func (e *Editor) editMoveWordBackward() error {
+	if e.Pos == 0 {
 		return e.beep()
 	}
-	opts = append(opts, string(e.Buffer))
 
-	pos := 0
+	e.Pos = e.wordBackward()
+	return e.refreshLine()
+}
 
-complete:
-	for {
-		c := opts[pos]
+func (e *Editor) editMoveWordForward() error {
+	if e.Pos == len(e.Buffer) {
+		return e.beep()
+	}
 
-		if err := e.refreshLineString(c); err != nil {
-			return err
-		}
+	e.Pos = e.wordForward()
+	return e.refreshLine()
+}
 
-		b, err := e.In.Peek(1)
-		if err != nil {
-			return err
-		}
+func (e *Editor) editKillWordForward() error {
+	if e.Pos == len(e.Buffer) {
+		return e.beep()
+	}
 
-		switch b[0] {
-		case tab:
-			if _, _, err := e.In.ReadRune(); err != nil {
-				return err
-			}
-			pos = (pos + len(opts) + 1) % len(opts)
-		case esc:
-			if _, _, err := e.In.ReadRune(); err != nil {
-				return err
-			}
-			if err := e.refreshLine(); err != nil {
-				return err
-			}
-			break complete
-		default:
-			e.Buffer = []rune(c)
-			e.Pos = len(e.Buffer)
-			break complete
+	p := e.wordForward()
+	if err := e.kill(e.Buffer[e.Pos:p]); err != nil {
+		return err
+	}
+
+	e.saveUndo()
+	e.Buffer = append(e.Buffer[:e.Pos], e.Buffer[p:]...)
+	return e.refreshLine()
+}
+
+func (e *Editor) editKillWordBackward() error {
+	if e.Pos == 0 {
+		return e.beep()
+	}
+
+	p := e.wordBackward()
+	if err := e.kill(e.Buffer[p:e.Pos]); err != nil {
+		return err
+	}
+
+	e.saveUndo()
+	e.Buffer = append(e.Buffer[:p], e.Buffer[e.Pos:]...)
+	e.Pos = p
+	return e.refreshLine()
+}
+
+func (e *Editor) editUpcaseWord() error {
+	return e.editCaseWord(func(_ bool, r rune) rune {
+		return unicode.ToUpper(r)
+	})
+}
+
+func (e *Editor) editDowncaseWord() error {
+	return e.editCaseWord(func(_ bool, r rune) rune {
+		return unicode.ToLower(r)
+	})
+}
+
+func (e *Editor) editCapitalizeWord() error {
+	return e.editCaseWord(func(first bool, r rune) rune {
+		if first {
+			return unicode.ToTitle(r)
 		}
+		return unicode.ToLower(r)
+	})
+}
+
+// editCaseWord converts the letters from the cursor to the end of the current or next word with conv
+// and moves the cursor to the end of the word. conv is told if the letter is the first one in the word.
+func (e *Editor) editCaseWord(conv func(first bool, r rune) rune) error {
+	if e.Pos == len(e.Buffer) {
+		return e.beep()
 	}
 
-	return nil
+	p := e.wordForward()
+	e.saveUndo()
+	for i := e.Pos; i < p; i++ {
+		first := isWordRune(e.Buffer[i]) && (i == 0 || !isWordRune(e.Buffer[e.prevCluster(i)]))
+		e.Buffer[i] = conv(first, e.Buffer[i])
+	}
+	e.Pos = p
+	return e.refreshLine()
+}
+
+// wordBackward returns the position of the beginning of the current or previous word.
+// Words are sequences of letters and digits as in readline.
+// A cluster is a word character if the first rune is e.g. é as e followed by a combining acute accent.
+func (e *Editor) wordBackward() int {
+	p := e.Pos
+	for p > 0 && !isWordRune(e.Buffer[e.prevCluster(p)]) {
+		p = e.prevCluster(p)
+	}
+	for p > 0 && isWordRune(e.Buffer[e.prevCluster(p)]) {
+		p = e.prevCluster(p)
+	}
+	return p
+}
+
+// wordForward returns the position of the end of the current or next word.
+func (e *Editor) wordForward() int {
+	p := e.Pos
+	for p < len(e.Buffer) && !isWordRune(e.Buffer[p]) {
+		p = e.nextCluster(p)
+	}
+	for p < len(e.Buffer) && isWordRune(e.Buffer[p]) {
+		p = e.nextCluster(p)
+	}
+	return p
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (e *Editor) editInsert(r rune) error {
+	// Consecutive insertions are reverted at once.
+	if !e.inserting || e.insertEnd != e.Pos {
+		e.saveUndo()
+	}
+
+	// Insert https://github.com/golang/go/wiki/SliceTricks
+	e.Buffer = append(e.Buffer, 0)
+	copy(e.Buffer[e.Pos+1:], e.Buffer[e.Pos:])
+	e.Buffer[e.Pos] = r
+
+	e.Pos++
+	e.inserting = true
+	e.insertEnd = e.Pos
+	return e.refreshEdit()
 }
 
+// Control characters to compare with runes read from the terminal.
 const (
-	ctrlA     = 1
-	ctrlB     = 2
-	ctrlC     = 3
-	ctrlD     = 4
-	ctrlE     = 5
-	ctrlF     = 6
-	ctrlH     = 8
-	tab       = 9
-	ctrlK     = 11
-	ctrlL     = 12
-	enter     = 13
-	ctrlN     = 14
-	ctrlP     = 16
-	ctrlT     = 20
-	ctrlU     = 21
-	ctrlW     = 23
-	esc       = 27
-	space     = 32
-	backspace = 127
+	ctrlA          = rune(KeyCtrlA)
+	ctrlB          = rune(KeyCtrlB)
+	ctrlC          = rune(KeyCtrlC)
+	ctrlD          = rune(KeyCtrlD)
+	ctrlE          = rune(KeyCtrlE)
+	ctrlF          = rune(KeyCtrlF)
+	ctrlG          = rune(KeyCtrlG)
+	ctrlH          = rune(KeyCtrlH)
+	tab            = rune(KeyTab)
+	ctrlK          = rune(KeyCtrlK)
+	ctrlL          = rune(KeyCtrlL)
+	enter          = rune(KeyEnter)
+	ctrlN          = rune(KeyCtrlN)
+	ctrlP          = rune(KeyCtrlP)
+	ctrlR          = rune(KeyCtrlR)
+	ctrlS          = rune(KeyCtrlS)
+	ctrlT          = rune(KeyCtrlT)
+	ctrlU          = rune(KeyCtrlU)
+	ctrlW          = rune(KeyCtrlW)
+	ctrlX          = rune(KeyCtrlX)
+	ctrlZ          = rune(KeyCtrlZ)
+	esc            = rune(KeyEsc)
+	ctrlUnderscore = rune(KeyCtrlUnderscore)
+	space          = 32
+	backspace      = rune(KeyBackspace)
 )
 
 // SupportedTerms is a list of supported terminals.
 var SupportedTerms = []string{"dumb", "cons25", "emacs"}
 
+// editInsertNewline inserts a newline followed by the indentation of the new line.
+func (e *Editor) editInsertNewline() error {
+	var indent string
+	switch {
+	case e.Indent != nil:
+		s, p := string(e.Buffer), e.Pos
+		e.unlocked(func() {
+			indent = e.Indent(s, p)
+		})
+	case e.AutoIndent:
+		s := e.lineStart(e.Pos)
+		i := s
+		for i < e.Pos && (e.Buffer[i] == ' ' || e.Buffer[i] == '\t') {
+			i++
+		}
+		indent = string(e.Buffer[s:i])
+	}
+
+	if indent == "" {
+		return e.editInsert('\n')
+	}
+	return e.editInsertString("\n" + indent)
+}
+
+// editInsertComment inserts CommentBegin at the beginning of each line of the user input.
+func (e *Editor) editInsertComment() error {
+	c := e.CommentBegin
+	if c == "" {
+		c = "#"
+	}
+
+	e.saveUndo()
+	ls := strings.Split(string(e.Buffer), "\n")
+	for i, l := range ls {
+		ls[i] = c + l
+	}
+	e.Buffer = []rune(strings.Join(ls, "\n"))
+	e.Pos = len(e.Buffer)
+	return e.refreshLine()
+}
+
 func (e *Editor) clearScreen() error {
 	n, err := e.Out.WriteString("\x1b[H\x1b[2J")
 	if err != nil {
-		return err
+		return ioError("write", err)
 	}
 	if n != 7 {
 		return errors.New("failed to clear screen")
 	}
+	e.MaxRows = 0
+	e.cursorRow = 0
+	e.top = 0
 	return nil
 }
 
+// Bell represents how Editor alerts user e.g. when the cursor can't move any further.
+type Bell int
+
+const (
+	// BellAudible rings the terminal bell.
+	BellAudible Bell = iota
+
+	// BellVisible flashes the prompt in reverse video.
+	BellVisible
+
+	// BellNone does nothing.
+	BellNone
+)
+
+// visibleBellDuration is how long the prompt is flashed with BellVisible.
+const visibleBellDuration = 100 * time.Millisecond
+
 func (e *Editor) beep() error {
+	switch e.Bell {
+	case BellVisible:
+		e.flashing = true
+		e.flashes++
+		n := e.flashes
+		time.AfterFunc(visibleBellDuration, func() {
+			e.unflash(n)
+		})
+		return e.refreshLine()
+	case BellNone:
+		return nil
+	}
+
 	if _, err := e.Out.WriteString("\a"); err != nil {
-		return err
+		return ioError("write", err)
 	}
 	if err := e.Out.Flush(); err != nil {
-		return err
+		return ioError("write", err)
 	}
 	return nil
 }
 
-func (e *Editor) refreshLine() error {
-	h := e.hint()
+// unflash redraws the prompt flashed for BellVisible as usual unless it has been flashed again.
+func (e *Editor) unflash(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	f := defaultWidth
-	if e.Width != nil {
-		f = e.Width
+	if !e.flashing || e.flashes != n {
+		return
 	}
-
-	var pw int
-	for _, r := range e.Prompt {
-		pw += f(r)
+	e.flashing = false
+	if e.running && !e.closed && !e.handedOver {
+		_ = e.refreshLine()
 	}
+}
 
-	var bw, cw, ocw int
-	for i, r := range e.Buffer {
-		if i < e.Pos {
-			cw += f(r)
-		}
-		if i < e.OldPos {
-			ocw += f(r)
+func (e *Editor) refreshLine() error {
+	hint, below := e.currentHint()
+	msg := e.messages(e.indicator())
+
+	if e.Mask != 0 {
+		b := e.Buffer
+		defer func() {
+			e.Buffer = b
+		}()
+		e.Buffer = make([]rune, len(b))
+		for i := range e.Buffer {
+			e.Buffer[i] = e.Mask
 		}
-		bw += f(r)
 	}
 
+	prompt := validUTF8(e.prompt())
+	room := e.Cols
+	var h, more string
 	var hw int
-	for _, r := range h {
-		hw += f(r)
+	if e.HorizontalScroll {
+		var left int
+		var restore func()
+		prompt, left, more, restore = e.enterWindow(prompt)
+		defer func() {
+			restore()
+			e.OldPos = e.Pos
+		}()
+		if !below {
+			room = left
+		}
+		h, hw = e.hint(hint, room)
+		if hw > left && !below {
+			h, hw = "", 0
+		}
+	} else {
+		if hint != nil && !below {
+			_, end := e.positions(prompt)
+			room = e.Cols - end.cols
+		}
+		h, hw = e.hint(hint, room)
 	}
+	ps, cp, ep := e.layout(prompt, hw, below, msg)
 
-	ep := pos{
-		cols: (pw + bw + hw) % e.Cols,
-		rows: (pw + bw + hw) / e.Cols,
+	var hs []MatchRange
+	if e.Mask == 0 {
+		hs = e.highlights
+		if e.HorizontalScroll {
+			hs = shiftRanges(hs, -e.scroll)
+		}
 	}
 
-	cp := pos{
-		cols: (pw + cw) % e.Cols,
-		rows: (pw + cw) / e.Cols,
+	// The spinner is displayed above the prompt.
+	var status string
+	if e.spinner != nil && e.running {
+		status = e.spinner.status(e.Cols - 1)
+		cp.rows++
+		ep.rows++
 	}
 
-	ocp := pos{
-		cols: (pw + ocw) % e.Cols,
-		rows: (pw + ocw) / e.Cols,
+	prompt = e.Style.Prompt.apply(prompt, e.profile())
+	if e.flashing {
+		prompt = "\x1b[7m" + prompt + "\x1b[27m"
 	}
 
 	ew := &errWriter{w: e.Out}
 
-	oldRows := e.MaxRows
-	if ep.rows > e.MaxRows {
-		e.MaxRows = ep.rows
+	if e.SynchronizedOutput && e.profile().SynchronizedOutput {
+		ew.writeString(synchronizedOutputOn)
 	}
 
 	// go to the bottom of editor region
-	if oldRows - ocp.rows > 0 {
-		ew.writeString(fmt.Sprintf("\x1b[%dB", oldRows - ocp.rows))
+	if e.MaxRows-e.cursorRow > 0 {
+		ew.writeString(fmt.Sprintf("\x1b[%dB", e.MaxRows-e.cursorRow))
 	}
 
-	for i := 1; i < oldRows; i++ {
+	// clear the editor region from the bottom to the top
+	for i := 0; i < e.MaxRows; i++ {
 		ew.writeString("\x1b[2K") // kill line
 		ew.writeString("\x1b[1A") // go up
 	}
 
 	ew.writeString("\r")
-	ew.writeString(e.Prompt)
-	ew.writeString(string(e.Buffer))
-	ew.writeString(h)
+	if status != "" {
+		ew.writeString(e.uncolor(status))
+		ew.writeString("\x1b[0K\r\n")
+	}
+	ew.writeString(e.uncolor(prompt))
+	ew.writeString(e.uncolor(e.render(ps, hs)))
+	ew.writeString(more)
+	if below {
+		ew.writeString("\x1b[0K\r\n")
+	}
+	ew.writeString(e.uncolor(h))
+	if msg != "" {
+		ew.writeString("\x1b[0K\r\n")
+		for i, l := range strings.Split(validUTF8(msg), "\n") {
+			if i > 0 {
+				ew.writeString("\x1b[0K\r\n")
+			}
+			ew.writeString(e.uncolor(e.Style.Message.apply(l, e.profile())))
+		}
+	}
 	ew.writeString("\x1b[0K")
 
 	// If we are at the right edge,
 	// move cursor to the beginning of next line.
-	if e.Pos == len(e.Buffer) && cp.cols == 0 {
+	if cp.rows > ep.rows {
 		ew.writeString("\n\r")
-		cp.rows++
 		ep.rows++
-		if ep.rows > e.MaxRows {
-			e.MaxRows = ep.rows
-		}
+	}
+
+	// The old editor region is cleared so it's the new height.
+	e.MaxRows = ep.rows
+
+	// The screen scrolls up if the editor region goes beyond the bottom.
+	if e.topKnown && e.top+e.MaxRows >= e.Rows {
+		e.top = e.Rows - 1 - e.MaxRows
 	}
 
 	// Go up till we reach the expected position.
-	if ep.rows - cp.rows > 0 {
-		ew.writeString(fmt.Sprintf("\x1b[%dA", ep.rows - cp.rows))
+	if ep.rows-cp.rows > 0 {
+		ew.writeString(fmt.Sprintf("\x1b[%dA", ep.rows-cp.rows))
 	}
 
 	ew.writeString("\r")
@@ -619,13 +1713,338 @@ func (e *Editor) refreshLine() error {
 		ew.writeString(fmt.Sprintf("\x1b[%dC", cp.cols))
 	}
 
+	if e.SynchronizedOutput && e.profile().SynchronizedOutput {
+		ew.writeString(synchronizedOutputOff)
+	}
+
 	ew.flush()
 
 	e.OldPos = e.Pos
+	e.cursorRow = cp.rows
+	e.refreshed = time.Now()
+	e.stale = false
 
 	return ew.err
 }
 
+// refreshEdit redraws the editor states after an edit unless it's within RefreshInterval and more input is pending.
+func (e *Editor) refreshEdit() error {
+	if e.RefreshInterval > 0 && time.Since(e.refreshed) < e.RefreshInterval && e.pending() {
+		e.stale = true
+		return nil
+	}
+	return e.refreshLine()
+}
+
+// catchUp redraws the editor states if the redraws have been skipped and no more input is pending.
+func (e *Editor) catchUp() error {
+	if !e.stale || e.pending() {
+		return nil
+	}
+	return e.refreshLine()
+}
+
+// pending tells if there's input which can be read without blocking.
+func (e *Editor) pending() bool {
+	if len(e.unread) > 0 {
+		return true
+	}
+	if e.feeder != nil {
+		return len(e.feeder.in) > 0
+	}
+	if e.runes != nil {
+		return len(e.runes) > 0
+	}
+	return e.In.Buffered() > 0
+}
+
+// layout calculates the positions of each rune in Buffer, the cursor position and the position of the last character
+// on the terminal relative to the beginning of the editor region. hw is the width of the hint.
+// If below is true, the hint is displayed on the row beneath the user input. msg is displayed beneath them.
+func (e *Editor) layout(prompt string, hw int, below bool, msg string) ([]pos, pos, pos) {
+	ps, p := e.positions(prompt)
+	cp := ps[e.Pos]
+
+	f := e.width()
+	put := func(w int) {
+		if p.cols+w > e.Cols {
+			p.rows++
+			p.cols = 0
+		}
+		p.cols += w
+	}
+
+	if below {
+		p.rows++
+		p.cols = 0
+	}
+	p.cols += hw
+	for p.cols > e.Cols {
+		p.rows++
+		p.cols -= e.Cols
+	}
+
+	if msg != "" {
+		p.rows++
+		p.cols = 0
+		for _, r := range msg {
+			if r == '\n' {
+				p.rows++
+				p.cols = 0
+				continue
+			}
+			put(f(r))
+		}
+	}
+
+	// The cursor right after the right edge is at the beginning of the next line.
+	if cp.cols >= e.Cols {
+		cp.rows++
+		cp.cols = 0
+	}
+
+	return ps, cp, p
+}
+
+// positions returns the positions of each rune in Buffer followed by the position right after Buffer
+// and the position after Buffer without moving to the next line at the right edge.
+func (e *Editor) positions(prompt string) ([]pos, pos) {
+	f := e.width()
+
+	var p pos
+	put := func(w int) {
+		if p.cols+w > e.Cols {
+			p.rows++
+			p.cols = 0
+		}
+		p.cols += w
+	}
+
+	for _, r := range stripEscapes(prompt) {
+		put(f(r))
+	}
+
+	cont := e.continuationPrompts()
+	order := e.visualOrder()
+	var line int
+	ps := make([]pos, len(e.Buffer)+1)
+	for k := range e.Buffer {
+		i := k
+		if order != nil {
+			i = order[k]
+		}
+		r := e.Buffer[i]
+		if r == '\n' {
+			ps[i] = p
+			p.rows++
+			p.cols = 0
+			line++
+			for _, r := range stripEscapes(cont(line)) {
+				put(f(r))
+			}
+			continue
+		}
+
+		if r == tab {
+			if p.cols >= e.Cols {
+				p.rows++
+				p.cols = 0
+			}
+			ps[i] = p
+			p.cols = e.tabStop(p.cols)
+			if p.cols > e.Cols {
+				p.cols = e.Cols
+			}
+			continue
+		}
+
+		w := f(r)
+		if p.cols+w > e.Cols {
+			p.rows++
+			p.cols = 0
+		}
+		ps[i] = p
+		p.cols += w
+	}
+	ps[len(e.Buffer)] = p
+
+	return ps, p
+}
+
+// tabStop returns the column of the next tab stop after the column c.
+func (e *Editor) tabStop(c int) int {
+	w := e.TabWidth
+	if w <= 0 {
+		w = 8
+	}
+	return (c/w + 1) * w
+}
+
+// render converts Buffer to a string to be displayed on the terminal. ps are the positions of each rune in Buffer.
+// The runes are in the order of Bidi if it's provided.
+// Tabs are expanded to spaces, and control characters are displayed in caret notation.
+// The runes in hs are highlighted with Style.SearchMatch.
+func (e *Editor) render(ps []pos, hs []MatchRange) string {
+	on, off := e.matchStyle()
+	wsOn, wsOff := e.whitespaceStyle()
+	vs := e.visibleWhitespace()
+	cont := e.continuationPrompts()
+	order := e.visualOrder()
+	var line int
+	var b strings.Builder
+	var hl bool
+	for k := range e.Buffer {
+		i, next := k, k+1
+		if order != nil {
+			i = order[k]
+			next = len(e.Buffer)
+			if k+1 < len(order) {
+				next = order[k+1]
+			}
+		}
+		r := e.Buffer[i]
+		if h := inMatch(hs, i) && r != '\n'; h != hl {
+			if h {
+				b.WriteString(on)
+			} else {
+				b.WriteString(off)
+			}
+			hl = h
+		}
+
+		switch {
+		case r == '\n':
+			b.WriteString("\x1b[0K\r\n")
+			line++
+			b.WriteString(e.Style.Prompt.apply(cont(line), e.profile()))
+		case r == tab:
+			w := e.Cols - ps[i].cols
+			if ps[next].rows == ps[i].rows {
+				w = ps[next].cols - ps[i].cols
+			}
+			switch {
+			case w <= 0:
+			case vs != nil && vs[i]:
+				b.WriteString(wsOn + e.whitespaceMarker(tab) + wsOff)
+				if hl {
+					b.WriteString(on) // the style might have been reset.
+				}
+				w--
+			case e.ShowTabs:
+				b.WriteString(e.whitespaceMarker(tab))
+				w--
+			}
+			b.WriteString(strings.Repeat(" ", w))
+		case r == ' ' && vs != nil && vs[i]:
+			b.WriteString(wsOn + e.whitespaceMarker(' ') + wsOff)
+			if hl {
+				b.WriteString(on) // the style might have been reset.
+			}
+		case caret(r) != "" && e.Style.ControlCharacter != (TextStyle{}):
+			b.WriteString(e.Style.ControlCharacter.apply(caret(r), e.profile()))
+			if hl {
+				b.WriteString(on) // the style has been reset.
+			}
+		case caret(r) != "":
+			b.WriteString(caretNotationOn)
+			b.WriteString(caret(r))
+			b.WriteString(caretNotationOff)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if hl {
+		b.WriteString(off)
+	}
+	return b.String()
+}
+
+func (e *Editor) prompt() string {
+	if e.question != "" {
+		return e.question
+	}
+	if e.argPrompt != "" {
+		return e.argPrompt
+	}
+	if e.searchPrompt != "" {
+		return e.searchPrompt
+	}
+	if e.PromptFunc != nil {
+		return e.PromptFunc()
+	}
+	return e.Prompt
+}
+
+// stripEscapes removes escape sequences e.g. colors from s so that the width of s can be calculated.
+func stripEscapes(s string) string {
+	var b strings.Builder
+	var escape, csi bool
+	for _, r := range s {
+		switch {
+		case csi:
+			if 0x40 <= r && r <= 0x7e { // final character
+				escape, csi = false, false
+			}
+		case escape:
+			if r == '[' {
+				csi = true
+			} else {
+				escape = false
+			}
+		case r == esc:
+			escape = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// showMessage displays msg below the user input until the next key stroke.
+func (e *Editor) showMessage(msg string) error {
+	e.message = msg
+	if err := e.refreshLine(); err != nil {
+		return err
+	}
+	return e.beep()
+}
+
+// moveToBottom moves the cursor to the bottom of the editor region
+// so that following outputs don't overwrite the editor states.
+func (e *Editor) moveToBottom() error {
+	if e.stale {
+		if err := e.refreshLine(); err != nil {
+			return err
+		}
+	}
+
+	if e.MaxRows-e.cursorRow <= 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(e.Out, "\x1b[%dB\r", e.MaxRows-e.cursorRow); err != nil {
+		return ioError("write", err)
+	}
+	e.cursorRow = e.MaxRows
+	return ioError("write", e.Out.Flush())
+}
+
+func (e *Editor) width() func(rune) int {
+	f := RuneWidth
+	switch {
+	case e.Width != nil:
+		f = e.Width
+	case e.AmbiguousWide:
+		f = EastAsianRuneWidth
+	}
+	return joining(func(r rune) int {
+		if c := caret(r); c != "" {
+			return len(c)
+		}
+		return f(r)
+	})
+}
+
 func (e *Editor) refreshLineString(s string) error {
 	b := e.Buffer
 	p := e.Pos
@@ -639,14 +2058,6 @@ func (e *Editor) refreshLineString(s string) error {
 	return nil
 }
 
-func defaultWidth(r rune) int {
-	if r == tab {
-		return 4
-	}
-
-	return 1
-}
-
 // Hint displays helpful message with styles on the right of user input.
 type Hint struct {
 	// Message is the message to be displayed.
@@ -657,21 +2068,92 @@ type Hint struct {
 
 	// Bold increases intensity if true.
 	Bold bool
+
+	// Below displays the hint on the row beneath the user input instead of on the right
+	// so that a long hint doesn't wrap along with a long user input.
+	Below bool
+}
+
+// currentHint returns the hint for the current user input and whether it's displayed below the user input.
+func (e *Editor) currentHint() (*Hint, bool) {
+	if !e.hints() || e.question != "" {
+		return nil, false
+	}
+
+	var h *Hint
+	if e.HintDelay > 0 {
+		if e.hinted && e.hintFor == string(e.Buffer) {
+			h = e.lastHint
+		}
+	} else {
+		ctx := e.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		h = e.callHint(ctx, string(e.Buffer))
+	}
+
+	if h == nil {
+		return nil, false
+	}
+
+	return h, h.Below || e.HintBelow
 }
 
-func (e *Editor) hint() string {
-	if e.Hint == nil {
-		return ""
+// hints tells if either Hint or HintContext is provided.
+func (e *Editor) hints() bool {
+	return e.Hint != nil || e.HintContext != nil
+}
+
+// callHint returns the hint for s from HintContext or Hint.
+func (e *Editor) callHint(ctx context.Context, s string) *Hint {
+	if e.HintContext != nil {
+		return e.HintContext(ctx, s)
 	}
+	return e.Hint(s)
+}
 
-	h := e.Hint(string(e.Buffer))
+// hintEllipsis replaces the end of a hint truncated by HintTruncate.
+// hintEllipsisASCII is used instead if the terminal can't display Unicode.
+const (
+	hintEllipsis      = "…"
+	hintEllipsisASCII = "..."
+)
 
+// hint returns the hint decorated with escape sequences and the width of the hint message.
+// If HintTruncate is enabled, the hint message is truncated to fit in room columns.
+func (e *Editor) hint(h *Hint, room int) (string, int) {
 	if h == nil {
-		return ""
+		return "", 0
+	}
+
+	msg := validUTF8(h.Message)
+
+	f := e.width()
+	var w int
+	for _, r := range msg {
+		w += f(r)
+	}
+
+	if e.HintTruncate && w > room {
+		msg, w = e.truncate(msg, room)
+		if w == 0 {
+			return "", 0
+		}
+	}
+
+	if e.Style.Hint != (TextStyle{}) {
+		s := e.Style.Hint
+		if h.Color != 0 {
+			s.Foreground = h.Color
+		}
+		s.Bold = s.Bold || h.Bold
+		return s.apply(msg, e.profile()), w
 	}
 
-	if h.Color == 0 {
-		h.Color = White
+	c := h.Color
+	if c == 0 {
+		c = White
 	}
 
 	var b int
@@ -679,7 +2161,39 @@ func (e *Editor) hint() string {
 		b = 1
 	}
 
-	return fmt.Sprintf("\x1b[%d;%d;49m%s\x1b[0m", b, h.Color, h.Message)
+	if e.profile().Colors == 0 {
+		return fmt.Sprintf("\x1b[%dm%s\x1b[0m", b, msg), w
+	}
+
+	return fmt.Sprintf("\x1b[%d;%d;49m%s\x1b[0m", b, c, msg), w
+}
+
+// truncate shortens s followed by an ellipsis to fit in room columns and returns it with its width.
+// If even the ellipsis doesn't fit, it returns an empty string.
+func (e *Editor) truncate(s string, room int) (string, int) {
+	ellipsis := e.ascii(hintEllipsis, hintEllipsisASCII)
+
+	f := e.width()
+	var ew int
+	for _, r := range ellipsis {
+		ew += f(r)
+	}
+	if ew > room {
+		return "", 0
+	}
+
+	var b strings.Builder
+	var w int
+	for _, r := range s {
+		rw := f(r)
+		if w+rw > room-ew {
+			break
+		}
+		b.WriteRune(r)
+		w += rw
+	}
+	b.WriteString(ellipsis)
+	return b.String(), w + ew
 }
 
 // Color represents text color.
@@ -706,67 +2220,33 @@ func (ew *errWriter) writeString(s string) {
 	if ew.err != nil {
 		return
 	}
-	_, ew.err = ew.w.WriteString(s)
+	_, err := ew.w.WriteString(s)
+	ew.err = ioError("write", err)
 }
 
 func (ew *errWriter) write(b []byte) {
 	if ew.err != nil {
 		return
 	}
-	_, ew.err = ew.w.Write(b)
+	_, err := ew.w.Write(b)
+	ew.err = ioError("write", err)
 }
 
 func (ew *errWriter) flush() {
 	if ew.err != nil {
 		return
 	}
-	ew.err = ew.w.Flush()
-}
-
-type pos struct {
-	cols, rows int
-}
-
-type History struct {
-	Lines []string
-	Pos   int
-}
-
-func (h *History) Add(l string) {
-	if len(h.Lines) == 0 {
-		h.Lines = []string{""}
-	}
-	h.Lines[len(h.Lines)-1] = l
-	h.Lines = append(h.Lines, "")
-	h.Pos = len(h.Lines)-1
+	ew.err = ioError("write", ew.w.Flush())
 }
 
-func (h *History) Next() error {
-	if h.Pos >= len(h.Lines)-1 {
-		return errors.New("end of history")
+// ioError adds what Editor was doing to err from In or Out. The original error can be checked with errors.Is.
+func ioError(op string, err error) error {
+	if err == nil {
+		return nil
 	}
-	h.Pos++
-	return nil
-}
-
-func (h *History) Prev() error {
-	if h.Pos <= 0 {
-		return errors.New("beginning of history")
-	}
-	h.Pos--
-	return nil
-}
-
-func (h *History) Get() string {
-	return h.Lines[h.Pos]
+	return fmt.Errorf("%s: %w", op, err)
 }
 
-func (h *History) Save(l string) {
-	if len(h.Lines) == 0 {
-		h.Lines = []string{""}
-	}
-	if h.Pos != len(h.Lines)-1 {
-		return
-	}
-	h.Lines[len(h.Lines)-1] = l
+type pos struct {
+	cols, rows int
 }
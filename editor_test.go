@@ -3,9 +3,16 @@ package linesqueak_test
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ichiban/linesqueak"
 )
@@ -40,48 +47,42 @@ func TestEditor_LineEnter(t *testing.T) {
 	}
 }
 
-func TestEditor_LineCtrlC(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo b\x03"))
+func TestEditor_LinePromptFunc(t *testing.T) {
+	in := bytes.NewBuffer([]byte("ab\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
-			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r\x1b[1m0\x1b[0m> \x1b[0K\r\x1b[3C",
+			"\r\x1b[1m1\x1b[0m> a\x1b[0K\r\x1b[4C",
+			"\r\x1b[1m2\x1b[0m> ab\x1b[0K\r\x1b[5C",
 		},
 	}
 
+	var n int
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:  bufio.NewReader(in),
+		Out: bufio.NewWriter(out),
+		PromptFunc: func() string {
+			defer func() { n++ }()
+			return fmt.Sprintf("\x1b[1m%d\x1b[0m> ", n)
+		},
 	}
 
 	l, err := e.Line()
-	if err == nil {
-		t.Error("err expected")
+	if err != nil {
+		t.Error(err)
 	}
-	if l != "foo b" {
-		t.Errorf(`expected "foo b" got %#v`, l)
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
 	}
 }
 
-func TestEditor_LineBackspace(t *testing.T) {
-	in := bytes.NewBuffer([]byte("fooo\x7f bar\x0d"))
+func TestEditor_LineWithDefault(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x01x\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
-			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> fooo\x1b[0K\r\x1b[6C",
 			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo\x1b[0K\r\x1b[2C",
+			"\r> xfoo\x1b[0K\r\x1b[3C",
 		},
 	}
 
@@ -91,143 +92,68 @@ func TestEditor_LineBackspace(t *testing.T) {
 		Prompt: "> ",
 	}
 
-	l, err := e.Line()
+	l, err := e.LineWithDefault("foo")
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "xfoo" {
+		t.Errorf(`expected "xfoo" got %#v`, l)
 	}
 }
 
-func TestEditor_LineCtrlH(t *testing.T) {
-	in := bytes.NewBuffer([]byte("fooo\x08 bar\x0d"))
+func TestEditor_LineRefreshInterval(t *testing.T) {
+	in := bytes.NewBuffer([]byte("abc\x7fdef\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> fooo\x1b[0K\r\x1b[6C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> abdef\x1b[0K\r\x1b[7C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:              bufio.NewReader(in),
+		Out:             bufio.NewWriter(out),
+		Prompt:          "> ",
+		RefreshInterval: time.Hour,
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
-	}
-}
-
-func TestEditor_LineCtrlD(t *testing.T) {
-	{ // with empty buffer
-		in := bytes.NewBuffer([]byte("\x04"))
-		out := &checkedWriter{
-			expectations: []string{
-				"\r> \x1b[0K\r\x1b[2C",
-			},
-		}
-
-		e := &linesqueak.Editor{
-			In:     bufio.NewReader(in),
-			Out:    bufio.NewWriter(out),
-			Prompt: "> ",
-		}
-
-		l, err := e.Line()
-		if err != io.EOF {
-			t.Error(err)
-		}
-		if l != "" {
-			t.Errorf(`expected "" got %#v`, l)
-		}
-	}
-
-	{ // with non-empty buffer
-		in := bytes.NewBuffer([]byte("fooo\x02\x04 bar\x0d"))
-		out := &checkedWriter{
-			expectations: []string{
-				"\r> \x1b[0K\r\x1b[2C",
-				"\r> f\x1b[0K\r\x1b[3C",
-				"\r> fo\x1b[0K\r\x1b[4C",
-				"\r> foo\x1b[0K\r\x1b[5C",
-				"\r> fooo\x1b[0K\r\x1b[6C",
-				"\r> fooo\x1b[0K\r\x1b[5C",
-				"\r> foo\x1b[0K\r\x1b[5C",
-				"\r> foo \x1b[0K\r\x1b[6C",
-				"\r> foo b\x1b[0K\r\x1b[7C",
-				"\r> foo ba\x1b[0K\r\x1b[8C",
-				"\r> foo bar\x1b[0K\r\x1b[9C",
-			},
-		}
-
-		e := &linesqueak.Editor{
-			In:     bufio.NewReader(in),
-			Out:    bufio.NewWriter(out),
-			Prompt: "> ",
-		}
-
-		l, err := e.Line()
-		if err != nil {
-			t.Error(err)
-		}
-		if l != "foo bar" {
-			t.Errorf(`expected "foo bar" got %#v`, l)
-		}
+	if l != "abdef" {
+		t.Errorf(`expected "abdef" got %#v`, l)
 	}
 }
 
-func TestEditor_LineCtrlT(t *testing.T) {
-	in := bytes.NewBuffer([]byte("fo obra\x14\x02\x02\x02\x02\x14\x0d"))
+func TestEditor_LineRefreshIntervalLongInsert(t *testing.T) {
+	in := bytes.NewBufferString("\x02" + strings.Repeat("a", 100) + "b\x7fc\x0d")
 	out := &checkedWriter{
 		expectations: []string{
-			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> fo \x1b[0K\r\x1b[5C",
-			"\r> fo o\x1b[0K\r\x1b[6C",
-			"\r> fo ob\x1b[0K\r\x1b[7C",
-			"\r> fo obr\x1b[0K\r\x1b[8C",
-			"\r> fo obra\x1b[0K\r\x1b[9C",
-			"\r> fo obar\x1b[0K\r\x1b[9C",
-			"\r> fo obar\x1b[0K\r\x1b[8C",
-			"\r> fo obar\x1b[0K\r\x1b[7C",
-			"\r> fo obar\x1b[0K\r\x1b[6C",
-			"\r> fo obar\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> xy\x1b[0K\r\x1b[4C",
+			"\r> xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaacy\x1b[0K\r\x1b[104C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:              bufio.NewReader(in),
+		Out:             bufio.NewWriter(out),
+		Prompt:          "> ",
+		Cols:            200,
+		RefreshInterval: time.Hour,
 	}
 
-	l, err := e.Line()
+	l, err := e.LineWithDefault("xy")
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if expected := "x" + strings.Repeat("a", 100) + "cy"; l != expected {
+		t.Errorf("expected %#v got %#v", expected, l)
 	}
 }
 
-func TestEditor_LineCtrlBCtrlF(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x02\x02\x02\x02\x02\x02\x02\x02\x06\x06\x06\x06\x06\x06\x06\x0d"))
+func TestEditor_LineCtrlC(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo b\x03"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
@@ -236,24 +162,6 @@ func TestEditor_LineCtrlBCtrlF(t *testing.T) {
 			"\r> foo\x1b[0K\r\x1b[5C",
 			"\r> foo \x1b[0K\r\x1b[6C",
 			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[7C",
-			"\r> foo bar\x1b[0K\r\x1b[6C",
-			"\r> foo bar\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[4C",
-			"\r> foo bar\x1b[0K\r\x1b[3C",
-			"\r> foo bar\x1b[0K\r\x1b[2C",
-			"\a",
-			"\r> foo bar\x1b[0K\r\x1b[3C",
-			"\r> foo bar\x1b[0K\r\x1b[4C",
-			"\r> foo bar\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[6C",
-			"\r> foo bar\x1b[0K\r\x1b[7C",
-			"\r> foo bar\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\a",
 		},
 	}
 
@@ -264,28 +172,23 @@ func TestEditor_LineCtrlBCtrlF(t *testing.T) {
 	}
 
 	l, err := e.Line()
-	if err != nil {
-		t.Error(err)
+	if !errors.Is(err, linesqueak.ErrInterrupt) {
+		t.Errorf("expected ErrInterrupt got %v", err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "foo b" {
+		t.Errorf(`expected "foo b" got %#v`, l)
 	}
 }
 
-func TestEditor_LineCtrlPCtrlN(t *testing.T) {
-	in := bytes.NewBuffer([]byte("\x10foo\x0d\x10\x10\x0e\x0ebar\x0d"))
+func TestEditor_LineInterruptMode(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\x03bar\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\a",
 			"\r> f\x1b[0K\r\x1b[3C",
 			"\r> fo\x1b[0K\r\x1b[4C",
 			"\r> foo\x1b[0K\r\x1b[5C",
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\a",
-			"\r> \x1b[0K\r\x1b[2C",
-			"\a",
 			"\r> b\x1b[0K\r\x1b[3C",
 			"\r> ba\x1b[0K\r\x1b[4C",
 			"\r> bar\x1b[0K\r\x1b[5C",
@@ -293,173 +196,218 @@ func TestEditor_LineCtrlPCtrlN(t *testing.T) {
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:            bufio.NewReader(in),
+		Out:           bufio.NewWriter(out),
+		Prompt:        "> ",
+		InterruptMode: linesqueak.InterruptClear,
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo" {
-		t.Errorf(`expected "foo" got %#v`, l)
-	}
-
-	e.History.Add("foo")
-
-	l, err = e.Line()
-	if err != nil {
-		t.Error(err)
-	}
 	if l != "bar" {
 		t.Errorf(`expected "bar" got %#v`, l)
 	}
 }
 
-func TestEditor_LineCtrlU(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x15\x0d"))
+func TestEditor_LineOnInterrupt(t *testing.T) {
+	errQuit := errors.New("quit")
+
+	in := bytes.NewBuffer([]byte("foo\x03quit\x03"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
 			"\r> f\x1b[0K\r\x1b[3C",
 			"\r> fo\x1b[0K\r\x1b[4C",
 			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
 			"\r> \x1b[0K\r\x1b[2C",
+			"\r> q\x1b[0K\r\x1b[3C",
+			"\r> qu\x1b[0K\r\x1b[4C",
+			"\r> qui\x1b[0K\r\x1b[5C",
+			"\r> quit\x1b[0K\r\x1b[6C",
 		},
 	}
 
+	var interrupted []string
 	e := &linesqueak.Editor{
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
+		OnInterrupt: func(s string) error {
+			interrupted = append(interrupted, s)
+			if s == "quit" {
+				return errQuit
+			}
+			return nil
+		},
 	}
 
 	l, err := e.Line()
-	if err != nil {
-		t.Error(err)
+	if !errors.Is(err, errQuit) {
+		t.Errorf("expected errQuit got %v", err)
 	}
-	if l != "" {
-		t.Errorf(`expected "" got %#v`, l)
+	if l != "quit" {
+		t.Errorf(`expected "quit" got %#v`, l)
+	}
+	if len(interrupted) != 2 || interrupted[0] != "foo" {
+		t.Errorf("unexpected %#v", interrupted)
 	}
 }
 
-func TestEditor_LineCtrlK(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x02\x02\x0b\x0d"))
+func TestEditor_LineIgnoreEOF(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x04a\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[7C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\a",
+			"\r> a\x1b[0K\r\x1b[3C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:        bufio.NewReader(in),
+		Out:       bufio.NewWriter(out),
+		Prompt:    "> ",
+		IgnoreEOF: true,
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo b" {
-		t.Errorf(`expected "foo b" got %#v`, l)
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
 	}
 }
 
-func TestEditor_LineCtrlACtrlE(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x01\x05\x0d"))
+func TestEditor_LineIdleTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go func() {
+		_, _ = w.Write([]byte("a"))
+	}()
+
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar\x1b[0K\r\x1b[2C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> a\x1b[0K\r\x1b[3C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:          bufio.NewReader(r),
+		Out:         bufio.NewWriter(out),
+		Prompt:      "> ",
+		IdleTimeout: 10 * time.Millisecond,
 	}
 
 	l, err := e.Line()
+	if !errors.Is(err, linesqueak.ErrIdleTimeout) {
+		t.Errorf("expected %v got %v", linesqueak.ErrIdleTimeout, err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+}
+
+func TestEditor_LineConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	e := &linesqueak.Editor{
+		In:          bufio.NewReader(server),
+		Out:         bufio.NewWriter(io.Discard),
+		Conn:        server,
+		Prompt:      "> ",
+		IdleTimeout: 10 * time.Millisecond,
+	}
+
+	go func() {
+		_, _ = client.Write([]byte("a"))
+	}()
+	l, err := e.Line()
+	if !errors.Is(err, linesqueak.ErrIdleTimeout) {
+		t.Errorf("expected %v got %v", linesqueak.ErrIdleTimeout, err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.IdleTimeout = 0
+	go func() {
+		_, _ = client.Write([]byte("b"))
+		cancel()
+	}()
+	l, err = e.LineContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	if l != "b" {
+		t.Errorf(`expected "b" got %#v`, l)
+	}
+
+	go func() {
+		_, _ = client.Write([]byte("c\r"))
+	}()
+	l, err = e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "c" {
+		t.Errorf(`expected "c" got %#v`, l)
 	}
 }
 
-func TestEditor_LineCtrlL(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x0c\x0d"))
+func TestEditor_LineSuspend(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1ab\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\x1b[H\x1b[2J\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r\n",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
 		},
 	}
 
+	var suspended int
 	e := &linesqueak.Editor{
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
-	}
+		Suspend: func() error {
+			suspended++
+			return nil
+		},
+	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
+	}
+	if suspended != 1 {
+		t.Errorf("expected 1 got %d", suspended)
 	}
 }
 
-func TestEditor_LineCtrlW(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo  bar \x17\x17\x0d"))
+func TestEditor_LineExternalEditor(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x18\x05\x18\x05\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo  \x1b[0K\r\x1b[7C",
-			"\r> foo  b\x1b[0K\r\x1b[8C",
-			"\r> foo  ba\x1b[0K\r\x1b[9C",
-			"\r> foo  bar\x1b[0K\r\x1b[10C",
-			"\r> foo  bar \x1b[0K\r\x1b[11C",
-			"\r> foo  \x1b[0K\r\x1b[7C",
-			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r\n",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r\n",
+			"\r> ab\x1b[0K\r\nnot again\x1b[0K\x1b[1A\r\x1b[4C",
+			"\a",
+			"\x1b[1B\x1b[2K\x1b[1A\r> ab\x1b[0K\r\x1b[4C",
 		},
 	}
 
@@ -467,63 +415,108 @@ func TestEditor_LineCtrlW(t *testing.T) {
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
+		ExternalEditor: func(s string) (string, error) {
+			if s != "a" {
+				return "", errors.New("not again")
+			}
+			return s + "b", nil
+		},
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "" {
-		t.Errorf(`expected "" got %#v`, l)
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
 	}
 }
 
-func TestEditor_LineEscSquareBracket3Tilda(t *testing.T) {
-	in := bytes.NewBuffer([]byte("abc\x02\x02\x1b[3~\x0d"))
+func TestEditor_LineCallbackWrite(t *testing.T) {
+	// callbacks can write to Editor without deadlock.
+	in := bytes.NewBuffer([]byte("a\x18\x05\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
 			"\r> a\x1b[0K\r\x1b[3C",
+			"\r\n",
+			"\r\x1b[0Kediting\r\n",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r\x1b[0Kvalidating\r\n",
 			"\r> ab\x1b[0K\r\x1b[4C",
-			"\r> abc\x1b[0K\r\x1b[5C",
-			"\r> abc\x1b[0K\r\x1b[4C",
-			"\r> abc\x1b[0K\r\x1b[3C",
-			"\r> ac\x1b[0K\r\x1b[3C",
 		},
 	}
 
-	e := &linesqueak.Editor{
+	var e *linesqueak.Editor
+	e = &linesqueak.Editor{
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
+		ExternalEditor: func(s string) (string, error) {
+			_, err := fmt.Fprintln(e, "editing")
+			return s + "b", err
+		},
+		Validate: func(s string) error {
+			_, err := fmt.Fprintln(e, "validating")
+			return err
+		},
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "ac" {
-		t.Errorf(`expected "ac" got %#v`, l)
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
 	}
 }
 
-func TestEditor_LineEscSquareBracketAEscSquareBracketB(t *testing.T) {
-	in := bytes.NewBuffer([]byte("\x1b[Afoo\x0d\x1b[A\x1b[A\x1b[B\x1b[Bbar\x0d"))
+func TestEditor_LineIOError(t *testing.T) {
+	errBroken := errors.New("broken")
+
+	t.Run("read", func(t *testing.T) {
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(bytes.NewBufferString("foo")),
+			Out:    bufio.NewWriter(io.Discard),
+			Prompt: "> ",
+		}
+
+		_, err := e.Line()
+		if !errors.Is(err, io.EOF) || err == io.EOF {
+			t.Errorf("expected wrapped io.EOF got %v", err)
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		e := &linesqueak.Editor{
+			In: bufio.NewReader(bytes.NewBufferString("foo")),
+			Out: bufio.NewWriter(writerFunc(func([]byte) (int, error) {
+				return 0, errBroken
+			})),
+			Prompt: "> ",
+		}
+
+		_, err := e.Line()
+		if !errors.Is(err, errBroken) || err == errBroken {
+			t.Errorf("expected wrapped errBroken got %v", err)
+		}
+	})
+}
+
+func TestEditor_LineBackspace(t *testing.T) {
+	in := bytes.NewBuffer([]byte("fooo\x7f bar\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\a",
 			"\r> f\x1b[0K\r\x1b[3C",
 			"\r> fo\x1b[0K\r\x1b[4C",
 			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> \x1b[0K\r\x1b[2C",
+			"\r> fooo\x1b[0K\r\x1b[6C",
 			"\r> foo\x1b[0K\r\x1b[5C",
-			"\a",
-			"\r> \x1b[0K\r\x1b[2C",
-			"\a",
-			"\r> b\x1b[0K\r\x1b[3C",
-			"\r> ba\x1b[0K\r\x1b[4C",
-			"\r> bar\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
 		},
 	}
 
@@ -537,113 +530,171 @@ func TestEditor_LineEscSquareBracketAEscSquareBracketB(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo" {
-		t.Errorf(`expected "foo" got %#v`, l)
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
 	}
+}
 
-	e.History.Add("foo")
+func TestEditor_LineBell(t *testing.T) {
+	t.Run("visible", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("\x7fa\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r\x1b[7m> \x1b[27m\x1b[0K\r\x1b[2C",
+				"\r\x1b[7m> \x1b[27ma\x1b[0K\r\x1b[3C",
+				"\r> a\x1b[0K\r\x1b[3C",
+			},
+		}
 
-	l, err = e.Line()
-	if err != nil {
-		t.Error(err)
-	}
-	if l != "bar" {
-		t.Errorf(`expected "bar" got %#v`, l)
-	}
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+			Bell:   linesqueak.BellVisible,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a" {
+			t.Errorf(`expected "a" got %#v`, l)
+		}
+	})
+
+	t.Run("visible timeout", func(t *testing.T) {
+		r, w := io.Pipe()
+		defer w.Close()
+		go func() {
+			_, _ = w.Write([]byte("\x7f"))
+			time.Sleep(300 * time.Millisecond)
+			_, _ = w.Write([]byte("a\x0d"))
+		}()
+
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r\x1b[7m> \x1b[27m\x1b[0K\r\x1b[2C",
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(r),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+			Bell:   linesqueak.BellVisible,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a" {
+			t.Errorf(`expected "a" got %#v`, l)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("\x7fa\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+			Bell:   linesqueak.BellNone,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a" {
+			t.Errorf(`expected "a" got %#v`, l)
+		}
+	})
 }
 
-func TestEditor_LineEscSquareBracketCEscSquareBracketD(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x0d"))
+func TestEditor_LineProfile(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\tfoo\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[7C",
-			"\r> foo bar\x1b[0K\r\x1b[6C",
-			"\r> foo bar\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[4C",
-			"\r> foo bar\x1b[0K\r\x1b[3C",
-			"\r> foo bar\x1b[0K\r\x1b[2C",
-			"\a",
-			"\r> foo bar\x1b[0K\r\x1b[3C",
-			"\r> foo bar\x1b[0K\r\x1b[4C",
-			"\r> foo bar\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[6C",
-			"\r> foo bar\x1b[0K\r\x1b[7C",
-			"\r> foo bar\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\a",
+			"\r> >     \x1b[0K\r\x1b[8C",
+			"\r> >     f\x1b[0K\r\x1b[9C",
+			"\r> >     fo\x1b[0K\r\x1b[10C",
+			"\r> >     foo\x1b[1m bar\x1b[0m\x1b[0K\r\x1b[11C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:                 bufio.NewReader(in),
+		Out:                bufio.NewWriter(out),
+		Prompt:             "> ",
+		ShowTabs:           true,
+		BracketedPaste:     true,
+		SynchronizedOutput: true,
+		Profile:            &linesqueak.TermProfile{},
+		Hint: func(s string) *linesqueak.Hint {
+			if s == "\tfoo" {
+				return &linesqueak.Hint{Message: " bar", Color: linesqueak.Red, Bold: true}
+			}
+			return nil
+		},
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "\tfoo" {
+		t.Errorf(`expected "\tfoo" got %#v`, l)
 	}
 }
 
-func TestEditor_LineEscSquareBracketHEscSquareBracketF(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x1b[H\x1b[F\x0d"))
+func TestEditor_LineNoColor(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
-			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar\x1b[0K\r\x1b[2C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> ^A bar\x1b[0K\r\x1b[4C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:      bufio.NewReader(in),
+		Out:     bufio.NewWriter(out),
+		Prompt:  "\x1b[32m>\x1b[0m ",
+		NoColor: true,
+		Hint: func(s string) *linesqueak.Hint {
+			if s == "\x01" {
+				return &linesqueak.Hint{Message: " bar", Color: linesqueak.Red, Bold: true}
+			}
+			return nil
+		},
 	}
 
-	l, err := e.Line()
+	l, err := e.LineWithDefault("\x01")
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "\x01" {
+		t.Errorf(`expected "\x01" got %#v`, l)
 	}
 }
 
-func TestEditor_LineEscOHEscOF(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x1bOH\x1bOF\x0d"))
+func TestEditor_LineStyle(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
-			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar\x1b[0K\r\x1b[2C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r\x1b[1;32m> \x1b[0m\x1b[4m^A\x1b[0m\x1b[2;36m bar\x1b[0m\x1b[0K\r\x1b[4C",
 		},
 	}
 
@@ -651,26 +702,32 @@ func TestEditor_LineEscOHEscOF(t *testing.T) {
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
+		Style: linesqueak.Style{
+			Prompt:           linesqueak.TextStyle{Foreground: linesqueak.Green, Bold: true},
+			Hint:             linesqueak.TextStyle{Foreground: linesqueak.Blue, Faint: true},
+			ControlCharacter: linesqueak.TextStyle{Underline: true},
+		},
+		Hint: func(s string) *linesqueak.Hint {
+			return &linesqueak.Hint{Message: " bar", Color: linesqueak.Cyan}
+		},
 	}
 
-	l, err := e.Line()
+	l, err := e.LineWithDefault("\x01")
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "\x01" {
+		t.Errorf(`expected "\x01" got %#v`, l)
 	}
 }
 
-func TestEditor_LineTabNoCompleteFunc(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo\t\x0d"))
+func TestEditor_LineHintBelow(t *testing.T) {
+	in := bytes.NewBuffer([]byte("fo\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo\t\x1b[0K\r\x1b[9C",
+			"\r> f\x1b[0K\r\n\x1b[0;37;49mbar\x1b[0m\x1b[0K\x1b[1A\r\x1b[3C",
+			"\x1b[1B\x1b[2K\x1b[1A\r> fo\x1b[0K\r\x1b[4C",
 		},
 	}
 
@@ -678,39 +735,43 @@ func TestEditor_LineTabNoCompleteFunc(t *testing.T) {
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
+		Hint: func(s string) *linesqueak.Hint {
+			if s == "f" {
+				return &linesqueak.Hint{Message: "bar", Below: true}
+			}
+			return nil
+		},
 	}
 
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo\t" {
-		t.Errorf(`expected "foo\t" got %#v`, l)
+	if l != "fo" {
+		t.Errorf(`expected "fo" got %#v`, l)
 	}
 }
 
-func TestEditor_LineTabNoCompletionAvailable(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo\t\x0d"))
+func TestEditor_LineHintTruncate(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\a",
-			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> f\x1b[0;37;49mbarbaz…\x1b[0m\x1b[0K\r\x1b[3C",
 		},
 	}
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
-		Complete: func(s string) []string {
-			if s != "foo" {
-				t.Errorf(`expected "foo" got %#v`, s)
+		In:           bufio.NewReader(in),
+		Out:          bufio.NewWriter(out),
+		Prompt:       "> ",
+		Cols:         10,
+		HintTruncate: true,
+		Hint: func(s string) *linesqueak.Hint {
+			if s == "f" {
+				return &linesqueak.Hint{Message: "barbazqux"}
 			}
-			return []string{}
+			return nil
 		},
 	}
 
@@ -718,23 +779,19 @@ func TestEditor_LineTabNoCompletionAvailable(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo" {
-		t.Errorf(`expected "foo" got %#v`, l)
+	if l != "f" {
+		t.Errorf(`expected "f" got %#v`, l)
 	}
 }
 
-func TestEditor_LineTabSomeCompletions(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo\t\t\t\t\x0d"))
+func TestEditor_LineHintContext(t *testing.T) {
+	type key struct{}
+
+	in := bytes.NewBuffer([]byte("f\x0d"))
 	out := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
-			"\r> f\x1b[0K\r\x1b[3C",
-			"\r> fo\x1b[0K\r\x1b[4C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
-			"\r> foo bar baz\x1b[0K\r\x1b[13C",
-			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> f\x1b[0;37;49mbar\x1b[0m\x1b[0K\r\x1b[3C",
 		},
 	}
 
@@ -742,18 +799,3297 @@ func TestEditor_LineTabSomeCompletions(t *testing.T) {
 		In:     bufio.NewReader(in),
 		Out:    bufio.NewWriter(out),
 		Prompt: "> ",
-		Complete: func(s string) []string {
-			if s != "foo" {
-				t.Errorf(`expected "foo" got %#v`, s)
+		HintContext: func(ctx context.Context, s string) *linesqueak.Hint {
+			if v := ctx.Value(key{}); v != "session" {
+				t.Errorf(`expected "session" got %#v`, v)
 			}
-			return []string{
-				"foo bar",
-				"foo bar baz",
+			if s == "f" {
+				return &linesqueak.Hint{Message: "bar"}
 			}
+			return nil
 		},
 	}
 
-	l, err := e.Line()
+	l, err := e.LineContext(context.WithValue(context.Background(), key{}, "session"))
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "f" {
+		t.Errorf(`expected "f" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlH(t *testing.T) {
+	in := bytes.NewBuffer([]byte("fooo\x08 bar\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> fooo\x1b[0K\r\x1b[6C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlD(t *testing.T) {
+	{ // with empty buffer
+		in := bytes.NewBuffer([]byte("\x04"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+		}
+
+		l, err := e.Line()
+		if err != io.EOF {
+			t.Error(err)
+		}
+		if l != "" {
+			t.Errorf(`expected "" got %#v`, l)
+		}
+	}
+
+	{ // with non-empty buffer
+		in := bytes.NewBuffer([]byte("fooo\x02\x04 bar\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> f\x1b[0K\r\x1b[3C",
+				"\r> fo\x1b[0K\r\x1b[4C",
+				"\r> foo\x1b[0K\r\x1b[5C",
+				"\r> fooo\x1b[0K\r\x1b[6C",
+				"\r> fooo\x1b[0K\r\x1b[5C",
+				"\r> foo\x1b[0K\r\x1b[5C",
+				"\r> foo \x1b[0K\r\x1b[6C",
+				"\r> foo b\x1b[0K\r\x1b[7C",
+				"\r> foo ba\x1b[0K\r\x1b[8C",
+				"\r> foo bar\x1b[0K\r\x1b[9C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "foo bar" {
+			t.Errorf(`expected "foo bar" got %#v`, l)
+		}
+	}
+}
+
+func TestEditor_LineCtrlT(t *testing.T) {
+	in := bytes.NewBuffer([]byte("fo obra\x14\x02\x02\x02\x02\x14\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> fo \x1b[0K\r\x1b[5C",
+			"\r> fo o\x1b[0K\r\x1b[6C",
+			"\r> fo ob\x1b[0K\r\x1b[7C",
+			"\r> fo obr\x1b[0K\r\x1b[8C",
+			"\r> fo obra\x1b[0K\r\x1b[9C",
+			"\r> fo obar\x1b[0K\r\x1b[9C",
+			"\r> fo obar\x1b[0K\r\x1b[8C",
+			"\r> fo obar\x1b[0K\r\x1b[7C",
+			"\r> fo obar\x1b[0K\r\x1b[6C",
+			"\r> fo obar\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlBCtrlF(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x02\x02\x02\x02\x02\x02\x02\x02\x06\x06\x06\x06\x06\x06\x06\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[7C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> foo bar\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[4C",
+			"\r> foo bar\x1b[0K\r\x1b[3C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> foo bar\x1b[0K\r\x1b[3C",
+			"\r> foo bar\x1b[0K\r\x1b[4C",
+			"\r> foo bar\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> foo bar\x1b[0K\r\x1b[7C",
+			"\r> foo bar\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\a",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlPCtrlN(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x10foo\x0d\x10\x10\x0e\x0ebar\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\a",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> b\x1b[0K\r\x1b[3C",
+			"\r> ba\x1b[0K\r\x1b[4C",
+			"\r> bar\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+
+	e.History.Add("foo")
+
+	l, err = e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "bar" {
+		t.Errorf(`expected "bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlU(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x15\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "" {
+		t.Errorf(`expected "" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlK(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x02\x02\x0b\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[7C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo b" {
+		t.Errorf(`expected "foo b" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlACtrlE(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x01\x05\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlL(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x0c\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\x1b[H\x1b[2J\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlW(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo  bar \x17\x17\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo  \x1b[0K\r\x1b[7C",
+			"\r> foo  b\x1b[0K\r\x1b[8C",
+			"\r> foo  ba\x1b[0K\r\x1b[9C",
+			"\r> foo  bar\x1b[0K\r\x1b[10C",
+			"\r> foo  bar \x1b[0K\r\x1b[11C",
+			"\r> foo  \x1b[0K\r\x1b[7C",
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "" {
+		t.Errorf(`expected "" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlUnderscore(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\x7f\x1f\x1f\x1fbar\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> b\x1b[0K\r\x1b[3C",
+			"\r> ba\x1b[0K\r\x1b[4C",
+			"\r> bar\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "bar" {
+		t.Errorf(`expected "bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlUnderscoreNoChange(t *testing.T) {
+	// Ctrl-K at the end of the line doesn't leave an empty undo step.
+	in := bytes.NewBuffer([]byte("foo\x0b\x1f\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "" {
+		t.Errorf(`expected "" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlXCtrlUCtrlXCtrlR(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x17\x18\x15\x18\x12\x18\x12\x18\x15\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\a",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlWQuoted(t *testing.T) {
+	in := bytes.NewBuffer([]byte("cp 'a b' c\x02\x02\x17\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> c\x1b[0K\r\x1b[3C",
+			"\r> cp\x1b[0K\r\x1b[4C",
+			"\r> cp \x1b[0K\r\x1b[5C",
+			"\r> cp '\x1b[0K\r\x1b[6C",
+			"\r> cp 'a\x1b[0K\r\x1b[7C",
+			"\r> cp 'a \x1b[0K\r\x1b[8C",
+			"\r> cp 'a b\x1b[0K\r\x1b[9C",
+			"\r> cp 'a b'\x1b[0K\r\x1b[10C",
+			"\r> cp 'a b' \x1b[0K\r\x1b[11C",
+			"\r> cp 'a b' c\x1b[0K\r\x1b[12C",
+			"\r> cp 'a b' c\x1b[0K\r\x1b[11C",
+			"\r> cp 'a b' c\x1b[0K\r\x1b[10C",
+			"\r> cp  c\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "cp  c" {
+		t.Errorf(`expected "cp  c" got %#v`, l)
+	}
+}
+
+func TestEditor_LineEscSquareBracket3Tilda(t *testing.T) {
+	in := bytes.NewBuffer([]byte("abc\x02\x02\x1b[3~\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[5C",
+			"\r> abc\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[3C",
+			"\r> ac\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ac" {
+		t.Errorf(`expected "ac" got %#v`, l)
+	}
+}
+
+func TestEditor_LineEscSquareBracketAEscSquareBracketB(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b[Afoo\x0d\x1b[A\x1b[A\x1b[B\x1b[Bbar\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\a",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> b\x1b[0K\r\x1b[3C",
+			"\r> ba\x1b[0K\r\x1b[4C",
+			"\r> bar\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+
+	e.History.Add("foo")
+
+	l, err = e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "bar" {
+		t.Errorf(`expected "bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineHistoryEdits(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b[Ax\x1b[A\x1b[B\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> bar\x1b[0K\r\x1b[5C",
+			"\r> barx\x1b[0K\r\x1b[6C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> barx\x1b[0K\r\x1b[6C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+	e.History.Add("foo")
+	e.History.Add("bar")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "barx" {
+		t.Errorf(`expected "barx" got %#v`, l)
+	}
+	if e.History.Lines[1] != "bar" {
+		t.Errorf(`expected "bar" got %#v`, e.History.Lines[1])
+	}
+}
+
+func TestEditor_LineHistoryPrefixSearch(t *testing.T) {
+	in := bytes.NewBuffer([]byte("ls\x1b[A\x1b[A\x1b[A\x1b[B\x1b[B\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> l\x1b[0K\r\x1b[3C",
+			"\r> ls\x1b[0K\r\x1b[4C",
+			"\r> ls -a\x1b[0K\r\x1b[4C",
+			"\r> ls -l\x1b[0K\r\x1b[4C",
+			"\a",
+			"\r> ls -a\x1b[0K\r\x1b[4C",
+			"\r> ls\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:                  bufio.NewReader(in),
+		Out:                 bufio.NewWriter(out),
+		Prompt:              "> ",
+		HistoryPrefixSearch: true,
+	}
+	e.History.Add("ls -l")
+	e.History.Add("cd /")
+	e.History.Add("ls -a")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ls" {
+		t.Errorf(`expected "ls" got %#v`, l)
+	}
+}
+
+func TestEditor_LineSharedHistory(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b[A\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	s := linesqueak.NewSharedHistory(0)
+	e := &linesqueak.Editor{
+		In:            bufio.NewReader(in),
+		Out:           bufio.NewWriter(out),
+		Prompt:        "> ",
+		SharedHistory: s,
+	}
+
+	// added by another session.
+	s.Add("foo")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+}
+
+func TestEditor_AddHistorySharedSanitize(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b[A\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> ls\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	s := linesqueak.NewSharedHistory(0)
+	e := &linesqueak.Editor{
+		In:            bufio.NewReader(in),
+		Out:           bufio.NewWriter(out),
+		Prompt:        "> ",
+		SharedHistory: s,
+		History: linesqueak.History{
+			Tag: "alice",
+			Sanitize: func(l string) (string, bool) {
+				return l, !strings.Contains(l, "secret")
+			},
+		},
+	}
+
+	e.AddHistory("ls")
+	e.AddHistory("echo secret")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ls" {
+		t.Errorf(`expected "ls" got %#v`, l)
+	}
+
+	// Sanitize survives the sync with SharedHistory.
+	e.AddHistory("export TOKEN=secret")
+
+	h := s.Snapshot()
+	if expected := []string{"ls", ""}; !reflect.DeepEqual(h.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, h.Lines)
+	}
+	if tag := h.Entry(0).Tag; tag != "alice" {
+		t.Errorf(`expected "alice" got %#v`, tag)
+	}
+	if e.History.Tag != "alice" {
+		t.Errorf(`expected "alice" got %#v`, e.History.Tag)
+	}
+}
+
+func TestEditor_LineEscSquareBracketCEscSquareBracketD(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[7C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> foo bar\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[4C",
+			"\r> foo bar\x1b[0K\r\x1b[3C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\a",
+			"\r> foo bar\x1b[0K\r\x1b[3C",
+			"\r> foo bar\x1b[0K\r\x1b[4C",
+			"\r> foo bar\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> foo bar\x1b[0K\r\x1b[7C",
+			"\r> foo bar\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\a",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCtrlArrow(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x1b[1;5D\x1b[1;5D\x1b[1;5C\x1b[1;3D\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\r> foo bar\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineEscSquareBracketHEscSquareBracketF(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x1b[H\x1b[F\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineEscOHEscOF(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x1bOH\x1bOF\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineMetaWord(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo-bar baz\x1bb\x1bb\x1bd\x1bf\x1b\x7fqux\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo-\x1b[0K\r\x1b[6C",
+			"\r> foo-b\x1b[0K\r\x1b[7C",
+			"\r> foo-ba\x1b[0K\r\x1b[8C",
+			"\r> foo-bar\x1b[0K\r\x1b[9C",
+			"\r> foo-bar \x1b[0K\r\x1b[10C",
+			"\r> foo-bar b\x1b[0K\r\x1b[11C",
+			"\r> foo-bar ba\x1b[0K\r\x1b[12C",
+			"\r> foo-bar baz\x1b[0K\r\x1b[13C",
+			"\r> foo-bar baz\x1b[0K\r\x1b[10C",
+			"\r> foo-bar baz\x1b[0K\r\x1b[6C",
+			"\r> foo- baz\x1b[0K\r\x1b[6C",
+			"\r> foo- baz\x1b[0K\r\x1b[10C",
+			"\r> foo- \x1b[0K\r\x1b[7C",
+			"\r> foo- q\x1b[0K\r\x1b[8C",
+			"\r> foo- qu\x1b[0K\r\x1b[9C",
+			"\r> foo- qux\x1b[0K\r\x1b[10C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo- qux" {
+		t.Errorf(`expected "foo- qux" got %#v`, l)
+	}
+}
+
+func TestEditor_LineMetaCase(t *testing.T) {
+	in := bytes.NewBuffer([]byte("fOO bar bAZ\x01\x1bu\x1bc\x1bl\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fO\x1b[0K\r\x1b[4C",
+			"\r> fOO\x1b[0K\r\x1b[5C",
+			"\r> fOO \x1b[0K\r\x1b[6C",
+			"\r> fOO b\x1b[0K\r\x1b[7C",
+			"\r> fOO ba\x1b[0K\r\x1b[8C",
+			"\r> fOO bar\x1b[0K\r\x1b[9C",
+			"\r> fOO bar \x1b[0K\r\x1b[10C",
+			"\r> fOO bar b\x1b[0K\r\x1b[11C",
+			"\r> fOO bar bA\x1b[0K\r\x1b[12C",
+			"\r> fOO bar bAZ\x1b[0K\r\x1b[13C",
+			"\r> fOO bar bAZ\x1b[0K\r\x1b[2C",
+			"\r> FOO bar bAZ\x1b[0K\r\x1b[5C",
+			"\r> FOO Bar bAZ\x1b[0K\r\x1b[9C",
+			"\r> FOO Bar baz\x1b[0K\r\x1b[13C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "FOO Bar baz" {
+		t.Errorf(`expected "FOO Bar baz" got %#v`, l)
+	}
+}
+
+func TestEditor_LineMetaDigit(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b1\x1b2-\x1b3\x1b[D\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r(arg: 1) \x1b[0K\r\x1b[9C",
+			"\r(arg: 12) \x1b[0K\r\x1b[10C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> -\x1b[0K\r\x1b[3C",
+			"\r> --\x1b[0K\r\x1b[4C",
+			"\r> ---\x1b[0K\r\x1b[5C",
+			"\r> ----\x1b[0K\r\x1b[6C",
+			"\r> -----\x1b[0K\r\x1b[7C",
+			"\r> ------\x1b[0K\r\x1b[8C",
+			"\r> -------\x1b[0K\r\x1b[9C",
+			"\r> --------\x1b[0K\r\x1b[10C",
+			"\r> ---------\x1b[0K\r\x1b[11C",
+			"\r> ----------\x1b[0K\r\x1b[12C",
+			"\r> -----------\x1b[0K\r\x1b[13C",
+			"\r> ------------\x1b[0K\r\x1b[14C",
+			"\r(arg: 3) ------------\x1b[0K\r\x1b[21C",
+			"\r> ------------\x1b[0K\r\x1b[14C",
+			"\r> ------------\x1b[0K\r\x1b[13C",
+			"\r> ------------\x1b[0K\r\x1b[12C",
+			"\r> ------------\x1b[0K\r\x1b[11C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "------------" {
+		t.Errorf(`expected "------------" got %#v`, l)
+	}
+}
+
+func TestEditor_LineUniversalArgument(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x15\x15a\x15\x152b\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r(arg: 4) \x1b[0K\r\x1b[9C",
+			"\r(arg: 16) \x1b[0K\r\x1b[10C",
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+	for i := 1; i <= 16; i++ {
+		out.expectations = append(out.expectations, fmt.Sprintf("\r> %s\x1b[0K\r\x1b[%dC", strings.Repeat("a", i), i+2))
+	}
+	out.expectations = append(out.expectations,
+		fmt.Sprintf("\r(arg: 4) %s\x1b[0K\r\x1b[25C", strings.Repeat("a", 16)),
+		fmt.Sprintf("\r(arg: 16) %s\x1b[0K\r\x1b[26C", strings.Repeat("a", 16)),
+		fmt.Sprintf("\r(arg: 2) %s\x1b[0K\r\x1b[25C", strings.Repeat("a", 16)),
+		fmt.Sprintf("\r> %s\x1b[0K\r\x1b[18C", strings.Repeat("a", 16)),
+		fmt.Sprintf("\r> %sb\x1b[0K\r\x1b[19C", strings.Repeat("a", 16)),
+		fmt.Sprintf("\r> %sbb\x1b[0K\r\x1b[20C", strings.Repeat("a", 16)),
+	)
+
+	e := &linesqueak.Editor{
+		In:                bufio.NewReader(in),
+		Out:               bufio.NewWriter(out),
+		Prompt:            "> ",
+		UniversalArgument: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != strings.Repeat("a", 16)+"bb" {
+		t.Errorf(`expected %#v got %#v`, strings.Repeat("a", 16)+"bb", l)
+	}
+}
+
+func TestEditor_LineScrollEllipsis(t *testing.T) {
+	in := bytes.NewBuffer([]byte("abcdefghij\x01\x05\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[5C",
+			"\r> abcd\x1b[0K\r\x1b[6C",
+			"\r> abcde\x1b[0K\r\x1b[7C",
+			"\r> abcdef\x1b[0K\r\x1b[8C",
+			"\r> abcdefg\x1b[0K\r\x1b[9C",
+			"\r> …cdefgh\x1b[0K\r\x1b[9C",
+			"\r> …defghi\x1b[0K\r\x1b[9C",
+			"\r> …efghij\x1b[0K\r\x1b[9C",
+			"\r> abcdefg…\x1b[0K\r\x1b[2C",
+			"\r> …efghij\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:               bufio.NewReader(in),
+		Out:              bufio.NewWriter(out),
+		Prompt:           "> ",
+		Cols:             10,
+		HorizontalScroll: true,
+		ScrollEllipsis:   true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "abcdefghij" {
+		t.Errorf(`expected "abcdefghij" got %#v`, l)
+	}
+}
+
+func TestEditor_LineWide(t *testing.T) {
+	in := bytes.NewBuffer([]byte("あい\x02\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> あ\x1b[0K\r\x1b[4C",
+			"\r> あい\x1b[0K\r\x1b[6C",
+			"\r> あい\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "あい" {
+		t.Errorf(`expected "あい" got %#v`, l)
+	}
+}
+
+func TestEditor_LineAmbiguousWide(t *testing.T) {
+	in := bytes.NewBuffer([]byte("α○\x02\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> α\x1b[0K\r\x1b[4C",
+			"\r> α○\x1b[0K\r\x1b[6C",
+			"\r> α○\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:            bufio.NewReader(in),
+		Out:           bufio.NewWriter(out),
+		Prompt:        "> ",
+		AmbiguousWide: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "α○" {
+		t.Errorf(`expected "α○" got %#v`, l)
+	}
+}
+
+func TestEditor_LineEmojiSequence(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a👩\u200d💻❤\ufe0f\x02\x7f\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> a👩\x1b[0K\r\x1b[5C",
+			"\r> a👩\u200d\x1b[0K\r\x1b[5C",
+			"\r> a👩\u200d💻\x1b[0K\r\x1b[5C",
+			"\r> a👩\u200d💻❤\x1b[0K\r\x1b[6C",
+			"\r> a👩\u200d💻❤️\x1b[0K\r\x1b[7C",
+			"\r> a👩\u200d💻❤️\x1b[0K\r\x1b[5C",
+			"\r> a❤️\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a❤\ufe0f" {
+		t.Errorf(`expected "a❤\ufe0f" got %#v`, l)
+	}
+}
+
+func TestEditor_LineClusters(t *testing.T) {
+	for _, tc := range []struct {
+		title    string
+		in       string
+		expected string
+	}{
+		// Up doesn't land on VS16 of ❤️ and z is inserted before it.
+		{title: "up", in: "❤\ufe0fx\x1b\ra\x1b[Az\x0d", expected: "z❤\ufe0fx\na"},
+		// Ctrl-T swaps é and x as a whole.
+		{title: "swap", in: "e\u0301x\x14\x0d", expected: "xe\u0301"},
+		// Alt-C capitalizes cafés and then bar.
+		{title: "capitalize", in: "cafe\u0301s bar\x01\x1bc\x1bc\x0d", expected: "Cafe\u0301s Bar"},
+		// Alt-B moves to the beginning of cafés.
+		{title: "word", in: "x cafe\u0301s\x1bbz\x0d", expected: "x zcafe\u0301s"},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			e := &linesqueak.Editor{
+				In:     bufio.NewReader(bytes.NewBufferString(tc.in)),
+				Out:    bufio.NewWriter(io.Discard),
+				Prompt: "> ",
+			}
+
+			l, err := e.Line()
+			if err != nil {
+				t.Error(err)
+			}
+			if l != tc.expected {
+				t.Errorf("expected %#v got %#v", tc.expected, l)
+			}
+		})
+	}
+}
+
+func TestEditor_LineBidi(t *testing.T) {
+	in := bytes.NewBuffer([]byte("aאב\x02\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> aא\x1b[0K\r\x1b[4C",
+			"\r> aבא\x1b[0K\r\x1b[5C",
+			"\r> aבא\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Bidi:   linesqueak.BasicBidi,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "aאב" {
+		t.Errorf(`expected "aאב" got %#v`, l)
+	}
+}
+
+func TestEditor_LineInvalidUTF8(t *testing.T) {
+	t.Run("replace", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\xffb\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r\ufffd \x1b[0K\r\x1b[2C",
+				"\r\ufffd a\x1b[0K\r\x1b[3C",
+				"\r\ufffd a\ufffd\x1b[0K\r\x1b[4C",
+				"\r\ufffd a\ufffdb\x1b[0K\r\x1b[5C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "\xfe ",
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a\ufffdb" {
+			t.Errorf(`expected "a\ufffdb" got %#v`, l)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\xffb\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+				"\r> ab\x1b[0K\r\x1b[4C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:          bufio.NewReader(in),
+			Out:         bufio.NewWriter(out),
+			Prompt:      "> ",
+			InvalidUTF8: linesqueak.InvalidUTF8Drop,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "ab" {
+			t.Errorf(`expected "ab" got %#v`, l)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\xffb\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:          bufio.NewReader(in),
+			Out:         bufio.NewWriter(out),
+			Prompt:      "> ",
+			InvalidUTF8: linesqueak.InvalidUTF8Error,
+		}
+
+		l, err := e.Line()
+		if !errors.Is(err, linesqueak.ErrInvalidUTF8) {
+			t.Errorf("expected ErrInvalidUTF8 got %v", err)
+		}
+		if l != "a" {
+			t.Errorf(`expected "a" got %#v`, l)
+		}
+	})
+}
+
+func TestEditor_LineCaretNotation(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x07\u0085\x02\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> a\x1b[7m^G\x1b[27m\x1b[0K\r\x1b[5C",
+			"\r> a\x1b[7m^G\x1b[27m\x1b[7mM-^E\x1b[27m\x1b[0K\r\x1b[9C",
+			"\r> a\x1b[7m^G\x1b[27m\x1b[7mM-^E\x1b[27m\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a\x07\u0085" {
+		t.Errorf(`expected "a\x07\u0085" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabStop(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\tb\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> a» \x1b[0K\r\x1b[5C",
+			"\r> a» b\x1b[0K\r\x1b[6C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:       bufio.NewReader(in),
+		Out:      bufio.NewWriter(out),
+		Prompt:   "> ",
+		TabWidth: 5,
+		ShowTabs: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a\tb" {
+		t.Errorf(`expected "a\tb" got %#v`, l)
+	}
+}
+
+func TestEditor_LineShowWhitespace(t *testing.T) {
+	t.Run("trailing", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a b \x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+				"\r> a\x1b[2m·\x1b[22m\x1b[0K\r\x1b[4C",
+				"\r> a b\x1b[0K\r\x1b[5C",
+				"\r> a b\x1b[2m·\x1b[22m\x1b[0K\r\x1b[6C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:             bufio.NewReader(in),
+			Out:            bufio.NewWriter(out),
+			Prompt:         "> ",
+			ShowWhitespace: linesqueak.WhitespaceTrailing,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a b " {
+			t.Errorf(`expected "a b " got %#v`, l)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\tb c\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+				"\r> a\x1b[2m»\x1b[22m\x1b[0K\r\x1b[4C",
+				"\r> a\x1b[2m»\x1b[22mb\x1b[0K\r\x1b[5C",
+				"\r> a\x1b[2m»\x1b[22mb\x1b[2m·\x1b[22m\x1b[0K\r\x1b[6C",
+				"\r> a\x1b[2m»\x1b[22mb\x1b[2m·\x1b[22mc\x1b[0K\r\x1b[7C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:             bufio.NewReader(in),
+			Out:            bufio.NewWriter(out),
+			Prompt:         "> ",
+			TabWidth:       4,
+			ShowWhitespace: linesqueak.WhitespaceAll,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a\tb c" {
+			t.Errorf(`expected "a\tb c" got %#v`, l)
+		}
+	})
+}
+
+func TestEditor_LineIndicator(t *testing.T) {
+	t.Run("column", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("ab\x02\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\ncol 1/0\x1b[0K\x1b[1A\r\x1b[2C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> a\x1b[0K\r\ncol 2/1\x1b[0K\x1b[1A\r\x1b[3C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> ab\x1b[0K\r\ncol 3/2\x1b[0K\x1b[1A\r\x1b[4C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> ab\x1b[0K\r\ncol 2/2\x1b[0K\x1b[1A\r\x1b[3C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> ab\x1b[0K\r\x1b[3C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:        bufio.NewReader(in),
+			Out:       bufio.NewWriter(out),
+			Prompt:    "> ",
+			Indicator: linesqueak.IndicatorColumn,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "ab" {
+			t.Errorf(`expected "ab" got %#v`, l)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("aあ\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\n0 bytes\x1b[0K\x1b[1A\r\x1b[2C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> a\x1b[0K\r\n1 byte\x1b[0K\x1b[1A\r\x1b[3C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> aあ\x1b[0K\r\n4 bytes\x1b[0K\x1b[1A\r\x1b[5C",
+				"\x1b[1B\x1b[2K\x1b[1A\r> aあ\x1b[0K\r\x1b[5C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:        bufio.NewReader(in),
+			Out:       bufio.NewWriter(out),
+			Prompt:    "> ",
+			Indicator: linesqueak.IndicatorBytes,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "aあ" {
+			t.Errorf(`expected "aあ" got %#v`, l)
+		}
+	})
+}
+
+func TestEditor_LineHorizontalScroll(t *testing.T) {
+	in := bytes.NewBuffer([]byte("abcdefghij\x01\x05\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[5C",
+			"\r> abcd\x1b[0K\r\x1b[6C",
+			"\r> abcde\x1b[0K\r\x1b[7C",
+			"\r> abcdef\x1b[0K\r\x1b[8C",
+			"\r> abcdefg\x1b[0K\r\x1b[9C",
+			"\r> bcdefgh\x1b[0K\r\x1b[9C",
+			"\r> cdefghi\x1b[0K\r\x1b[9C",
+			"\r> defghij\x1b[0K\r\x1b[9C",
+			"\r> abcdefgh\x1b[0K\r\x1b[2C",
+			"\r> defghij\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:               bufio.NewReader(in),
+		Out:              bufio.NewWriter(out),
+		Prompt:           "> ",
+		Cols:             10,
+		HorizontalScroll: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "abcdefghij" {
+		t.Errorf(`expected "abcdefghij" got %#v`, l)
+	}
+}
+
+func TestEditor_LineSynchronizedOutput(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\x1b[?2026h\r> \x1b[0K\r\x1b[2C\x1b[?2026l",
+			"\x1b[?2026h\r> a\x1b[0K\r\x1b[3C\x1b[?2026l",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:                 bufio.NewReader(in),
+		Out:                bufio.NewWriter(out),
+		Prompt:             "> ",
+		SynchronizedOutput: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+}
+
+func TestEditor_LineOnKey(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1b[15~x\x1bb\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> a\x1b[0K\r\x1b[2C",
+		},
+	}
+
+	var keys []linesqueak.KeyEvent
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			keys = append(keys, k)
+			return k.Sequence == "\x1b[15~" || k.Rune == 'x'
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+	if len(keys) != 5 {
+		t.Fatalf("expected 5 got %d", len(keys))
+	}
+	if k := keys[1]; k.Sequence != "\x1b[15~" {
+		t.Errorf("unexpected %#v", k)
+	}
+	if k := keys[3]; k.Rune != 'b' || k.Mod != linesqueak.ModAlt {
+		t.Errorf("unexpected %#v", k)
+	}
+}
+
+func TestEditor_LineBeforeAfterAction(t *testing.T) {
+	in := bytes.NewBuffer([]byte("x\x02\x15\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> ab\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	var vetoed, performed []linesqueak.Action
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		BeforeAction: func(a linesqueak.Action) bool {
+			switch a {
+			case linesqueak.ActionMoveLeft, linesqueak.ActionMoveRight, linesqueak.ActionAcceptLine:
+				return true
+			default:
+				vetoed = append(vetoed, a)
+				return false
+			}
+		},
+		AfterAction: func(a linesqueak.Action) {
+			performed = append(performed, a)
+		},
+	}
+
+	l, err := e.LineWithDefault("ab")
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
+	}
+	expected := []linesqueak.Action{linesqueak.ActionInsert, linesqueak.ActionKillLine}
+	if !reflect.DeepEqual(vetoed, expected) {
+		t.Errorf("expected %#v got %#v", expected, vetoed)
+	}
+	expected = []linesqueak.Action{linesqueak.ActionMoveLeft, linesqueak.ActionAcceptLine}
+	if !reflect.DeepEqual(performed, expected) {
+		t.Errorf("expected %#v got %#v", expected, performed)
+	}
+}
+
+func TestEditor_Do(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x02\x02\x1b[15~\x1b[17~x"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> abc\x1b[0K\r\x1b[5C",
+			"\r> abc\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[3C",
+			"\r> a\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	var e *linesqueak.Editor
+	e = &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			switch k.Key {
+			case linesqueak.KeyF5:
+				if err := e.Do(linesqueak.ActionKillLineForward); err != nil {
+					t.Error(err)
+				}
+				return true
+			case linesqueak.KeyF6:
+				if err := e.Do(linesqueak.ActionAcceptLine); err != nil {
+					t.Error(err)
+				}
+				return true
+			default:
+				return false
+			}
+		},
+	}
+
+	l, err := e.LineWithDefault("abc")
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+}
+
+func TestEditor_DoCommand(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b[17~\x1b[15~\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[6C",
+			"\r> foo BAR\x1b[0K\r\x1b[9C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+		},
+	}
+
+	var e *linesqueak.Editor
+	e = &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Commands: map[string]linesqueak.Command{
+			"shout": func(e *linesqueak.Editor) error {
+				if err := e.Do(linesqueak.ActionMoveWordBackward); err != nil {
+					return err
+				}
+				return e.Do(linesqueak.ActionUpcaseWord)
+			},
+		},
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			var name string
+			switch k.Key {
+			case linesqueak.KeyF5:
+				name = "backward-kill-word"
+			case linesqueak.KeyF6:
+				name = "shout"
+			default:
+				return false
+			}
+			if err := e.DoCommand(name); err != nil {
+				t.Error(err)
+			}
+			return true
+		},
+	}
+
+	l, err := e.LineWithDefault("foo bar")
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo " {
+		t.Errorf(`expected "foo " got %#v`, l)
+	}
+
+	if err := e.DoCommand("no-such-command"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestActionByName(t *testing.T) {
+	for _, n := range linesqueak.ActionNames() {
+		a, ok := linesqueak.ActionByName(n)
+		if !ok {
+			t.Errorf("%s not found", n)
+		}
+		if a.String() != n {
+			t.Errorf("expected %s got %s", n, a)
+		}
+	}
+
+	a, ok := linesqueak.ActionByName("backward-kill-word")
+	if !ok || a != linesqueak.ActionKillWordBackward {
+		t.Errorf("unexpected %v", a)
+	}
+}
+
+func TestEditor_LineKeymap(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x1bb\x18\x13\x18\x01x\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar\x1b[0K\r\x1b[2C",
+			"\r> xfoo bar\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	var saved int
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Keymap: linesqueak.Keymap{
+			linesqueak.KeyEsc: {Keymap: linesqueak.Keymap{
+				linesqueak.Key('b'): {Action: linesqueak.ActionMoveHome},
+			}},
+			linesqueak.KeyCtrlX: {Keymap: linesqueak.Keymap{
+				linesqueak.KeyCtrlS: {Command: "save"},
+			}},
+		},
+		Commands: map[string]linesqueak.Command{
+			"save": func(e *linesqueak.Editor) error {
+				saved++
+				return nil
+			},
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "xfoo bar" {
+		t.Errorf(`expected "xfoo bar" got %#v`, l)
+	}
+	if saved != 1 {
+		t.Errorf("expected 1 got %d", saved)
+	}
+}
+
+func TestEditor_LineKeymapTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go func() {
+		_, _ = w.Write([]byte("\x18"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("\x15a\x0d"))
+	}()
+
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> b\x1b[0K\r\x1b[3C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:            bufio.NewReader(r),
+		Out:           bufio.NewWriter(out),
+		Prompt:        "> ",
+		KeymapTimeout: 10 * time.Millisecond,
+	}
+
+	l, err := e.LineWithDefault("b")
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+}
+
+func TestEditor_LineAutoClose(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f(x) \"(\" it's\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> f()\x1b[0K\r\x1b[4C",
+			"\r> f(x)\x1b[0K\r\x1b[5C",
+			"\r> f(x)\x1b[0K\r\x1b[6C",
+			"\r> f(x) \x1b[0K\r\x1b[7C",
+			"\r> f(x) \"\"\x1b[0K\r\x1b[8C",
+			"\r> f(x) \"(\"\x1b[0K\r\x1b[9C",
+			"\r> f(x) \"(\"\x1b[0K\r\x1b[10C",
+			"\r> f(x) \"(\" \x1b[0K\r\x1b[11C",
+			"\r> f(x) \"(\" i\x1b[0K\r\x1b[12C",
+			"\r> f(x) \"(\" it\x1b[0K\r\x1b[13C",
+			"\r> f(x) \"(\" it'\x1b[0K\r\x1b[14C",
+			"\r> f(x) \"(\" it's\x1b[0K\r\x1b[15C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:        bufio.NewReader(in),
+		Out:       bufio.NewWriter(out),
+		Prompt:    "> ",
+		AutoClose: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "f(x) \"(\" it's" {
+		t.Errorf(`expected "f(x) \"(\" it's" got %#v`, l)
+	}
+}
+
+func TestEditor_LineAutoIndent(t *testing.T) {
+	t.Run("auto indent", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\x1b\r  b\x1b\rc\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+				"\r> a\x1b[0K\r\n\x1b[0K\r",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n \x1b[0K\r\x1b[1C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n  \x1b[0K\r\x1b[2C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n  b\x1b[0K\r\x1b[3C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n  b\x1b[0K\r\n  \x1b[0K\r\x1b[2C",
+				"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\n  b\x1b[0K\r\n  c\x1b[0K\r\x1b[3C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:         bufio.NewReader(in),
+			Out:        bufio.NewWriter(out),
+			Prompt:     "> ",
+			AutoIndent: true,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a\n  b\n  c" {
+			t.Errorf(`expected "a\n  b\n  c" got %#v`, l)
+		}
+	})
+
+	t.Run("indent", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("f {\rx\r}\r"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> f\x1b[0K\r\x1b[3C",
+				"\r> f \x1b[0K\r\x1b[4C",
+				"\r> f {\x1b[0K\r\x1b[5C",
+				"\r> f {\x1b[0K\r\n  \x1b[0K\r\x1b[2C",
+				"\x1b[2K\x1b[1A\r> f {\x1b[0K\r\n  x\x1b[0K\r\x1b[3C",
+				"\x1b[2K\x1b[1A\r> f {\x1b[0K\r\n  x\x1b[0K\r\n  \x1b[0K\r\x1b[2C",
+				"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> f {\x1b[0K\r\n  x\x1b[0K\r\n  }\x1b[0K\r\x1b[3C",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+			Validate: func(s string) error {
+				if strings.Count(s, "{") > strings.Count(s, "}") {
+					return linesqueak.ErrIncomplete
+				}
+				return nil
+			},
+			Indent: func(s string, pos int) string {
+				return strings.Repeat("  ", strings.Count(s[:pos], "{")-strings.Count(s[:pos], "}"))
+			},
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "f {\n  x\n  }" {
+			t.Errorf(`expected "f {\n  x\n  }" got %#v`, l)
+		}
+	})
+}
+
+func TestEditor_LineInsertComment(t *testing.T) {
+	in := bytes.NewBuffer([]byte("ls\x1b#"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> l\x1b[0K\r\x1b[3C",
+			"\r> ls\x1b[0K\r\x1b[4C",
+			"\r> #ls\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "#ls" {
+		t.Errorf(`expected "#ls" got %#v`, l)
+	}
+}
+
+func TestEditor_LineOnAccept(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x0d ll \x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> \x1b[0K\r\nempty\x1b[0K\x1b[1A\r\x1b[2C",
+			"\a",
+			"\x1b[1B\x1b[2K\x1b[1A\r>  \x1b[0K\r\x1b[3C",
+			"\r>  l\x1b[0K\r\x1b[4C",
+			"\r>  ll\x1b[0K\r\x1b[5C",
+			"\r>  ll \x1b[0K\r\x1b[6C",
+			"\r> ls -l\x1b[0K\r\x1b[7C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnAccept: func(s string) (string, error) {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				return "", errors.New("empty")
+			}
+			if s == "ll" {
+				s = "ls -l"
+			}
+			return s, nil
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ls -l" {
+		t.Errorf(`expected "ls -l" got %#v`, l)
+	}
+}
+
+func TestEditor_LineOnAcceptWrite(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r\x1b[0Kaccepting a\r\n",
+			"\r> a\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	var e *linesqueak.Editor
+	e = &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnAccept: func(s string) (string, error) {
+			_, err := e.Write([]byte("accepting " + s))
+			return s, err
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+}
+
+func TestEditor_LineEscapeTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go func() {
+		_, _ = w.Write([]byte("a\x1b"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("b\x1bb\x0d"))
+	}()
+
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> ab\x1b[0K\r\x1b[2C",
+		},
+	}
+
+	var escapes int
+	e := &linesqueak.Editor{
+		In:            bufio.NewReader(r),
+		Out:           bufio.NewWriter(out),
+		Prompt:        "> ",
+		EscapeTimeout: 10 * time.Millisecond,
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			if k.Key == linesqueak.KeyEsc && k.Mod == 0 {
+				escapes++
+			}
+			return false
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
+	}
+	if escapes != 1 {
+		t.Errorf("expected 1 got %d", escapes)
+	}
+}
+
+func TestEditor_LineEscapeTimeoutConn(t *testing.T) {
+	// the deadline of EscapeTimeout on Conn isn't taken for IdleTimeout.
+	for i := 0; i < 20; i++ {
+		client, server := net.Pipe()
+
+		e := &linesqueak.Editor{
+			In:            bufio.NewReader(server),
+			Out:           bufio.NewWriter(io.Discard),
+			Conn:          server,
+			Prompt:        "> ",
+			EscapeTimeout: time.Millisecond,
+		}
+
+		go func() {
+			_, _ = client.Write([]byte("x\x1b"))
+			time.Sleep(5 * time.Millisecond)
+			_, _ = client.Write([]byte("\r"))
+		}()
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "x" {
+			t.Errorf(`expected "x" got %#v`, l)
+		}
+
+		_ = client.Close()
+		_ = server.Close()
+	}
+}
+
+func TestEditor_LineSearch(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x12foo\x12\x13\x0d\x12\x12\x07x\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r(reverse-i-search)`': \x1b[0K\r\x1b[22C",
+			"\r(reverse-i-search)`f': \x1b[4mf\x1b[24moo 2\x1b[0K\r\x1b[23C",
+			"\r(reverse-i-search)`fo': \x1b[4mfo\x1b[24mo 2\x1b[0K\r\x1b[24C",
+			"\r(reverse-i-search)`foo': \x1b[4mfoo\x1b[24m 2\x1b[0K\r\x1b[25C",
+			"\r(reverse-i-search)`foo': \x1b[4mfoo\x1b[24m 1\x1b[0K\r\x1b[25C",
+			"\r(i-search)`foo': \x1b[4mfoo\x1b[24m 2\x1b[0K\r\x1b[17C",
+			"\r> foo 2\x1b[0K\r\x1b[2C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r(reverse-i-search)`': \x1b[0K\r\x1b[22C",
+			"\r(reverse-i-search)`foo': \x1b[4mfoo\x1b[24m 2\x1b[0K\r\x1b[25C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> x\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+	e.History.Add("foo 1")
+	e.History.Add("bar")
+	e.History.Add("foo 2")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo 2" {
+		t.Errorf(`expected "foo 2" got %#v`, l)
+	}
+
+	l, err = e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "x" {
+		t.Errorf(`expected "x" got %#v`, l)
+	}
+}
+
+func TestEditor_LineHistorySubstring(t *testing.T) {
+	in := bytes.NewBuffer([]byte("it\x1bp\x1bp\x1bn\x1bp\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> i\x1b[0K\r\x1b[3C",
+			"\r> it\x1b[0K\r\x1b[4C",
+			"\r> git push\x1b[0K\r\x1b[5C",
+			"\r> git commit\x1b[0K\r\x1b[5C",
+			"\r> git push\x1b[0K\r\x1b[5C",
+			"\r> git commit\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+	e.History.Add("git commit")
+	e.History.Add("ls")
+	e.History.Add("go build")
+	e.History.Add("git push")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "git commit" {
+		t.Errorf(`expected "git commit" got %#v`, l)
+	}
+}
+
+func TestEditor_LineHistoryMenu(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1bOQ\x1b[A3\x0dx\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> \x1b[0K\r\n> 1  c\x1b[0K\r\n  2  b\x1b[0K\r\n  3  a\x1b[0K\x1b[3A\r\x1b[2C",
+			"\x1b[3B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> \x1b[0K\r\n  1  c\x1b[0K\r\n> 2  b\x1b[0K\r\n  3  a\x1b[0K\x1b[3A\r\x1b[2C",
+			"\x1b[3B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> \x1b[0K\r\n  1  c\x1b[0K\r\n  2  b\x1b[0K\r\n> 3  a\x1b[0K\x1b[3A\r\x1b[2C",
+			"\x1b[3B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\x1b[3C",
+			"\r> ax\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Keymap: linesqueak.Keymap{
+			linesqueak.KeyF2: {Action: linesqueak.ActionHistoryMenu},
+		},
+	}
+	e.History.Add("a")
+	e.History.Add("b")
+	e.History.Add("c")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ax" {
+		t.Errorf(`expected "ax" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCompleteFromHistory(t *testing.T) {
+	in := bytes.NewBuffer([]byte("gi\t\t\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> g\x1b[0K\r\x1b[3C",
+			"\r> gi\x1b[0K\r\x1b[4C",
+			"\r> git commit\x1b[0K\r\x1b[12C",
+			"\r> git push\x1b[0K\r\x1b[10C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:                  bufio.NewReader(in),
+		Out:                 bufio.NewWriter(out),
+		Prompt:              "> ",
+		CompleteFromHistory: true,
+	}
+	e.History.Add("git commit")
+	e.History.Add("ls")
+	e.History.Add("git push")
+	e.History.Add("git commit")
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "git push" {
+		t.Errorf(`expected "git push" got %#v`, l)
+	}
+}
+
+func TestEditor_LineFunctionKeys(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1b[5~\x1b[6~\x1bOP\x1b[24~\x1b[Zb\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	var keys []linesqueak.Key
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			if k.Sequence != "" {
+				keys = append(keys, k.Key)
+			}
+			return false
+		},
+		OnUnknownSequence: func(seq string) {
+			t.Errorf("unexpected %#v", seq)
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
+	}
+	expected := []linesqueak.Key{linesqueak.KeyPageUp, linesqueak.KeyPageDown, linesqueak.KeyF1, linesqueak.KeyF12, linesqueak.KeyShiftTab}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %#v got %#v", expected, keys)
+	}
+}
+
+func TestEditor_LineKeyEventMod(t *testing.T) {
+	in := bytes.NewBuffer([]byte("\x1b[1;5P\x1bO2S\x1b[5;3~\x1b\x02\x01\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+
+	type key struct {
+		key linesqueak.Key
+		r   rune
+		mod linesqueak.Mod
+	}
+	var keys []key
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			keys = append(keys, key{key: k.Key, r: k.Rune, mod: k.Mod})
+			return k.Key != linesqueak.KeyEnter
+		},
+	}
+
+	if _, err := e.Line(); err != nil {
+		t.Error(err)
+	}
+	expected := []key{
+		{key: linesqueak.KeyF1, mod: linesqueak.ModCtrl},
+		{key: linesqueak.KeyF4, mod: linesqueak.ModShift},
+		{key: linesqueak.KeyPageUp, mod: linesqueak.ModAlt},
+		{key: linesqueak.KeyCtrlB, r: '\x02', mod: linesqueak.ModAlt},
+		{key: linesqueak.KeyCtrlA, r: '\x01'},
+		{key: linesqueak.KeyEnter, r: '\r'},
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %#v got %#v", expected, keys)
+	}
+}
+
+func TestEditor_LineOnUnknownSequence(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1b[1;2$x\x1b[99~\x1bO5xb\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	var seqs []string
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnUnknownSequence: func(seq string) {
+			seqs = append(seqs, seq)
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ab" {
+		t.Errorf(`expected "ab" got %#v`, l)
+	}
+	expected := []string{"\x1b[1;2$x", "\x1b[99~", "\x1bO5x"}
+	if !reflect.DeepEqual(seqs, expected) {
+		t.Errorf("expected %#v got %#v", expected, seqs)
+	}
+}
+
+func TestEditor_LineEscSquareBracketInterrupted(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1b[1\x1bbc\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> a\x1b[0K\r\x1b[2C",
+			"\r> ca\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	var seqs []string
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		OnUnknownSequence: func(seq string) {
+			seqs = append(seqs, seq)
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ca" {
+		t.Errorf(`expected "ca" got %#v`, l)
+	}
+	if len(seqs) != 1 || seqs[0] != "\x1b[1" {
+		t.Errorf("unexpected %#v", seqs)
+	}
+}
+
+func TestEditor_LineEscOInterrupted(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1bO\x03b\x0d"))
+
+	var seqs []string
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(io.Discard),
+		Prompt: "> ",
+		OnUnknownSequence: func(seq string) {
+			seqs = append(seqs, seq)
+		},
+	}
+
+	l, err := e.Line()
+	if !errors.Is(err, linesqueak.ErrInterrupt) {
+		t.Errorf("expected ErrInterrupt got %v", err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+	if len(seqs) != 1 || seqs[0] != "\x1bO" {
+		t.Errorf("unexpected %#v", seqs)
+	}
+}
+
+func TestEditor_LineEscOTooLong(t *testing.T) {
+	in := bytes.NewBufferString("\x1bO" + strings.Repeat("1", 200000) + "Pa\x0d")
+
+	var seq string
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(io.Discard),
+		Prompt: "> ",
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			if k.Key == linesqueak.KeyF1 {
+				seq = k.Sequence
+			}
+			return false
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+	if seq == "" || len(seq) > 64 {
+		t.Errorf("expected F1 of at most 64 bytes got %d bytes", len(seq))
+	}
+}
+
+func TestEditor_LineMultiline(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\x1b\x0dba\x10\x06\x0e\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo\x1b[0K\r\n. \x1b[0K\r\x1b[2C",
+			"\x1b[2K\x1b[1A\r> foo\x1b[0K\r\n. b\x1b[0K\r\x1b[3C",
+			"\x1b[2K\x1b[1A\r> foo\x1b[0K\r\n. ba\x1b[0K\r\x1b[4C",
+			"\x1b[2K\x1b[1A\r> foo\x1b[0K\r\n. ba\x1b[0K\x1b[1A\r\x1b[4C",
+			"\x1b[1B\x1b[2K\x1b[1A\r> foo\x1b[0K\r\n. ba\x1b[0K\x1b[1A\r\x1b[5C",
+			"\x1b[1B\x1b[2K\x1b[1A\r> foo\x1b[0K\r\n. ba\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:                 bufio.NewReader(in),
+		Out:                bufio.NewWriter(out),
+		Prompt:             "> ",
+		ContinuationPrompt: ". ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo\nba" {
+		t.Errorf(`expected "foo\nba" got %#v`, l)
+	}
+}
+
+func TestEditor_LineContinuationPromptFunc(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1b\x0db\x1b\x0dc\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> a\x1b[0K\r\n\x1b[1m2>\x1b[0m \x1b[0K\r\x1b[3C",
+			"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n\x1b[1m2>\x1b[0m b\x1b[0K\r\x1b[4C",
+			"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n\x1b[1m2>\x1b[0m b\x1b[0K\r\n\x1b[1m3>\x1b[0m \x1b[0K\r\x1b[3C",
+			"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\n\x1b[1m2>\x1b[0m b\x1b[0K\r\n\x1b[1m3>\x1b[0m c\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		ContinuationPromptFunc: func(line int) string {
+			return fmt.Sprintf("\x1b[1m%d>\x1b[0m ", line)
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a\nb\nc" {
+		t.Errorf(`expected "a\nb\nc" got %#v`, l)
+	}
+}
+
+func TestEditor_LineLineNumbers(t *testing.T) {
+	t.Run("absolute", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\x1b\x0db\x1b\x0dc\x10\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+				"\r> a\x1b[0K\r\n2 . \x1b[0K\r\x1b[4C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n2 . b\x1b[0K\r\x1b[5C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n2 . b\x1b[0K\r\n3 . \x1b[0K\r\x1b[4C",
+				"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\n2 . b\x1b[0K\r\n3 . c\x1b[0K\r\x1b[5C",
+				"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\n2 . b\x1b[0K\r\n3 . c\x1b[0K\x1b[1A\r\x1b[5C",
+				"\x1b[1B\r",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:                 bufio.NewReader(in),
+			Out:                bufio.NewWriter(out),
+			Prompt:             "> ",
+			ContinuationPrompt: ". ",
+			LineNumbers:        linesqueak.LineNumbersAbsolute,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a\nb\nc" {
+			t.Errorf(`expected "a\nb\nc" got %#v`, l)
+		}
+	})
+
+	t.Run("relative", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("a\x1b\x0db\x1b\x0dc\x10\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\r> \x1b[0K\r\x1b[2C",
+				"\r> a\x1b[0K\r\x1b[3C",
+				"\r> a\x1b[0K\r\n2 . \x1b[0K\r\x1b[4C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n2 . b\x1b[0K\r\x1b[5C",
+				"\x1b[2K\x1b[1A\r> a\x1b[0K\r\n1 . b\x1b[0K\r\n3 . \x1b[0K\r\x1b[4C",
+				"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\n1 . b\x1b[0K\r\n3 . c\x1b[0K\r\x1b[5C",
+				"\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> a\x1b[0K\r\n2 . b\x1b[0K\r\n1 . c\x1b[0K\x1b[1A\r\x1b[5C",
+				"\x1b[1B\r",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:                 bufio.NewReader(in),
+			Out:                bufio.NewWriter(out),
+			Prompt:             "> ",
+			ContinuationPrompt: ". ",
+			LineNumbers:        linesqueak.LineNumbersRelative,
+		}
+
+		l, err := e.Line()
+		if err != nil {
+			t.Error(err)
+		}
+		if l != "a\nb\nc" {
+			t.Errorf(`expected "a\nb\nc" got %#v`, l)
+		}
+	})
+}
+
+func TestEditor_LineWrap(t *testing.T) {
+	in := bytes.NewBuffer([]byte("abcd\x02\x02\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\n\r\r",
+			"\x1b[2K\x1b[1A\r> abcd\x1b[0K\r\x1b[1C",
+			"\x1b[2K\x1b[1A\r> abcd\x1b[0K\r",
+			"\x1b[2K\x1b[1A\r> abcd\x1b[0K\x1b[1A\r\x1b[4C",
+			"\x1b[1B\r",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Cols:   5,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "abcd" {
+		t.Errorf(`expected "abcd" got %#v`, l)
+	}
+}
+
+func TestEditor_LineValidate(t *testing.T) {
+	in := bytes.NewBuffer([]byte("(\x0d)\x0d\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> (\x1b[0K\r\x1b[3C",
+			"\r> (\x1b[0K\r\n\x1b[0K\r",
+			"\x1b[2K\x1b[1A\r> (\x1b[0K\r\n)\x1b[0K\r\x1b[1C",
+			"\x1b[2K\x1b[1A\r> (\x1b[0K\r\n)\x1b[0K\r\ntry again\x1b[0K\x1b[1A\r\x1b[1C",
+			"\a",
+			"\x1b[1B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> (\x1b[0K\r\n)\x1b[0K\r\x1b[1C",
+		},
+	}
+
+	var retried bool
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Validate: func(s string) error {
+			switch s {
+			case "(":
+				return linesqueak.ErrIncomplete
+			case "(\n)":
+				if !retried {
+					retried = true
+					return errors.New("try again")
+				}
+			}
+			return nil
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "(\n)" {
+		t.Errorf(`expected "(\n)" got %#v`, l)
+	}
+}
+
+func TestEditor_LineBracketedPaste(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x1b[200~b\r\nc\x1b[201~\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\x1b[?2004h\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab c\x1b[0K\r\x1b[6C",
+			"\x1b[?2004l",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:             bufio.NewReader(in),
+		Out:            bufio.NewWriter(out),
+		Prompt:         "> ",
+		BracketedPaste: true,
+		OnPaste: func(s string) string {
+			if s != "b\nc" {
+				t.Errorf(`expected "b\nc" got %#v`, s)
+			}
+			return strings.Replace(s, "\n", " ", -1)
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "ab c" {
+		t.Errorf(`expected "ab c" got %#v`, l)
+	}
+}
+
+func TestEditor_LineBracketedPasteTooLong(t *testing.T) {
+	// the paste which doesn't end is cut off and the rest is typed.
+	in := bytes.NewBufferString("\x1b[200~" + strings.Repeat("a", 1<<20) + "b\x0d")
+
+	e := &linesqueak.Editor{
+		In:             bufio.NewReader(in),
+		Out:            bufio.NewWriter(io.Discard),
+		Prompt:         "> ",
+		BracketedPaste: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if expected := strings.Repeat("a", 1<<20) + "b"; l != expected {
+		t.Errorf("expected %d runes got %d", len(expected), len(l))
+	}
+}
+
+func TestEditor_LineClipboard(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x1bw\x17\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\x1b]52;c;Zm9vIGJhcg==\a",
+			"\x1b]52;c;YmFy\a\r> foo \x1b[0K\r\x1b[6C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:        bufio.NewReader(in),
+		Out:       bufio.NewWriter(out),
+		Prompt:    "> ",
+		Clipboard: true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo " {
+		t.Errorf(`expected "foo " got %#v`, l)
+	}
+}
+
+func TestEditor_LineMouse(t *testing.T) {
+	in := bytes.NewBuffer([]byte("abc\x1b[<0;4;5M\x1b[5;1R\x1b[<0;4;5M\x1b[<0;4;5mx\x1b[<64;1;1M\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\x1b[?1000h\x1b[?1006h\x1b[6n\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[5C",
+			"\r> abc\x1b[0K\r\x1b[3C",
+			"\r> axbc\x1b[0K\r\x1b[4C",
+			"\a",
+			"\x1b[?1006l\x1b[?1000l",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Mouse:  true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "axbc" {
+		t.Errorf(`expected "axbc" got %#v`, l)
+	}
+}
+
+func TestEditor_LineMouseOutside(t *testing.T) {
+	// clicks above and below the user input are ignored.
+	in := bytes.NewBuffer([]byte("abc\x1b[5;1R\x1b[<0;2;4M\x1b[<0;2;6M\x1b[<0;3;5Mx\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\x1b[?1000h\x1b[?1006h\x1b[6n\r> \x1b[0K\r\x1b[2C",
+			"\r> a\x1b[0K\r\x1b[3C",
+			"\r> ab\x1b[0K\r\x1b[4C",
+			"\r> abc\x1b[0K\r\x1b[5C",
+			"\r> abc\x1b[0K\r\x1b[2C",
+			"\r> xabc\x1b[0K\r\x1b[3C",
+			"\x1b[?1006l\x1b[?1000l",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Mouse:  true,
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "xabc" {
+		t.Errorf(`expected "xabc" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabNoCompleteFunc(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\t\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo   \x1b[0K\r\x1b[8C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo\t" {
+		t.Errorf(`expected "foo\t" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabNoCompletionAvailable(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\t\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\a",
+			"\r> foo\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Complete: func(s string) []string {
+			if s != "foo" {
+				t.Errorf(`expected "foo" got %#v`, s)
+			}
+			return []string{}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabSomeCompletions(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\t\t\t\t\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo bar baz\x1b[0K\r\x1b[13C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Complete: func(s string) []string {
+			if s != "foo" {
+				t.Errorf(`expected "foo" got %#v`, s)
+			}
+			return []string{
+				"foo bar",
+				"foo bar baz",
+			}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar" {
+		t.Errorf(`expected "foo bar" got %#v`, l)
+	}
+}
+
+func TestEditor_LineShiftTabCompletions(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\t\x1b[Z\x1b[Z\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo bar baz\x1b[0K\r\x1b[13C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Complete: func(s string) []string {
+			return []string{
+				"foo bar",
+				"foo bar baz",
+			}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo bar baz" {
+		t.Errorf(`expected "foo bar baz" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabCompletionPrefix(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\t\t\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo\x1b[0K\r\nfoo bar  foobaz\x1b[0K\x1b[1A\r\x1b[5C",
+			"\x1b[1B\x1b[2K\x1b[1A\r> foo\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:             bufio.NewReader(in),
+		Out:            bufio.NewWriter(out),
+		Prompt:         "> ",
+		CompletionMode: linesqueak.CompletionPrefix,
+		Complete: func(s string) []string {
+			return []string{
+				"foo bar",
+				"foobaz",
+			}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+}
+
+func TestEditor_LineListCandidates(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\x1b?\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> f\x1b[0K\r\nfoo     fool\x1b[0K\r\nfoobar  foot\x1b[0K\r\nfoobaz\x1b[0K\x1b[3A\r\x1b[3C",
+			"\x1b[3B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> f\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Cols:   20,
+		Complete: func(s string) []string {
+			return []string{"foo", "foobar", "foobaz", "fool", "foot"}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "f" {
+		t.Errorf(`expected "f" got %#v`, l)
+	}
+}
+
+func TestEditor_LineListCandidatesPaged(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\x1b?y\x0d \x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> f\x1b[0K\r\nDisplay all 7 possibilities? (y or n)\x1b[0K\x1b[4A\r\x1b[3C",
+			"\x1b[4B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> f\x1b[0K\r\nfoo01\x1b[0K\r\nfoo02\x1b[0K\r\nfoo03\x1b[0K\r\n--More--\x1b[0K\x1b[4A\r\x1b[3C",
+			"\x1b[4B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> f\x1b[0K\r\nfoo02\x1b[0K\r\nfoo03\x1b[0K\r\nfoo04\x1b[0K\r\n--More--\x1b[0K\x1b[4A\r\x1b[3C",
+			"\x1b[4B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> f\x1b[0K\r\nfoo05\x1b[0K\r\nfoo06\x1b[0K\r\nfoo07\x1b[0K\x1b[3A\r\x1b[3C",
+			"\x1b[3B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> f\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:                   bufio.NewReader(in),
+		Out:                  bufio.NewWriter(out),
+		Prompt:               "> ",
+		Cols:                 10,
+		Rows:                 5,
+		CompletionQueryItems: 5,
+		Complete: func(s string) []string {
+			return []string{"foo01", "foo02", "foo03", "foo04", "foo05", "foo06", "foo07"}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "f" {
+		t.Errorf(`expected "f" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCompleteFilterSort(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\x1b?\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> f\x1b[0K\r\nfoobar  foo\x1b[0K\x1b[1A\r\x1b[3C",
+			"\x1b[1B\x1b[2K\x1b[1A\r> f\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Complete: func(s string) []string {
+			return []string{"foo", "fool", "foobar"}
+		},
+		CompleteFilter: func(c linesqueak.Candidate) bool {
+			return c.InsertText != "fool"
+		},
+		CompleteSort: func(a, b linesqueak.Candidate) bool {
+			return len(a.InsertText) > len(b.InsertText)
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "f" {
+		t.Errorf(`expected "f" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCompletionKeys(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\t\x1b[B\x0dx\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> far\x1b[0K\r\x1b[5C",
+			"\r> farx\x1b[0K\r\x1b[6C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Complete: func(s string) []string {
+			return []string{"foo", "far"}
+		},
+		CompletionKeys: linesqueak.CompletionKeys{
+			Next:   []linesqueak.Key{linesqueak.KeyTab, linesqueak.KeyDown},
+			Accept: []linesqueak.Key{linesqueak.KeyEnter},
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "farx" {
+		t.Errorf(`expected "farx" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCompletionKeysPrintable(t *testing.T) {
+	in := bytes.NewBuffer([]byte("f\tn \x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> far\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Complete: func(s string) []string {
+			return []string{"foo", "far"}
+		},
+		CompletionKeys: linesqueak.CompletionKeys{
+			Next:   []linesqueak.Key{linesqueak.KeyTab, linesqueak.Key('n')},
+			Accept: []linesqueak.Key{linesqueak.Key(' ')},
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "far" {
+		t.Errorf(`expected "far" got %#v`, l)
+	}
+}
+
+func TestEditor_LineCompleteAt(t *testing.T) {
+	in := bytes.NewBuffer([]byte("fo\x02\tx\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> fo\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\nconnection refused\x1b[0K\x1b[1A\r\x1b[3C",
+			"\a",
+			"\x1b[1B\x1b[2K\x1b[1A\r> fxo\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		CompleteAt: func(s string, pos int) ([]linesqueak.Candidate, error) {
+			if s != "fo" || pos != 1 {
+				t.Errorf(`expected "fo" at 1 got %#v at %d`, s, pos)
+			}
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "fxo" {
+		t.Errorf(`expected "fxo" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabCompleteCandidates(t *testing.T) {
+	in := bytes.NewBuffer([]byte("c\t\t\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> c\x1b[0K\r\x1b[3C",
+			"\a",
+			"\r> c\x1b[0K\r\nconnect  open a session\x1b[0K\r\nclose    close the session\x1b[0K\x1b[2A\r\x1b[3C",
+			"\x1b[2B\x1b[2K\x1b[1A\x1b[2K\x1b[1A\r> c\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:             bufio.NewReader(in),
+		Out:            bufio.NewWriter(out),
+		Prompt:         "> ",
+		CompletionMode: linesqueak.CompletionPrefix,
+		CompleteCandidates: func(s string) []linesqueak.Candidate {
+			return []linesqueak.Candidate{
+				{InsertText: "connect ", Display: "connect", Description: "open a session"},
+				{InsertText: "close ", Display: "close", Description: "close the session"},
+			}
+		},
+	}
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "c" {
+		t.Errorf(`expected "c" got %#v`, l)
+	}
+}
+
+func TestEditor_LineTabCompleteContext(t *testing.T) {
+	r, w := io.Pipe()
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> f\x1b[0K\r\ncompleting…\x1b[0K\x1b[1A\r\x1b[3C",
+			"\x1b[1B\x1b[2K\x1b[1A\r> f\x1b[0K\r\x1b[3C",
+			"\r> fx\x1b[0K\r\x1b[4C",
+		},
+	}
+
+	cancelled := make(chan struct{})
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(r),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		CompleteContext: func(ctx context.Context, s string) []linesqueak.Candidate {
+			<-ctx.Done()
+			close(cancelled)
+			return []linesqueak.Candidate{{InsertText: "foo"}}
+		},
+	}
+
+	go func() {
+		if _, err := w.Write([]byte("f\t")); err != nil {
+			t.Error(err)
+		}
+		if _, err := w.Write([]byte("x\x0d")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "fx" {
+		t.Errorf(`expected "fx" got %#v`, l)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("expected CompleteContext to be cancelled")
+	}
+}
+
+func TestEditor_LineHint(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo bar\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo \x1b[0;37;49mbar\x1b[0m\x1b[0K\r\x1b[6C",
+			"\r> foo b\x1b[0K\r\x1b[7C",
+			"\r> foo ba\x1b[0K\r\x1b[8C",
+			"\r> foo bar\x1b[0K\r\x1b[9C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Hint: func(s string) *linesqueak.Hint {
+			if s == "foo " {
+				return &linesqueak.Hint{
+					Message: "bar",
+				}
+			}
+
+			return nil
+		},
+	}
+
+	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
@@ -762,29 +4098,126 @@ func TestEditor_LineTabSomeCompletions(t *testing.T) {
 	}
 }
 
-func TestEditor_LineHint(t *testing.T) {
-	in := bytes.NewBuffer([]byte("foo bar\x0d"))
-	out := &checkedWriter{
+func TestEditor_LineContext(t *testing.T) {
+	r, w := io.Pipe()
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(r),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := e.LineContext(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled got %v", err)
+	}
+
+	go func() {
+		if _, err := w.Write([]byte("foo\x0d")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+}
+
+func TestEditor_Resize(t *testing.T) {
+	r, w := io.Pipe()
+	cw := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r> foo\x1b[0K\r\x1b[1C",
+		},
+	}
+	typed := make(chan struct{})
+	out := writerFunc(func(p []byte) (int, error) {
+		n, err := cw.Write(p)
+		if err == nil && cw.pos == 4 {
+			close(typed)
+		}
+		return n, err
+	})
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(r),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	go func() {
+		if _, err := w.Write([]byte("foo")); err != nil {
+			t.Error(err)
+		}
+		<-typed
+		if err := e.Resize(4, 24); err != nil {
+			t.Error(err)
+		}
+		if _, err := w.Write([]byte("\x0d")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+	if e.Cols != 4 {
+		t.Errorf("expected 4 got %d", e.Cols)
+	}
+}
+
+func TestEditor_LineHintDelay(t *testing.T) {
+	r, w := io.Pipe()
+	cw := &checkedWriter{
 		expectations: []string{
 			"\r> \x1b[0K\r\x1b[2C",
 			"\r> f\x1b[0K\r\x1b[3C",
 			"\r> fo\x1b[0K\r\x1b[4C",
 			"\r> foo\x1b[0K\r\x1b[5C",
-			"\r> foo \x1b[0;37;49mbar\x1b[0m\x1b[0K\r\x1b[6C",
-			"\r> foo b\x1b[0K\r\x1b[7C",
-			"\r> foo ba\x1b[0K\r\x1b[8C",
-			"\r> foo bar\x1b[0K\r\x1b[9C",
+			"\r> foo\x1b[0;37;49m bar\x1b[0m\x1b[0K\r\x1b[5C",
 		},
 	}
+	hinted := make(chan struct{})
+	out := writerFunc(func(p []byte) (int, error) {
+		n, err := cw.Write(p)
+		if bytes.Contains(p, []byte("bar")) {
+			close(hinted)
+		}
+		return n, err
+	})
 
 	e := &linesqueak.Editor{
-		In:     bufio.NewReader(in),
-		Out:    bufio.NewWriter(out),
-		Prompt: "> ",
+		In:        bufio.NewReader(r),
+		Out:       bufio.NewWriter(out),
+		Prompt:    "> ",
+		HintDelay: 50 * time.Millisecond,
 		Hint: func(s string) *linesqueak.Hint {
-			if s == "foo " {
+			if s == "foo" {
 				return &linesqueak.Hint{
-					Message: "bar",
+					Message: " bar",
 				}
 			}
 
@@ -792,12 +4225,22 @@ func TestEditor_LineHint(t *testing.T) {
 		},
 	}
 
+	go func() {
+		if _, err := w.Write([]byte("foo")); err != nil {
+			t.Error(err)
+		}
+		<-hinted
+		if _, err := w.Write([]byte("\x0d")); err != nil {
+			t.Error(err)
+		}
+	}()
+
 	l, err := e.Line()
 	if err != nil {
 		t.Error(err)
 	}
-	if l != "foo bar" {
-		t.Errorf(`expected "foo bar" got %#v`, l)
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
 	}
 }
 
@@ -852,6 +4295,395 @@ func TestEditor_Write(t *testing.T) {
 	}
 }
 
+func TestEditor_WriteWhileLine(t *testing.T) {
+	r, w := io.Pipe()
+	cw := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r\x1b[0Kbaz\r\n",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+		},
+	}
+	typed := make(chan struct{})
+	out := writerFunc(func(p []byte) (int, error) {
+		n, err := cw.Write(p)
+		if err == nil && cw.pos == 2 {
+			close(typed)
+		}
+		return n, err
+	})
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(r),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	go func() {
+		if _, err := w.Write([]byte("f")); err != nil {
+			t.Error(err)
+		}
+		<-typed
+		if _, err := fmt.Fprint(e, "baz"); err != nil {
+			t.Error(err)
+		}
+		if _, err := w.Write([]byte("o\x0d")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "fo" {
+		t.Errorf(`expected "fo" got %#v`, l)
+	}
+}
+
+func TestEditor_Close(t *testing.T) {
+	r, w := io.Pipe()
+	cw := &checkedWriter{
+		expectations: []string{
+			"\x1b[?2004h\r> \x1b[0K\r\x1b[2C",
+			"\x1b[?2004l\r\n",
+		},
+	}
+	ready := make(chan struct{})
+	out := writerFunc(func(p []byte) (int, error) {
+		n, err := cw.Write(p)
+		if err == nil && cw.pos == 1 {
+			close(ready)
+		}
+		return n, err
+	})
+
+	e := &linesqueak.Editor{
+		In:             bufio.NewReader(r),
+		Out:            bufio.NewWriter(out),
+		Prompt:         "> ",
+		BracketedPaste: true,
+	}
+
+	go func() {
+		<-ready
+		if err := e.Close(); err != nil {
+			t.Error(err)
+		}
+		if _, err := w.Write([]byte("a")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := e.Line(); !errors.Is(err, linesqueak.ErrClosed) {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+	if _, err := e.Line(); !errors.Is(err, linesqueak.ErrClosed) {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+	if _, err := e.Write([]byte("foo")); !errors.Is(err, linesqueak.ErrClosed) {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+	if err := e.SetTitle("foo"); !errors.Is(err, linesqueak.ErrClosed) {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+	if err := e.ResetTitle(); !errors.Is(err, linesqueak.ErrClosed) {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+	if err := e.CopyToClipboard("foo"); !errors.Is(err, linesqueak.ErrClosed) {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEditor_Refresh(t *testing.T) {
+	out := &checkedWriter{
+		expectations: []string{
+			"\r$ foo\x1b[0K\r\x1b[5C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(bytes.NewBuffer(nil)),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Buffer: []rune("foo"),
+		Pos:    10,
+	}
+
+	e.Prompt = "$ "
+	if err := e.Refresh(); err != nil {
+		t.Error(err)
+	}
+	if e.Pos != 3 {
+		t.Errorf("expected 3 got %d", e.Pos)
+	}
+}
+
+func TestEditor_AddHistory(t *testing.T) {
+	e := &linesqueak.Editor{
+		AcceptHistory: (&linesqueak.HistoryIgnore{
+			Space:    true,
+			Patterns: []*regexp.Regexp{regexp.MustCompile(`^login `)},
+		}).Accept,
+	}
+
+	e.AddHistory("ls")
+	e.AddHistory(" secret")
+	e.AddHistory("login alice s3cr3t")
+	e.AddHistory("pwd")
+
+	expected := []string{"ls", "pwd", ""}
+	if !reflect.DeepEqual(e.History.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, e.History.Lines)
+	}
+}
+
+func TestEditor_Confirm(t *testing.T) {
+	in := bytes.NewBuffer([]byte("xn"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\rAre you sure? [Y/n] \x1b[0K\r\x1b[20C",
+			"\a",
+			"\rAre you sure? [Y/n] n\x1b[0K\r\x1b[21C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+		Buffer: []rune("drop table"),
+	}
+
+	ok, err := e.Confirm("Are you sure?", true)
+	if err != nil {
+		t.Error(err)
+	}
+	if ok {
+		t.Error("expected false")
+	}
+	if string(e.Buffer) != "drop table" {
+		t.Errorf(`expected "drop table" got %#v`, string(e.Buffer))
+	}
+}
+
+func TestEditor_ReadPassword(t *testing.T) {
+	in := bytes.NewBuffer([]byte("ab\x18\x05\tc\x0d"))
+	e := &linesqueak.Editor{
+		In:                  bufio.NewReader(in),
+		Out:                 bufio.NewWriter(io.Discard),
+		CompleteFromHistory: true,
+		ExternalEditor: func(s string) (string, error) {
+			t.Errorf("leaked to ExternalEditor: %#v", s)
+			return s, nil
+		},
+		OnKey: func(k linesqueak.KeyEvent) bool {
+			t.Errorf("leaked to OnKey: %#v", k)
+			return false
+		},
+	}
+	e.History.Add("abcdef")
+
+	p, err := e.ReadPassword("Password: ")
+	if err != nil {
+		t.Error(err)
+	}
+	if string(p) != "ab\tc" {
+		t.Errorf(`expected "ab\tc" got %#v`, string(p))
+	}
+	if e.ExternalEditor == nil || e.OnKey == nil || !e.CompleteFromHistory {
+		t.Error("expected the settings to be restored")
+	}
+}
+
+func TestEditor_ReadNewPassword(t *testing.T) {
+	t.Run("match", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("ab\x0dab\x0d"))
+		out := &checkedWriter{
+			expectations: []string{
+				"\rPassword: \x1b[0K\r\x1b[10C",
+				"\rPassword: *\x1b[0K\r\x1b[11C",
+				"\rPassword: **\x1b[0K\r\x1b[12C",
+				"\r\n",
+				"\rAgain: \x1b[0K\r\x1b[7C",
+				"\rAgain: *\x1b[0K\r\x1b[8C",
+				"\rAgain: **\x1b[0K\r\x1b[9C",
+				"\r\n",
+			},
+		}
+
+		e := &linesqueak.Editor{
+			In:     bufio.NewReader(in),
+			Out:    bufio.NewWriter(out),
+			Prompt: "> ",
+			Hint: func(s string) *linesqueak.Hint {
+				return &linesqueak.Hint{Message: "hint"}
+			},
+		}
+		e.History.Add("foo")
+
+		p, err := e.ReadNewPassword("Password: ", "Again: ")
+		if err != nil {
+			t.Error(err)
+		}
+		if string(p) != "ab" {
+			t.Errorf(`expected "ab" got %#v`, string(p))
+		}
+		if len(e.Buffer) != 0 {
+			t.Errorf("expected empty got %#v", string(e.Buffer))
+		}
+		if e.Prompt != "> " || e.Hint == nil || e.History.Len() != 1 {
+			t.Error("expected the settings to be restored")
+		}
+	})
+
+	t.Run("auto close", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("(a\x0d(a\x0d"))
+		e := &linesqueak.Editor{
+			In:        bufio.NewReader(in),
+			Out:       bufio.NewWriter(io.Discard),
+			AutoClose: true,
+			OnAccept: func(s string) (string, error) {
+				return "", errors.New("leaked")
+			},
+		}
+
+		p, err := e.ReadNewPassword("Password: ", "Again: ")
+		if err != nil {
+			t.Error(err)
+		}
+		if string(p) != "(a" {
+			t.Errorf(`expected "(a" got %#v`, string(p))
+		}
+		if !e.AutoClose || e.OnAccept == nil {
+			t.Error("expected the settings to be restored")
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		in := bytes.NewBuffer([]byte("ab\x0dac\x0d"))
+		e := &linesqueak.Editor{
+			In:  bufio.NewReader(in),
+			Out: bufio.NewWriter(io.Discard),
+		}
+
+		if _, err := e.ReadNewPassword("Password: ", "Again: "); !errors.Is(err, linesqueak.ErrPasswordMismatch) {
+			t.Errorf("expected ErrPasswordMismatch got %v", err)
+		}
+	})
+}
+
+func TestEditor_StartSpinner(t *testing.T) {
+	out := &checkedWriter{
+		expectations: []string{
+			"\r\x1b[0Kfoo\r\n",
+			"\r⠋ working\x1b[0K",
+			"\r⠋ 50%\x1b[0K",
+			"\r\x1b[0K",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	s := e.StartSpinner("working")
+	if _, err := e.Write([]byte("foo\n")); err != nil {
+		t.Error(err)
+	}
+	if err := s.SetMessage("50%"); err != nil {
+		t.Error(err)
+	}
+	if err := s.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := s.Stop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEditor_LineSpinner(t *testing.T) {
+	in := bytes.NewBuffer([]byte("a\x0d"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r⠋ working\x1b[0K\r\n> \x1b[0K\r\x1b[2C",
+			"\x1b[2K\x1b[1A\r⠋ working\x1b[0K\r\n> a\x1b[0K\r\x1b[3C",
+			"\x1b[2K\x1b[1A\r> a\x1b[0K\r\x1b[3C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	s := e.StartSpinner("working")
+	defer func() {
+		if err := s.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	l, err := e.Line()
+	if err != nil {
+		t.Error(err)
+	}
+	if l != "a" {
+		t.Errorf(`expected "a" got %#v`, l)
+	}
+}
+
+func TestEditor_SetTitle(t *testing.T) {
+	out := &checkedWriter{
+		expectations: []string{
+			"\x1b[22;0t\x1b]2;foo\a",
+			"\x1b]2;barbaz\a",
+			"\x1b[23;0t",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		Out: bufio.NewWriter(out),
+	}
+
+	if err := e.SetTitle("foo"); err != nil {
+		t.Error(err)
+	}
+	if err := e.SetTitle("bar\abaz"); err != nil {
+		t.Error(err)
+	}
+	if err := e.ResetTitle(); err != nil {
+		t.Error(err)
+	}
+	if err := e.ResetTitle(); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkEditor_LineLongInsert(b *testing.B) {
+	// insert at the beginning of a 10k-character line.
+	in := bytes.NewBufferString("\x1b[200~" + strings.Repeat("x", 10000) + "\x1b[201~\x01" + strings.Repeat("a", b.N) + "\x0d")
+
+	e := &linesqueak.Editor{
+		In:             bufio.NewReader(in),
+		Out:            bufio.NewWriter(io.Discard),
+		Prompt:         "> ",
+		BracketedPaste: true,
+	}
+
+	b.ResetTimer()
+	if _, err := e.Line(); err != nil {
+		b.Error(err)
+	}
+}
+
 type checkedWriter struct {
 	expectations []string
 	pos          int
@@ -870,3 +4702,9 @@ func (c *checkedWriter) Write(p []byte) (int, error) {
 	c.pos++
 	return len(p), nil
 }
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -12,6 +10,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/ichiban/linesqueak"
+	"github.com/ichiban/linesqueak/sshutil"
 )
 
 func main() {
@@ -70,88 +69,55 @@ func handleChannel(c ssh.NewChannel) {
 	}
 	defer conn.Close()
 
-	e := &linesqueak.Editor{
-		In:     bufio.NewReader(conn),
-		Out:    bufio.NewWriter(conn),
-		Prompt: "> ",
-		Complete: func(_ string) []string {
-			return []string{
-				"Completion #1",
-				"Completion #2",
-				"Completion #3",
-			}
-		},
-		Hint: func(s string) *linesqueak.Hint {
-			if s == "foo " {
-				return &linesqueak.Hint{
-					Message: "bar baz",
-				}
-			}
+	s, err := sshutil.Accept(conn, reqs)
+	if err != nil {
+		log.Printf("failed to start session: %s", err)
+		return
+	}
 
-			if s == "foo bar " {
-				return &linesqueak.Hint{
-					Message: "baz",
-					Bold:    true,
-				}
-			}
+	log.Printf("term: %s", s.Term)
 
-			return nil
-		},
+	e := s.Editor
+	e.Prompt = "> "
+	e.Complete = func(_ string) []string {
+		return []string{
+			"Completion #1",
+			"Completion #2",
+			"Completion #3",
+		}
 	}
-
-	go func() {
-		for req := range reqs {
-			switch req.Type {
-			case "pty-req":
-				termLen := req.Payload[3]
-				w, h := parseDims(req.Payload[termLen+4:])
-				e.Rows = h
-				e.Cols = w
-				req.Reply(true, nil)
-			case "shell":
-				term := string(req.Payload)
-				for _, t := range linesqueak.SupportedTerms {
-					if t == term {
-						req.Reply(true, nil)
-					}
-				}
-			case "exec":
-				log.Printf("exec: %s", req.Payload)
-			case "window-change":
-				w, h := parseDims(req.Payload)
-				e.Rows = h
-				e.Cols = w
-			default:
-				log.Printf("unknown req type: %s", req.Type)
+	e.Hint = func(s string) *linesqueak.Hint {
+		if s == "foo " {
+			return &linesqueak.Hint{
+				Message: "bar baz",
 			}
 		}
-	}()
 
-	for {
-		line, err := e.Line()
-		if err != nil {
-			break
+		if s == "foo bar " {
+			return &linesqueak.Hint{
+				Message: "baz",
+				Bold:    true,
+			}
 		}
 
-		log.Printf("line: %s\n", line)
-		fmt.Fprintf(e.Out, "\ryou have typed: %s\n", line)
+		return nil
+	}
 
-		e.History.Add(line)
+	if err := linesqueak.Run(e, func(line string) error {
+		log.Printf("line: %s\n", line)
+		fmt.Fprintf(e, "you have typed: %s\n", line)
 
 		if line == "adjust" {
 			log.Printf("adjusting: (%d, %d)\n", e.Cols, e.Rows)
 			e.Adjust()
 			log.Printf("adjusted: (%d, %d)\n", e.Cols, e.Rows)
 		}
+		return nil
+	}); err != nil {
+		log.Printf("session ended: %s", err)
 	}
 }
 
-func parseDims(b []byte) (int, int) {
-	w := int(binary.BigEndian.Uint32(b))
-	h := int(binary.BigEndian.Uint32(b[4:]))
-	return w, h
-}
-
 func serverPrivateKey() (ssh.Signer, error) {
 	b, err := serverPrivateKeyBytes()
 	if err != nil {
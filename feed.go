@@ -0,0 +1,217 @@
+package linesqueak
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// Feeder drives Editor with input you feed instead of reading from In
+// so that servers with their own event loops or tests can handle the terminal I/O by themselves.
+// Feed processes the input key stroke by key stroke and returns as soon as it runs out,
+// so there's no goroutine blocked on a read between Feeds.
+//
+// Since nothing runs between Feeds, Feeder has no timers. ESC at the end of the fed input is Esc by itself
+// if EscapeTimeout is provided, asynchronous hints are displayed once the fed input runs out,
+// and KeymapTimeout and IdleTimeout don't apply. Line, Confirm and Adjust don't work while Feeder drives Editor.
+//
+// Output produced by timers e.g. BellVisible or by Write from other goroutines between Feeds
+// is returned by the next Start, Feed or Output.
+type Feeder struct {
+	Editor *Editor
+
+	mu      sync.Mutex // serializes Start, Feed and Close since Editor is unlocked while it calls callbacks.
+	in      []byte     // fed but not read yet.
+	started bool       // an input line is being edited.
+
+	out bytes.Buffer // written but not returned yet. It's guarded by the lock of Editor.
+
+	line string
+	err  error
+}
+
+// Event tells that the input line is done.
+type Event struct {
+	// Line is the input line.
+	Line string
+
+	// Err is the error which ended the input line e.g. ErrInterrupt or io.EOF.
+	Err error
+}
+
+// NewFeeder returns Feeder which drives e. It replaces Out of e. In isn't read.
+func NewFeeder(e *Editor) *Feeder {
+	f := &Feeder{Editor: e}
+	e.feeder = f
+	e.Out = bufio.NewWriter(feederWriter{f})
+	return f
+}
+
+// Start starts editing an input line and processes the input fed after the end of the previous line like Feed.
+// It returns the events and the output e.g. the prompt.
+func (f *Feeder) Start() ([]Event, []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := f.Editor
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if f.started {
+		return nil, f.drain()
+	}
+
+	if e.closed {
+		f.line, f.err = "", ErrClosed
+		return []Event{{Err: ErrClosed}}, f.drain()
+	}
+
+	f.started = true
+	f.line, f.err = "", nil
+	if err := e.begin(context.Background(), ""); err != nil {
+		return f.end(err), f.drain()
+	}
+	return f.run(), f.drain()
+}
+
+// Feed processes b as input from the terminal and returns the events and the output.
+// Once the input line is done, the rest of the input is kept for the next Start.
+func (f *Feeder) Feed(b []byte) ([]Event, []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := f.Editor
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	f.in = append(f.in, b...)
+	if !f.started {
+		return nil, f.drain()
+	}
+	return f.run(), f.drain()
+}
+
+// Result returns the last input line and the error which ended it e.g. ErrInterrupt or io.EOF.
+func (f *Feeder) Result() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.line, f.err
+}
+
+// Output returns the output which hasn't been returned yet.
+func (f *Feeder) Output() []byte {
+	e := f.Editor
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return f.drain()
+}
+
+// Close ends the input line being edited with io.EOF so that the terminal modes turned on by Editor are turned off.
+// The output is returned by Output.
+func (f *Feeder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := f.Editor
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if f.started {
+		_ = f.end(io.EOF)
+	}
+	return nil
+}
+
+// run handles the fed key strokes until the input runs out or the input line is done.
+func (f *Feeder) run() []Event {
+	e := f.Editor
+	for {
+		s := f.save()
+		err := e.step(e.ctx)
+		if errors.Is(err, errNeedInput) {
+			// The key stroke is read again once the rest of it is fed.
+			f.restore(s)
+			return nil
+		}
+		if err != nil {
+			return f.end(err)
+		}
+	}
+}
+
+// end finishes the input line ended by err.
+func (f *Feeder) end(err error) []Event {
+	f.line, f.err = f.Editor.end(err)
+	f.started = false
+	return []Event{{Line: f.line, Err: f.err}}
+}
+
+// feedState is what reading a key stroke changes. A step is undone if the key stroke isn't fed completely yet.
+type feedState struct {
+	in        []byte
+	unread    []readResult
+	recording []rune
+	count     int
+}
+
+func (f *Feeder) save() feedState {
+	e := f.Editor
+	s := feedState{
+		in:     f.in,
+		unread: append([]readResult(nil), e.unread...),
+		count:  e.count,
+	}
+	if e.recording != nil {
+		s.recording = append([]rune{}, e.recording...)
+	}
+	return s
+}
+
+func (f *Feeder) restore(s feedState) {
+	e := f.Editor
+	f.in = s.in
+	e.unread = s.unread
+	e.recording = s.recording
+	e.count = s.count
+}
+
+// read reads a rune from the fed input and deals with invalid UTF-8 according to p.
+// It returns false if the input has run out.
+func (f *Feeder) read(p InvalidUTF8Policy) (readResult, bool) {
+	for len(f.in) > 0 && utf8.FullRune(f.in) {
+		r, n := utf8.DecodeRune(f.in)
+		f.in = f.in[n:]
+		if r != utf8.RuneError || n != 1 {
+			return readResult{r: r}, true
+		}
+
+		switch p {
+		case InvalidUTF8Drop:
+			continue
+		case InvalidUTF8Error:
+			return readResult{r: r, err: ErrInvalidUTF8}, true
+		default:
+			return readResult{r: r}, true
+		}
+	}
+	return readResult{}, false
+}
+
+// drain returns the output and empties it.
+func (f *Feeder) drain() []byte {
+	b := append([]byte(nil), f.out.Bytes()...)
+	f.out.Reset()
+	return b
+}
+
+type feederWriter struct {
+	f *Feeder
+}
+
+func (w feederWriter) Write(p []byte) (int, error) {
+	return w.f.out.Write(p)
+}
@@ -0,0 +1,99 @@
+package linesqueak_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestFeeder(t *testing.T) {
+	e := &linesqueak.Editor{
+		Prompt: "> ",
+	}
+	f := linesqueak.NewFeeder(e)
+	defer func() {
+		if err := f.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	evs, out := f.Start()
+	if len(evs) != 0 {
+		t.Errorf("expected no events got %#v", evs)
+	}
+	if string(out) != "\r> \x1b[0K\r\x1b[2C" {
+		t.Errorf("expected %q got %q", "\r> \x1b[0K\r\x1b[2C", out)
+	}
+
+	evs, out = f.Feed([]byte("fo"))
+	if len(evs) != 0 {
+		t.Errorf("expected no events got %#v", evs)
+	}
+	if string(out) != "\r> f\x1b[0K\r\x1b[3C\r> fo\x1b[0K\r\x1b[4C" {
+		t.Errorf("expected %q got %q", "\r> f\x1b[0K\r\x1b[3C\r> fo\x1b[0K\r\x1b[4C", out)
+	}
+
+	evs, out = f.Feed([]byte("o\x0dba"))
+	if len(evs) != 1 || evs[0].Line != "foo" || evs[0].Err != nil {
+		t.Errorf(`expected "foo" got %#v`, evs)
+	}
+	if string(out) != "\r> foo\x1b[0K\r\x1b[5C" {
+		t.Errorf("expected %q got %q", "\r> foo\x1b[0K\r\x1b[5C", out)
+	}
+	if l, err := f.Result(); l != "foo" || err != nil {
+		t.Errorf(`expected "foo" got %#v, %v`, l, err)
+	}
+
+	evs, out = f.Start()
+	if len(evs) != 0 {
+		t.Errorf("expected no events got %#v", evs)
+	}
+	if string(out) != "\r> \x1b[0K\r\x1b[2C\r> b\x1b[0K\r\x1b[3C\r> ba\x1b[0K\r\x1b[4C" {
+		t.Errorf("expected %q got %q", "\r> \x1b[0K\r\x1b[2C\r> b\x1b[0K\r\x1b[3C\r> ba\x1b[0K\r\x1b[4C", out)
+	}
+
+	evs, _ = f.Feed([]byte("r\x0d"))
+	if len(evs) != 1 || evs[0].Line != "bar" || evs[0].Err != nil {
+		t.Errorf(`expected "bar" got %#v`, evs)
+	}
+}
+
+func TestFeeder_Split(t *testing.T) {
+	// Key strokes and modal commands can span Feeds.
+	e := &linesqueak.Editor{
+		Prompt: "> ",
+	}
+	e.History.Add("foo 1")
+	e.History.Add("bar")
+	f := linesqueak.NewFeeder(e)
+
+	n := runtime.NumGoroutine()
+
+	feed := func(bs ...string) {
+		t.Helper()
+		for _, b := range bs {
+			evs, _ := f.Feed([]byte(b))
+			if len(evs) != 0 {
+				t.Fatalf("expected no events after %q got %#v", b, evs)
+			}
+			if m := runtime.NumGoroutine(); m > n {
+				t.Fatalf("expected no goroutines to be left after %q got %d more", b, m-n)
+			}
+		}
+	}
+
+	_, _ = f.Start()
+	feed("ab", "\x1b", "[", "D", "X", "\xe3\x81", "\x82")
+	evs, _ := f.Feed([]byte("\x0d"))
+	if len(evs) != 1 || evs[0].Line != "aXあb" || evs[0].Err != nil {
+		t.Errorf(`expected "aXあb" got %#v`, evs)
+	}
+
+	_, _ = f.Start()
+	feed("\x12", "f", "o")
+	evs, _ = f.Feed([]byte("\x06\x0d"))
+	if len(evs) != 1 || evs[0].Line != "foo 1" || evs[0].Err != nil {
+		t.Errorf(`expected "foo 1" got %#v`, evs)
+	}
+}
@@ -0,0 +1,107 @@
+package linesqueak
+
+import (
+	"context"
+	"time"
+)
+
+// readRuneHinting reads a rune from the terminal.
+// If Hint is asynchronous and user stops typing for HintDelay, it calls Hint or HintContext in a separate goroutine
+// and displays the hint when it's ready.
+func (e *Editor) readRuneHinting(ctx context.Context) (rune, error) {
+	if !e.hints() || e.HintDelay <= 0 || len(e.unread) > 0 || (e.hinted && e.hintFor == string(e.Buffer)) {
+		return e.readRune(ctx)
+	}
+
+	if err := e.catchUp(); err != nil {
+		return 0, err
+	}
+
+	if e.feeder != nil {
+		// Feeder can't wait for HintDelay. User has stopped typing once the fed input runs out.
+		if !e.pending() {
+			if err := e.showHint(e.callHint(ctx, string(e.Buffer))); err != nil {
+				return 0, err
+			}
+		}
+		return e.readRune(ctx)
+	}
+
+	t := time.NewTimer(e.HintDelay)
+	defer t.Stop()
+
+	runes := e.background()
+	var res readResult
+	var received bool
+	e.unlocked(func() {
+		select {
+		case res = <-runes:
+			received = true
+		case <-t.C:
+		case <-ctx.Done():
+			res.err = ctx.Err()
+		}
+	})
+	if received {
+		e.received(res)
+		return res.r, res.err
+	}
+	if res.err != nil {
+		return 0, res.err
+	}
+
+	// The hint is discarded once user types.
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hints := make(chan *Hint, 1)
+	go func(s string) {
+		hints <- e.callHint(hctx, s)
+	}(string(e.Buffer))
+
+	var h *Hint
+	var hinted bool
+	e.unlocked(func() {
+		select {
+		case h = <-hints:
+			hinted = true
+		case res = <-runes:
+			received = true
+		case <-ctx.Done():
+			res.err = ctx.Err()
+		}
+	})
+
+	switch {
+	case hinted:
+		if err := e.showHint(h); err != nil {
+			return 0, err
+		}
+		return e.readRune(ctx)
+	case received:
+		e.received(res)
+
+		// The hint is still valid until the key stroke is processed.
+		select {
+		case h := <-hints:
+			if err := e.showHint(h); err != nil {
+				return 0, err
+			}
+		default:
+		}
+
+		return res.r, res.err
+	default:
+		return 0, res.err
+	}
+}
+
+func (e *Editor) showHint(h *Hint) error {
+	e.hinted = true
+	e.hintFor = string(e.Buffer)
+	e.lastHint = h
+	if h == nil {
+		return nil
+	}
+	return e.refreshLine()
+}
@@ -0,0 +1,403 @@
+package linesqueak
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History holds previous input lines.
+// The zero value is an empty History ready to use.
+// Prefer the methods e.g. Add, Len, Entry, RemoveAt and Clear to manipulating Lines and Pos directly.
+type History struct {
+	// Lines are the entries followed by the line currently being edited.
+	Lines []string
+
+	// Pos points the entry which is currently displayed in Lines.
+	Pos int
+
+	// MaxLen is the maximum number of entries. If it's exceeded, the oldest entries are dropped.
+	// If it's 0, History grows without bound.
+	MaxLen int
+
+	// Tag is recorded with entries added by Add e.g. a session ID or a user name.
+	Tag string
+
+	// Sanitize is called by Add and AddEntry with the line before it's stored so that it can redact secrets
+	// e.g. tokens and passwords. If it returns false, the entry is dropped entirely.
+	// Sanitize is OPTIONAL. If no Sanitize is provided, lines are stored as they are.
+	Sanitize func(l string) (string, bool)
+
+	meta []historyMeta
+}
+
+// HistoryEntry is an entry of History with its metadata.
+type HistoryEntry struct {
+	Line string
+
+	// Time is when the entry was added. It's zero if unknown.
+	Time time.Time
+
+	// Tag is History.Tag at the time the entry was added.
+	Tag string
+}
+
+type historyMeta struct {
+	time time.Time
+	tag  string
+}
+
+func (h *History) Add(l string) {
+	h.AddEntry(HistoryEntry{Line: l, Time: time.Now(), Tag: h.Tag})
+}
+
+// AddEntry adds an entry with the given metadata.
+func (h *History) AddEntry(ent HistoryEntry) {
+	if h.Sanitize != nil {
+		var ok bool
+		ent.Line, ok = h.Sanitize(ent.Line)
+		if !ok {
+			return
+		}
+	}
+	if len(h.Lines) == 0 {
+		h.Lines = []string{""}
+	}
+	for len(h.meta) < len(h.Lines)-1 {
+		h.meta = append(h.meta, historyMeta{}) // unknown
+	}
+	h.meta = append(h.meta[:len(h.Lines)-1], historyMeta{time: ent.Time, tag: ent.Tag})
+	h.Lines[len(h.Lines)-1] = ent.Line
+	h.Lines = append(h.Lines, "")
+	h.trim()
+	h.Pos = len(h.Lines) - 1
+}
+
+// trim drops the oldest entries exceeding MaxLen.
+func (h *History) trim() {
+	n := len(h.Lines) - 1 - h.MaxLen
+	if h.MaxLen <= 0 || n <= 0 {
+		return
+	}
+	h.Lines = append(h.Lines[:0], h.Lines[n:]...)
+	if m := len(h.meta); n < m {
+		h.meta = append(h.meta[:0], h.meta[n:]...)
+	} else {
+		h.meta = h.meta[:0]
+	}
+	if h.Pos -= n; h.Pos < 0 {
+		h.Pos = 0
+	}
+}
+
+func (h *History) add(l string, t time.Time) {
+	h.AddEntry(HistoryEntry{Line: l, Time: t})
+}
+
+// Entry returns the i-th entry with its metadata.
+func (h *History) Entry(i int) HistoryEntry {
+	ent := HistoryEntry{Line: h.Lines[i]}
+	if i < len(h.meta) {
+		ent.Time, ent.Tag = h.meta[i].time, h.meta[i].tag
+	}
+	return ent
+}
+
+// Entries returns the entries with their metadata excluding the line currently being edited.
+func (h *History) Entries() []HistoryEntry {
+	ents := make([]HistoryEntry, len(h.entries()))
+	for i := range ents {
+		ents[i] = h.Entry(i)
+	}
+	return ents
+}
+
+// Len returns the number of entries excluding the line currently being edited.
+func (h *History) Len() int {
+	return len(h.entries())
+}
+
+// RemoveAt removes the i-th entry. It panics if i is out of range.
+func (h *History) RemoveAt(i int) {
+	if i < 0 || i >= h.Len() {
+		panic("linesqueak: history index out of range")
+	}
+	h.Lines = append(h.Lines[:i], h.Lines[i+1:]...)
+	if i < len(h.meta) {
+		h.meta = append(h.meta[:i], h.meta[i+1:]...)
+	}
+	if h.Pos > i {
+		h.Pos--
+	}
+}
+
+// Clear removes all the entries. MaxLen and Tag are kept.
+func (h *History) Clear() {
+	h.Lines, h.meta = nil, nil
+	h.Pos = 0
+}
+
+// Expire drops the entries added before t. The entries of unknown time are kept.
+func (h *History) Expire(t time.Time) {
+	if len(h.Lines) == 0 {
+		return
+	}
+	ents, editing := h.Entries(), h.Lines[len(h.Lines)-1]
+	h.Lines, h.meta = h.Lines[:0], h.meta[:0]
+	for _, ent := range ents {
+		if !ent.Time.IsZero() && ent.Time.Before(t) {
+			continue
+		}
+		h.Lines = append(h.Lines, ent.Line)
+		h.meta = append(h.meta, historyMeta{time: ent.Time, tag: ent.Tag})
+	}
+	h.Lines = append(h.Lines, editing)
+	h.Pos = len(h.Lines) - 1
+}
+
+// time returns when the i-th entry was added or zero time if it's unknown.
+func (h *History) time(i int) time.Time {
+	if i >= len(h.meta) {
+		return time.Time{}
+	}
+	return h.meta[i].time
+}
+
+func (h *History) Next() error {
+	if h.Pos >= len(h.Lines)-1 {
+		return errors.New("end of history")
+	}
+	h.Pos++
+	return nil
+}
+
+func (h *History) Prev() error {
+	if h.Pos <= 0 {
+		return errors.New("beginning of history")
+	}
+	h.Pos--
+	return nil
+}
+
+// PrevPrefix goes back to the previous entry which starts with prefix and differs from the current one.
+func (h *History) PrevPrefix(prefix string) error {
+	for i := h.Pos - 1; i >= 0; i-- {
+		if strings.HasPrefix(h.Lines[i], prefix) && h.Lines[i] != h.Lines[h.Pos] {
+			h.Pos = i
+			return nil
+		}
+	}
+	return errors.New("no previous match")
+}
+
+// NextPrefix goes forward to the next entry which starts with prefix and differs from the current one.
+// The line currently being edited always matches.
+func (h *History) NextPrefix(prefix string) error {
+	for i := h.Pos + 1; i < len(h.Lines); i++ {
+		if i == len(h.Lines)-1 || strings.HasPrefix(h.Lines[i], prefix) && h.Lines[i] != h.Lines[h.Pos] {
+			h.Pos = i
+			return nil
+		}
+	}
+	return errors.New("no next match")
+}
+
+// PrevSubstring goes back to the previous entry which contains s and differs from the current one.
+func (h *History) PrevSubstring(s string) error {
+	for i := h.Pos - 1; i >= 0; i-- {
+		if strings.Contains(h.Lines[i], s) && h.Lines[i] != h.Lines[h.Pos] {
+			h.Pos = i
+			return nil
+		}
+	}
+	return errors.New("no previous match")
+}
+
+// NextSubstring goes forward to the next entry which contains s and differs from the current one.
+// The line currently being edited always matches.
+func (h *History) NextSubstring(s string) error {
+	for i := h.Pos + 1; i < len(h.Lines); i++ {
+		if i == len(h.Lines)-1 || strings.Contains(h.Lines[i], s) && h.Lines[i] != h.Lines[h.Pos] {
+			h.Pos = i
+			return nil
+		}
+	}
+	return errors.New("no next match")
+}
+
+func (h *History) Get() string {
+	return h.Lines[h.Pos]
+}
+
+func (h *History) Save(l string) {
+	if len(h.Lines) == 0 {
+		h.Lines = []string{""}
+	}
+	if h.Pos != len(h.Lines)-1 {
+		return
+	}
+	h.Lines[len(h.Lines)-1] = l
+}
+
+// entries returns the input lines added to History excluding the line currently being edited.
+func (h *History) entries() []string {
+	if len(h.Lines) == 0 {
+		return nil
+	}
+	return h.Lines[:len(h.Lines)-1]
+}
+
+// WriteTo writes the entries of History to w in the history file format:
+// Each entry is written in a line terminated by \n.
+// Backslashes and newlines in entries are escaped as \\ and \n respectively
+// and # at the beginning of entries is escaped as \#.
+// If the time or the tag of an entry is known, the entry is preceded by a metadata line
+// which consists of # and the time in Unix seconds or 0 if unknown, followed by a space and the escaped tag if any
+// e.g. #1600000000 or #1600000000 alice.
+// The line currently being edited is not written.
+func (h *History) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	for i, l := range h.entries() {
+		var s string
+		if ent := h.Entry(i); !ent.Time.IsZero() || ent.Tag != "" {
+			var sec int64
+			if !ent.Time.IsZero() {
+				sec = ent.Time.Unix()
+			}
+			s = "#" + strconv.FormatInt(sec, 10)
+			if ent.Tag != "" {
+				s += " " + historyEscaper.Replace(ent.Tag)
+			}
+			s += "\n"
+		}
+		l = historyEscaper.Replace(l)
+		if strings.HasPrefix(l, "#") {
+			l = "\\" + l
+		}
+		m, err := bw.WriteString(s + l + "\n")
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadFrom reads entries in the history file format from r and adds them to History.
+func (h *History) ReadFrom(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var n int64
+	var meta historyMeta
+	for {
+		l, err := br.ReadString('\n')
+		n += int64(len(l))
+		if l = strings.TrimSuffix(l, "\n"); l != "" {
+			if m, ok := historyMetaLine(l); ok {
+				meta = m
+			} else {
+				h.AddEntry(HistoryEntry{Line: historyUnescape(l), Time: meta.time, Tag: meta.tag})
+				meta = historyMeta{}
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// historyMetaLine parses a metadata line e.g. #1600000000 alice.
+// Lines which start with # but don't look like metadata are entries written before entries were escaped.
+func historyMetaLine(l string) (historyMeta, bool) {
+	if !strings.HasPrefix(l, "#") {
+		return historyMeta{}, false
+	}
+	ts, tag, _ := strings.Cut(l[1:], " ")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return historyMeta{}, false
+	}
+	var m historyMeta
+	if sec != 0 {
+		m.time = time.Unix(sec, 0)
+	}
+	m.tag = historyUnescape(tag)
+	return m, true
+}
+
+// SaveFile writes History to the file at path in the history file format. See WriteTo for the format.
+// The file is replaced atomically so that it won't be corrupted even if the process crashes.
+func (h *History) SaveFile(path string) error {
+	return h.SaveFileFormat(path, HistoryFormatDefault)
+}
+
+// SaveFileFormat is like SaveFile but writes in the format f.
+func (h *History) SaveFileFormat(path string, f HistoryFormat) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := h.WriteFormat(tmp, f); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile reads the file at path in the history file format and adds its entries to History.
+// If the file doesn't exist, History is left as it is and it returns nil.
+func (h *History) LoadFile(path string) error {
+	return h.LoadFileFormat(path, HistoryFormatDefault)
+}
+
+// LoadFileFormat is like LoadFile but reads in the format f.
+// e.g. h.LoadFileFormat(filepath.Join(home, ".bash_history"), HistoryFormatBash)
+func (h *History) LoadFileFormat(path string, f HistoryFormat) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return h.ReadFormat(file, f)
+}
+
+var historyEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+func historyUnescape(s string) string {
+	var b strings.Builder
+	var escaped bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			if r == 'n' {
+				r = '\n'
+			}
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
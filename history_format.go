@@ -0,0 +1,221 @@
+package linesqueak
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryFormat is a format of history files.
+type HistoryFormat int
+
+const (
+	// HistoryFormatDefault is the format of linesqueak. See History.WriteTo for details.
+	HistoryFormatDefault HistoryFormat = iota
+
+	// HistoryFormatBash is the format of ~/.bash_history.
+	// Each entry is preceded by a timestamp comment line e.g. #1600000000 or #0 if the time is unknown.
+	// Entries with newlines span multiple lines, which bash reads back as one entry with shopt -s lithist
+	// since they have timestamps.
+	HistoryFormatBash
+
+	// HistoryFormatZsh is the extended history format of zsh (setopt EXTENDED_HISTORY) e.g. : 1600000000:0;ls -l
+	// Newlines in entries are escaped with backslashes. Lines without timestamps are also accepted when reading.
+	HistoryFormatZsh
+)
+
+// WriteFormat writes the entries of History to w in the format f.
+func (h *History) WriteFormat(w io.Writer, f HistoryFormat) error {
+	switch f {
+	case HistoryFormatDefault:
+		_, err := h.WriteTo(w)
+		return err
+	case HistoryFormatBash:
+		return h.writeBash(w)
+	case HistoryFormatZsh:
+		return h.writeZsh(w)
+	default:
+		return fmt.Errorf("unknown history format: %d", f)
+	}
+}
+
+// ReadFormat reads entries in the format f from r and adds them to History.
+func (h *History) ReadFormat(r io.Reader, f HistoryFormat) error {
+	switch f {
+	case HistoryFormatDefault:
+		_, err := h.ReadFrom(r)
+		return err
+	case HistoryFormatBash:
+		return h.readBash(r)
+	case HistoryFormatZsh:
+		return h.readZsh(r)
+	default:
+		return fmt.Errorf("unknown history format: %d", f)
+	}
+}
+
+func (h *History) writeBash(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, l := range h.entries() {
+		// Every entry has a timestamp so that the following lines of a multi-line entry stay in the entry.
+		var sec int64
+		if t := h.time(i); !t.IsZero() {
+			sec = t.Unix()
+		}
+		if _, err := fmt.Fprintf(bw, "#%d\n%s\n", sec, l); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (h *History) readBash(r io.Reader) error {
+	s := bufio.NewScanner(r)
+
+	// Once a timestamp appears, an entry continues until the next timestamp.
+	var timestamped bool
+	var t time.Time
+	var lines []string
+	flush := func() {
+		if len(lines) > 0 {
+			h.add(strings.Join(lines, "\n"), t)
+		}
+		lines = nil
+	}
+
+	for s.Scan() {
+		l := s.Text()
+		if sec, ok := bashTimestamp(l); ok {
+			flush()
+			timestamped = true
+			t = time.Time{}
+			if sec != 0 {
+				t = time.Unix(sec, 0)
+			}
+			continue
+		}
+
+		if !timestamped {
+			h.add(l, time.Time{})
+			continue
+		}
+
+		lines = append(lines, l)
+	}
+	flush()
+
+	return s.Err()
+}
+
+func bashTimestamp(l string) (int64, bool) {
+	if len(l) < 2 || l[0] != '#' {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(l[1:], 10, 64)
+	return sec, err == nil
+}
+
+func (h *History) writeZsh(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, l := range h.entries() {
+		t := h.time(i)
+		if t.IsZero() {
+			t = time.Unix(0, 0)
+		}
+		l = strings.Replace(l, "\n", "\\\n", -1)
+		if _, err := fmt.Fprintf(bw, ": %d:0;%s\n", t.Unix(), zshMetafy(l)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (h *History) readZsh(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		l, err := readZshEntry(br)
+		if l != "" {
+			l = zshUnmetafy(l)
+			t := time.Time{}
+			if sec, cmd, ok := zshExtended(l); ok {
+				t, l = time.Unix(sec, 0), cmd
+			}
+			h.add(l, t)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readZshEntry reads a line and following lines if the line ends with a backslash.
+func readZshEntry(br *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		l, err := br.ReadString('\n')
+		l = strings.TrimSuffix(l, "\n")
+		if err == nil && strings.HasSuffix(l, "\\") {
+			b.WriteString(strings.TrimSuffix(l, "\\"))
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(l)
+		return b.String(), err
+	}
+}
+
+// zshExtended parses an entry in the extended history format i.e. ": <start>:<elapsed>;<command>".
+func zshExtended(l string) (int64, string, bool) {
+	if !strings.HasPrefix(l, ": ") {
+		return 0, "", false
+	}
+	i := strings.IndexByte(l, ';')
+	if i < 0 {
+		return 0, "", false
+	}
+	ts := strings.SplitN(l[2:i], ":", 2)
+	sec, err := strconv.ParseInt(ts[0], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return sec, l[i+1:], true
+}
+
+// zsh escapes some bytes in history files by prefixing 0x83 and flipping the 6th bit.
+const zshMeta = 0x83
+
+func zshIsMeta(c byte) bool {
+	return c == 0 || (zshMeta <= c && c <= 0xa2)
+}
+
+func zshMetafy(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; zshIsMeta(c) {
+			b.WriteByte(zshMeta)
+			b.WriteByte(c ^ 32)
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func zshUnmetafy(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == zshMeta && i+1 < len(s) {
+			i++
+			b.WriteByte(s[i] ^ 32)
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
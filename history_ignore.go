@@ -0,0 +1,37 @@
+package linesqueak
+
+import (
+	"regexp"
+	"strings"
+)
+
+// HistoryIgnore keeps secrets and noise out of History like bash's HISTIGNORE and HISTCONTROL=ignorespace.
+// Its Accept method is meant to be used as Editor.AcceptHistory.
+//
+//	e := &linesqueak.Editor{
+//		// ...
+//		AcceptHistory: (&linesqueak.HistoryIgnore{
+//			Space:    true,
+//			Patterns: []*regexp.Regexp{regexp.MustCompile(`^(ls|pwd|exit)$`)},
+//		}).Accept,
+//	}
+type HistoryIgnore struct {
+	// Space ignores lines which begin with a space so that user can keep a line out of History on purpose.
+	Space bool
+
+	// Patterns ignore lines which match any of them.
+	Patterns []*regexp.Regexp
+}
+
+// Accept tells if l should be added to History.
+func (h *HistoryIgnore) Accept(l string) bool {
+	if h.Space && strings.HasPrefix(l, " ") {
+		return false
+	}
+	for _, p := range h.Patterns {
+		if p.MatchString(l) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package linesqueak
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// editHistoryMenu lists recent History entries with numbers below the user input and loads the chosen one.
+// User chooses an entry by typing its number or moving the selection with Up/Down or Ctrl-P/Ctrl-N, then presses Enter.
+// Ctrl-G or Esc closes the menu and any other key closes the menu and is handled as usual.
+func (e *Editor) editHistoryMenu() error {
+	e.syncHistory()
+	ents := e.History.entries()
+	if len(ents) == 0 {
+		return e.beep()
+	}
+
+	// The rest of the screen below the user input.
+	_, p := e.positions(validUTF8(e.prompt()))
+	n := e.Rows - p.rows - 2
+	if n < 1 {
+		n = 1
+	}
+	if n > len(ents) {
+		n = len(ents)
+	}
+
+	sel := 1 // the number of the selected entry. The most recent one is 1.
+	var num int
+
+	e.message = e.historyMenu(ents, n, sel)
+	if err := e.refreshLine(); err != nil {
+		e.message = ""
+		return err
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			k, err := e.readKey(ctx)
+			if err != nil {
+				return false, err
+			}
+
+			switch {
+			case k.Key == KeyUp || k.Key == KeyCtrlP:
+				num = 0
+				if sel < n {
+					sel++
+				}
+			case k.Key == KeyDown || k.Key == KeyCtrlN:
+				num = 0
+				if sel > 1 {
+					sel--
+				}
+			case k.Mod == 0 && isDigit(k.Rune):
+				num = num*10 + int(k.Rune-'0')
+				if num < 1 || num > n {
+					num = int(k.Rune - '0')
+				}
+				if 1 <= num && num <= n {
+					sel = num
+				}
+			case k.Key == KeyEnter:
+				e.message = ""
+				e.leaveHistoryEntry()
+				e.saveUndo()
+				e.History.Pos = len(ents) - sel
+				e.Buffer = []rune(e.historyEntry())
+				e.Pos = len(e.Buffer)
+				return true, e.refreshLine()
+			case k.Key == KeyCtrlG || (k.Key == KeyEsc && k.Mod == 0):
+				e.message = ""
+				return true, e.refreshLine()
+			default:
+				// The menu is closed and the key is handled as usual.
+				e.unreadKey(k)
+				e.message = ""
+				return true, e.refreshLine()
+			}
+
+			e.message = e.historyMenu(ents, n, sel)
+			return false, e.refreshLine()
+		},
+		leave: func() {
+			e.message = ""
+		},
+	})
+	return nil
+}
+
+// historyMenu formats the n most recent entries of ents with numbers. The selected one is marked with >.
+func (e *Editor) historyMenu(ents []string, n, sel int) string {
+	f := e.width()
+	d := len(fmt.Sprint(n))
+	ls := make([]string, n)
+	for i := range ls {
+		mark := " "
+		if i+1 == sel {
+			mark = ">"
+		}
+		l := fmt.Sprintf("%s %*d  ", mark, d, i+1)
+		room := e.Cols - 1 - len(l)
+
+		s := strings.ReplaceAll(ents[len(ents)-1-i], "\n", " ")
+		var w int
+		for _, r := range s {
+			w += f(r)
+		}
+		if w > room {
+			s, _ = e.truncate(s, room)
+		}
+		ls[i] = l + s
+	}
+	return strings.Join(ls, "\n")
+}
@@ -0,0 +1,113 @@
+package linesqueak
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchMode decides how History.Search matches entries against a query.
+type SearchMode int
+
+const (
+	// SearchPrefix matches entries which start with the query.
+	SearchPrefix SearchMode = iota
+
+	// SearchSubstring matches entries which contain the query.
+	SearchSubstring
+
+	// SearchFuzzy matches entries which contain all the characters of the query in order
+	// but not necessarily next to each other. It's case-insensitive.
+	SearchFuzzy
+)
+
+// Match is a History entry matched by History.Search.
+type Match struct {
+	// Index is the index of the entry in History.Lines.
+	Index int
+
+	// Ranges are the matched parts of the entry in rune offsets so that UIs can highlight them.
+	Ranges []MatchRange
+}
+
+// MatchRange is a matched part of a History entry. It starts at Start inclusive and ends at End exclusive.
+type MatchRange struct {
+	Start, End int
+}
+
+// Search returns the entries which match query in mode, the most recent first.
+// The line currently being edited is not searched.
+func (h *History) Search(query string, mode SearchMode) []Match {
+	var ms []Match
+	ents := h.entries()
+	for i := len(ents) - 1; i >= 0; i-- {
+		rs, ok := match([]rune(ents[i]), []rune(query), mode)
+		if !ok {
+			continue
+		}
+		ms = append(ms, Match{Index: i, Ranges: rs})
+	}
+	return ms
+}
+
+// inMatch tells if rs contains i.
+func inMatch(rs []MatchRange, i int) bool {
+	for _, r := range rs {
+		if r.Start <= i && i < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// shiftRanges returns rs moved by n.
+func shiftRanges(rs []MatchRange, n int) []MatchRange {
+	if len(rs) == 0 {
+		return rs
+	}
+	ss := make([]MatchRange, len(rs))
+	for i, r := range rs {
+		ss[i] = MatchRange{Start: r.Start + n, End: r.End + n}
+	}
+	return ss
+}
+
+func match(l, q []rune, mode SearchMode) ([]MatchRange, bool) {
+	if len(q) == 0 {
+		return nil, true
+	}
+
+	switch mode {
+	case SearchPrefix:
+		if !strings.HasPrefix(string(l), string(q)) {
+			return nil, false
+		}
+		return []MatchRange{{Start: 0, End: len(q)}}, true
+	case SearchSubstring:
+		i := strings.Index(string(l), string(q))
+		if i < 0 {
+			return nil, false
+		}
+		start := len([]rune(string(l)[:i]))
+		return []MatchRange{{Start: start, End: start + len(q)}}, true
+	case SearchFuzzy:
+		var rs []MatchRange
+		j := 0
+		for i, r := range l {
+			if j == len(q) {
+				break
+			}
+			if unicode.ToLower(r) != unicode.ToLower(q[j]) {
+				continue
+			}
+			j++
+			if n := len(rs); n > 0 && rs[n-1].End == i {
+				rs[n-1].End++
+				continue
+			}
+			rs = append(rs, MatchRange{Start: i, End: i + 1})
+		}
+		return rs, j == len(q)
+	default:
+		return nil, false
+	}
+}
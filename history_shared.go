@@ -0,0 +1,86 @@
+package linesqueak
+
+import (
+	"sync"
+	"time"
+)
+
+// SharedHistory is History which can be shared among multiple concurrent Editors e.g. one per SSH session.
+// Unlike History, it's safe for concurrent use.
+// Each Editor navigates its own snapshot of SharedHistory which is taken when the navigation starts
+// so that entries added by other sessions appear on the next navigation.
+type SharedHistory struct {
+	mu   sync.RWMutex
+	h    History
+	subs map[chan HistoryEntry]struct{}
+}
+
+// NewSharedHistory returns SharedHistory which holds up to maxLen entries. If maxLen is 0, it grows without bound.
+func NewSharedHistory(maxLen int) *SharedHistory {
+	return &SharedHistory{h: History{MaxLen: maxLen}}
+}
+
+// Add adds an input line to SharedHistory and notifies subscribers.
+// The entry isn't tagged. Use AddEntry to tag it e.g. with the session.
+func (s *SharedHistory) Add(l string) {
+	s.AddEntry(HistoryEntry{Line: l, Time: time.Now()})
+}
+
+// AddEntry adds an entry with the given metadata and notifies subscribers.
+func (s *SharedHistory) AddEntry(ent HistoryEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.h.AddEntry(ent)
+	for c := range s.subs {
+		select {
+		case c <- ent:
+		default: // the subscriber is busy. drop it rather than block others.
+		}
+	}
+}
+
+// Snapshot returns a copy of SharedHistory.
+func (s *SharedHistory) Snapshot() History {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h := History{
+		Lines:  append([]string(nil), s.h.entries()...),
+		MaxLen: s.h.MaxLen,
+		meta:   append([]historyMeta(nil), s.h.meta...),
+	}
+	h.Lines = append(h.Lines, "")
+	h.Pos = len(h.Lines) - 1
+	return h
+}
+
+// Subscribe returns a channel which delivers entries added to SharedHistory and a function to unsubscribe.
+// Entries are dropped if the channel is not ready to receive.
+func (s *SharedHistory) Subscribe() (<-chan HistoryEntry, func()) {
+	c := make(chan HistoryEntry, 16)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs == nil {
+		s.subs = map[chan HistoryEntry]struct{}{}
+	}
+	s.subs[c] = struct{}{}
+	return c, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs, c)
+	}
+}
+
+// SaveFile writes SharedHistory to the file at path. See History.SaveFile for details.
+func (s *SharedHistory) SaveFile(path string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.h.SaveFile(path)
+}
+
+// LoadFile reads the file at path and adds its entries to SharedHistory. See History.LoadFile for details.
+// Subscribers are not notified of the loaded entries.
+func (s *SharedHistory) LoadFile(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h.LoadFile(path)
+}
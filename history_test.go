@@ -0,0 +1,347 @@
+package linesqueak_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestHistory_WriteTo(t *testing.T) {
+	var h linesqueak.History
+	h.AddEntry(linesqueak.HistoryEntry{Line: "foo"})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "bar\nbaz", Time: time.Unix(1600000000, 0)})
+	h.AddEntry(linesqueak.HistoryEntry{Line: `C:\`, Tag: "alice"})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "#1", Time: time.Unix(1600000001, 0), Tag: "bob"})
+	h.Save("editing")
+
+	var b bytes.Buffer
+	n, err := h.WriteTo(&b)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := b.String(); s != "foo\n#1600000000\nbar\\nbaz\n#0 alice\nC:\\\\\n#1600000001 bob\n\\#1\n" {
+		t.Errorf(`expected "foo\n#1600000000\nbar\\nbaz\n#0 alice\nC:\\\\\n#1600000001 bob\n\\#1\n" got %#v`, s)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("expected %d got %d", b.Len(), n)
+	}
+}
+
+func TestHistory_ReadFrom(t *testing.T) {
+	var h linesqueak.History
+	h.Add("foo")
+
+	if _, err := h.ReadFrom(bytes.NewBufferString("bar\\nbaz\n\n#1600000000 alice\nC:\\\\\n#comment\n\\#1\nqux")); err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"foo", "bar\nbaz", `C:\`, "#comment", "#1", "qux", ""}
+	if !reflect.DeepEqual(h.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, h.Lines)
+	}
+	if h.Pos != 6 {
+		t.Errorf("expected 6 got %d", h.Pos)
+	}
+	if ent := h.Entry(2); !ent.Time.Equal(time.Unix(1600000000, 0)) || ent.Tag != "alice" {
+		t.Errorf("expected 1600000000 and alice got %v and %q", ent.Time, ent.Tag)
+	}
+	if ent := h.Entry(3); !ent.Time.IsZero() || ent.Tag != "" {
+		t.Errorf("expected no metadata got %v and %q", ent.Time, ent.Tag)
+	}
+}
+
+func TestHistory_SaveFileLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	var h linesqueak.History
+	if err := h.LoadFile(path); err != nil {
+		t.Error(err)
+	}
+	h.Add("foo")
+	h.Add("bar\nbaz")
+	if err := h.SaveFile(path); err != nil {
+		t.Error(err)
+	}
+
+	h.AddEntry(linesqueak.HistoryEntry{Line: "qux", Time: time.Unix(1600000000, 0), Tag: "alice"})
+	if err := h.SaveFile(path); err != nil {
+		t.Error(err)
+	}
+
+	var l linesqueak.History
+	if err := l.LoadFile(path); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(l.Lines, h.Lines) {
+		t.Errorf("expected %#v got %#v", h.Lines, l.Lines)
+	}
+	for i := 0; i < h.Len(); i++ {
+		if e, a := h.Entry(i), l.Entry(i); a.Time.Unix() != e.Time.Unix() || a.Tag != e.Tag {
+			t.Errorf("%d: expected %v and %q got %v and %q", i, e.Time, e.Tag, a.Time, a.Tag)
+		}
+	}
+
+	l.Expire(time.Unix(1600000001, 0))
+	if expected := []string{"foo", "bar\nbaz", ""}; !reflect.DeepEqual(l.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, l.Lines)
+	}
+}
+
+func TestHistory_ReadFormat(t *testing.T) {
+	t.Run("bash", func(t *testing.T) {
+		var h linesqueak.History
+		if err := h.ReadFormat(bytes.NewBufferString("ls\ncd /\n"), linesqueak.HistoryFormatBash); err != nil {
+			t.Error(err)
+		}
+		if err := h.ReadFormat(bytes.NewBufferString("#1600000000\nfor i in 1 2\ndo echo $i\ndone\n#1600000001\nls\n"), linesqueak.HistoryFormatBash); err != nil {
+			t.Error(err)
+		}
+
+		expected := []string{"ls", "cd /", "for i in 1 2\ndo echo $i\ndone", "ls", ""}
+		if !reflect.DeepEqual(h.Lines, expected) {
+			t.Errorf("expected %#v got %#v", expected, h.Lines)
+		}
+	})
+
+	t.Run("zsh", func(t *testing.T) {
+		var h linesqueak.History
+		if err := h.ReadFormat(bytes.NewBufferString(": 1600000000:0;ls -l\n: 1600000001:3;for i in 1 2\\\ndo echo $i\\\ndone\necho \xc3\x83\x80\n"), linesqueak.HistoryFormatZsh); err != nil {
+			t.Error(err)
+		}
+
+		expected := []string{"ls -l", "for i in 1 2\ndo echo $i\ndone", "echo à", ""}
+		if !reflect.DeepEqual(h.Lines, expected) {
+			t.Errorf("expected %#v got %#v", expected, h.Lines)
+		}
+	})
+}
+
+func TestHistory_WriteFormat(t *testing.T) {
+	var h linesqueak.History
+	if err := h.ReadFormat(bytes.NewBufferString(": 1600000000:0;ls -l\n: 1600000001:0;echo \\\n\xc3\x83\x80\n"), linesqueak.HistoryFormatZsh); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("bash", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := h.WriteFormat(&b, linesqueak.HistoryFormatBash); err != nil {
+			t.Error(err)
+		}
+		if s := b.String(); s != "#1600000000\nls -l\n#1600000001\necho \nà\n" {
+			t.Errorf("unexpected %#v", s)
+		}
+	})
+
+	t.Run("zsh", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := h.WriteFormat(&b, linesqueak.HistoryFormatZsh); err != nil {
+			t.Error(err)
+		}
+		if s := b.String(); s != ": 1600000000:0;ls -l\n: 1600000001:0;echo \\\n\xc3\x83\x80\n" {
+			t.Errorf("unexpected %#v", s)
+		}
+	})
+}
+
+func TestHistory_WriteFormatBashRoundTrip(t *testing.T) {
+	var h linesqueak.History
+	h.AddEntry(linesqueak.HistoryEntry{Line: "ls", Time: time.Unix(1600000000, 0)})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "pwd"})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "for i in 1 2\ndo echo $i\ndone", Time: time.Unix(1600000001, 0)})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "echo a\necho b"})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "cd /", Time: time.Unix(1600000002, 0)})
+
+	var b bytes.Buffer
+	if err := h.WriteFormat(&b, linesqueak.HistoryFormatBash); err != nil {
+		t.Error(err)
+	}
+
+	var l linesqueak.History
+	if err := l.ReadFormat(&b, linesqueak.HistoryFormatBash); err != nil {
+		t.Error(err)
+	}
+
+	if !reflect.DeepEqual(l.Lines, h.Lines) {
+		t.Errorf("expected %#v got %#v", h.Lines, l.Lines)
+	}
+	for i := 0; i < h.Len(); i++ {
+		if e, a := h.Entry(i).Time, l.Entry(i).Time; !a.Equal(e) {
+			t.Errorf("%d: expected %v got %v", i, e, a)
+		}
+	}
+}
+
+func TestHistory_MaxLen(t *testing.T) {
+	h := linesqueak.History{MaxLen: 2}
+	h.Add("foo")
+	h.Add("bar")
+	h.Add("baz")
+
+	expected := []string{"bar", "baz", ""}
+	if !reflect.DeepEqual(h.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, h.Lines)
+	}
+	if h.Pos != 2 {
+		t.Errorf("expected 2 got %d", h.Pos)
+	}
+}
+
+func TestHistory_Entries(t *testing.T) {
+	h := linesqueak.History{Tag: "alice"}
+	h.AddEntry(linesqueak.HistoryEntry{Line: "foo", Time: time.Unix(100, 0), Tag: "bob"})
+	h.Add("bar")
+	h.Save("editing")
+
+	ents := h.Entries()
+	if len(ents) != 2 {
+		t.Fatalf("expected 2 got %d", len(ents))
+	}
+	if e := ents[0]; e.Line != "foo" || !e.Time.Equal(time.Unix(100, 0)) || e.Tag != "bob" {
+		t.Errorf("unexpected %#v", e)
+	}
+	if e := ents[1]; e.Line != "bar" || e.Time.IsZero() || e.Tag != "alice" {
+		t.Errorf("unexpected %#v", e)
+	}
+
+	h.Expire(time.Unix(200, 0))
+	expected := []string{"bar", "editing"}
+	if !reflect.DeepEqual(h.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, h.Lines)
+	}
+	if e := h.Entry(0); e.Tag != "alice" {
+		t.Errorf("unexpected %#v", e)
+	}
+}
+
+func TestHistory_RemoveAt(t *testing.T) {
+	var h linesqueak.History
+	h.AddEntry(linesqueak.HistoryEntry{Line: "foo", Tag: "alice"})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "bar", Tag: "bob"})
+	h.AddEntry(linesqueak.HistoryEntry{Line: "baz", Tag: "carol"})
+
+	h.RemoveAt(1)
+	if h.Len() != 2 {
+		t.Errorf("expected 2 got %d", h.Len())
+	}
+	expected := []string{"foo", "baz", ""}
+	if !reflect.DeepEqual(h.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, h.Lines)
+	}
+	if h.Pos != 2 {
+		t.Errorf("expected 2 got %d", h.Pos)
+	}
+	if e := h.Entry(1); e.Tag != "carol" {
+		t.Errorf("unexpected %#v", e)
+	}
+
+	h.Clear()
+	if h.Len() != 0 {
+		t.Errorf("expected 0 got %d", h.Len())
+	}
+	h.Add("qux")
+	if h.Len() != 1 || h.Entry(0).Line != "qux" {
+		t.Errorf("unexpected %#v", h.Lines)
+	}
+}
+
+func TestHistory_Sanitize(t *testing.T) {
+	h := linesqueak.History{
+		Sanitize: func(l string) (string, bool) {
+			if strings.HasPrefix(l, "login ") {
+				return "", false
+			}
+			return strings.ReplaceAll(l, "s3cr3t", "***"), true
+		},
+	}
+	h.Add("login alice")
+	h.Add("curl -H 'Authorization: s3cr3t'")
+
+	expected := []string{"curl -H 'Authorization: ***'", ""}
+	if !reflect.DeepEqual(h.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, h.Lines)
+	}
+}
+
+func TestHistory_Search(t *testing.T) {
+	var h linesqueak.History
+	h.Add("git status")
+	h.Add("go test ./...")
+	h.Add("git commit")
+	h.Save("git")
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		mode     linesqueak.SearchMode
+		expected []linesqueak.Match
+	}{
+		{
+			name:  "prefix",
+			query: "git",
+			mode:  linesqueak.SearchPrefix,
+			expected: []linesqueak.Match{
+				{Index: 2, Ranges: []linesqueak.MatchRange{{Start: 0, End: 3}}},
+				{Index: 0, Ranges: []linesqueak.MatchRange{{Start: 0, End: 3}}},
+			},
+		},
+		{
+			name:  "substring",
+			query: "t",
+			mode:  linesqueak.SearchSubstring,
+			expected: []linesqueak.Match{
+				{Index: 2, Ranges: []linesqueak.MatchRange{{Start: 2, End: 3}}},
+				{Index: 1, Ranges: []linesqueak.MatchRange{{Start: 3, End: 4}}},
+				{Index: 0, Ranges: []linesqueak.MatchRange{{Start: 2, End: 3}}},
+			},
+		},
+		{
+			name:  "fuzzy",
+			query: "GST",
+			mode:  linesqueak.SearchFuzzy,
+			expected: []linesqueak.Match{
+				{Index: 1, Ranges: []linesqueak.MatchRange{{Start: 0, End: 1}, {Start: 5, End: 7}}},
+				{Index: 0, Ranges: []linesqueak.MatchRange{{Start: 0, End: 1}, {Start: 4, End: 6}}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if ms := h.Search(tc.query, tc.mode); !reflect.DeepEqual(ms, tc.expected) {
+				t.Errorf("expected %#v got %#v", tc.expected, ms)
+			}
+		})
+	}
+}
+
+func TestSharedHistory(t *testing.T) {
+	s := linesqueak.NewSharedHistory(0)
+	c, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Add("foo")
+			h := s.Snapshot()
+			h.Save("editing")
+			_ = h.Prev()
+		}()
+	}
+	wg.Wait()
+
+	if h := s.Snapshot(); len(h.Lines) != 11 || h.Pos != 10 {
+		t.Errorf("unexpected %#v", h)
+	}
+	for i := 0; i < 10; i++ {
+		if ent := <-c; ent.Line != "foo" {
+			t.Errorf(`expected "foo" got %#v`, ent.Line)
+		}
+	}
+}
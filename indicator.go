@@ -0,0 +1,52 @@
+package linesqueak
+
+import "fmt"
+
+// Indicator decides what's displayed on the row beneath the user input to tell where the cursor is or how long the input is.
+type Indicator int
+
+const (
+	// IndicatorNone displays nothing.
+	IndicatorNone Indicator = iota
+
+	// IndicatorColumn displays the column of the cursor and the number of characters in the line
+	// e.g. "col 12/80" when the cursor is on the 12th character of the 80 characters.
+	IndicatorColumn
+
+	// IndicatorBytes displays the length of the user input in UTF-8 e.g. "42 bytes"
+	// for protocols which limit the length of lines in bytes.
+	IndicatorBytes
+)
+
+// indicator returns the text of Indicator for Buffer and Pos or "" if there's nothing to display.
+// It's cleared when the user input is accepted.
+func (e *Editor) indicator() string {
+	if e.accepting {
+		return ""
+	}
+	switch e.Indicator {
+	case IndicatorColumn:
+		start := e.lineStart(e.Pos)
+		return fmt.Sprintf("col %d/%d", e.Pos-start+1, e.lineEnd(e.Pos)-start)
+	case IndicatorBytes:
+		n := len(string(e.Buffer))
+		if n == 1 {
+			return "1 byte"
+		}
+		return fmt.Sprintf("%d bytes", n)
+	default:
+		return ""
+	}
+}
+
+// messages returns the message followed by the indicator which are displayed beneath the user input.
+func (e *Editor) messages(ind string) string {
+	switch {
+	case ind == "":
+		return e.message
+	case e.message == "":
+		return ind
+	default:
+		return e.message + "\n" + ind
+	}
+}
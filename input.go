@@ -0,0 +1,203 @@
+package linesqueak
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// ReadDeadliner is a connection which supports read deadlines e.g. net.Conn.
+type ReadDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// errNeedInput is returned by readRune when Feeder has run out of the fed input.
+var errNeedInput = errors.New("need more input")
+
+// readResult is a rune or an error read from the terminal.
+type readResult struct {
+	r   rune
+	err error
+}
+
+// readRune reads a rune from the terminal.
+// If ctx is cancellable, it reads in a separate goroutine so that it can return as soon as ctx is done.
+// In that case, the goroutine keeps reading in the background and the rune will be delivered to the next call.
+// The same goes for IdleTimeout.
+func (e *Editor) readRune(ctx context.Context) (rune, error) {
+	r, err := e.readRuneOpen(ctx)
+	if e.closed {
+		return 0, ErrClosed
+	}
+	return r, err
+}
+
+// readRuneOpen is readRune regardless of Close.
+func (e *Editor) readRuneOpen(ctx context.Context) (rune, error) {
+	if n := len(e.unread); n > 0 {
+		res := e.unread[n-1]
+		e.unread = e.unread[:n-1]
+		e.record(res)
+		return res.r, res.err
+	}
+
+	if err := e.catchUp(); err != nil {
+		return 0, err
+	}
+
+	if e.feeder != nil {
+		res, ok := e.feeder.read(e.InvalidUTF8)
+		if !ok {
+			return 0, errNeedInput
+		}
+		e.record(res)
+		return res.r, res.err
+	}
+
+	if e.runes == nil && e.Conn != nil {
+		if res, ok := e.readDeadline(ctx); ok {
+			e.record(res)
+			return res.r, res.err
+		}
+	}
+
+	if e.runes == nil && ctx.Done() == nil && e.IdleTimeout <= 0 {
+		var res readResult
+		e.unlocked(func() {
+			res.r, res.err = readValidRune(e.In, e.InvalidUTF8)
+		})
+		e.record(res)
+		return res.r, res.err
+	}
+
+	var idle <-chan time.Time
+	if e.IdleTimeout > 0 {
+		t := time.NewTimer(e.IdleTimeout)
+		defer t.Stop()
+		idle = t.C
+	}
+
+	runes := e.background()
+	var res readResult
+	var received bool
+	e.unlocked(func() {
+		select {
+		case res = <-runes:
+			received = true
+		case <-ctx.Done():
+			res.err = ctx.Err()
+		case <-idle:
+			res.err = ErrIdleTimeout
+		}
+	})
+	if received {
+		e.received(res)
+	}
+	return res.r, res.err
+}
+
+// readDeadline reads a rune from In while Conn's read deadline is set according to ctx and IdleTimeout.
+// It returns false if Conn doesn't support deadlines.
+func (e *Editor) readDeadline(ctx context.Context) (readResult, bool) {
+	var d time.Time
+	var idle bool // the deadline is of IdleTimeout rather than ctx.
+	if e.IdleTimeout > 0 {
+		d = time.Now().Add(e.IdleTimeout)
+		idle = true
+	}
+	if cd, ok := ctx.Deadline(); ok && (d.IsZero() || cd.Before(d)) {
+		d = cd
+		idle = false
+	}
+	err := e.Conn.SetReadDeadline(d)
+	if err != nil {
+		return readResult{}, false
+	}
+
+	conn := e.Conn
+	if done := ctx.Done(); done != nil {
+		// Cancellation has to interrupt the read as well.
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				_ = conn.SetReadDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+	}
+
+	var r rune
+	e.unlocked(func() {
+		r, err = readValidRune(e.In, e.InvalidUTF8)
+	})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		if err := ctx.Err(); err != nil {
+			return readResult{err: err}, true
+		}
+		if !idle {
+			// The deadline of ctx can expire on Conn before ctx notices it.
+			return readResult{err: context.DeadlineExceeded}, true
+		}
+		return readResult{err: ErrIdleTimeout}, true
+	}
+	return readResult{r: r, err: err}, true
+}
+
+// unreadRune pushes back r so that the next readRune returns it.
+func (e *Editor) unreadRune(r rune) {
+	e.unreadResult(readResult{r: r})
+}
+
+// unreadResult pushes back res so that the next readRune returns it.
+func (e *Editor) unreadResult(res readResult) {
+	if n := len(e.recording); n > 0 && res.err == nil {
+		// It belongs to the next command.
+		e.recording = e.recording[:n-1]
+	}
+	e.unread = append(e.unread, res)
+}
+
+// record keeps res if a command is being recorded to be repeated by a numeric argument.
+func (e *Editor) record(res readResult) {
+	if e.recording == nil || res.err != nil {
+		return
+	}
+	e.recording = append(e.recording, res.r)
+}
+
+// background starts reading in a separate goroutine if it's not started yet
+// and returns the channel which delivers the results.
+func (e *Editor) background() <-chan readResult {
+	if e.runes == nil {
+		e.runes = make(chan readResult, 1)
+		go read(e.In, e.InvalidUTF8, e.runes)
+	}
+	return e.runes
+}
+
+// received has to be called when a result is received from the channel returned by background.
+func (e *Editor) received(res readResult) {
+	e.record(res)
+	if res.err != nil {
+		// the goroutine has stopped reading.
+		e.runes = nil
+	}
+}
+
+func read(in *bufio.Reader, p InvalidUTF8Policy, runes chan<- readResult) {
+	for {
+		r, err := readValidRune(in, p)
+		runes <- readResult{r: r, err: err}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package linesqueak
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Directions of incremental search.
+const (
+	searchBackward = -1
+	searchForward  = 1
+)
+
+// editSearch searches History incrementally as user types like reverse-search-history and forward-search-history of readline.
+// Ctrl-R and Ctrl-S search further backward and forward wrapping around at the ends of History.
+// If the query is empty, they resume the previous query.
+// Ctrl-G reverts to the original input and any other key accepts the match and is handled as usual.
+func (e *Editor) editSearch(dir int) error {
+	e.syncHistory()
+
+	b, p := e.Buffer, e.Pos
+	orig := string(b)
+
+	// The original input is searched as well as the last entry.
+	ents := make([]string, 0, len(e.History.Lines))
+	ents = append(ents, e.History.entries()...)
+	ents = append(ents, orig)
+	cur := len(ents) - 1
+
+	var q string
+	ok := true
+	leave := func() {
+		e.searchPrompt = ""
+		e.highlights = nil
+		if q != "" {
+			e.lastSearch = q
+		}
+	}
+
+	refresh := func() error {
+		e.searchPrompt = searchPrompt(dir, q, ok)
+		e.Buffer = []rune(ents[cur])
+		e.Pos = searchPos(ents[cur], q, dir)
+		if cur == len(ents)-1 && q == "" {
+			e.Pos = p
+		}
+		e.highlights = nil
+		if q != "" && strings.Contains(ents[cur], q) {
+			e.highlights = []MatchRange{{Start: e.Pos, End: e.Pos + len([]rune(q))}}
+		}
+		return e.refreshLine()
+	}
+
+	if err := refresh(); err != nil {
+		leave()
+		return err
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+
+			switch {
+			case r == ctrlR || r == ctrlS:
+				dir = searchBackward
+				if r == ctrlS {
+					dir = searchForward
+				}
+				if q == "" {
+					q = e.lastSearch
+					cur, ok = searchHistory(ents, q, cur, dir, true)
+					break
+				}
+				cur, ok = searchHistory(ents, q, cur, dir, false)
+			case r == backspace || r == ctrlH:
+				if q == "" {
+					break
+				}
+				rs := []rune(q)
+				q = string(rs[:len(rs)-1])
+				cur, ok = searchHistory(ents, q, len(ents)-1, dir, true)
+			case r == ctrlG:
+				e.searchPrompt, e.highlights = "", nil
+				e.Buffer, e.Pos = b, p
+				return true, e.refreshLine()
+			case r >= space && r != backspace:
+				q += string(r)
+				cur, ok = searchHistory(ents, q, cur, dir, true)
+			default:
+				// The match is accepted and the key is handled as usual.
+				e.unreadRune(r)
+				e.searchPrompt, e.highlights = "", nil
+				if cur == len(ents)-1 {
+					e.Buffer, e.Pos = b, p
+					return true, e.refreshLine()
+				}
+				m, pos := e.Buffer, e.Pos
+				e.Buffer, e.Pos = b, p
+				e.saveUndo()
+				e.Buffer, e.Pos = m, pos
+				return true, e.refreshLine()
+			}
+
+			return false, refresh()
+		},
+		leave: leave,
+	})
+	return nil
+}
+
+// searchHistory returns the index of the next entry in dir from ents[from] which contains q wrapping around at the ends.
+// If inclusive is true, ents[from] itself is a candidate. Entries same as ents[from] are skipped.
+// If there's no such entry, it returns from and false.
+func searchHistory(ents []string, q string, from, dir int, inclusive bool) (int, bool) {
+	if inclusive && strings.Contains(ents[from], q) {
+		return from, true
+	}
+	n := len(ents)
+	for k := 1; k < n; k++ {
+		i := ((from+dir*k)%n + n) % n
+		if ents[i] == ents[from] {
+			continue
+		}
+		if strings.Contains(ents[i], q) {
+			return i, true
+		}
+	}
+	return from, strings.Contains(ents[from], q)
+}
+
+// searchPos returns the position of q in l where the cursor is placed.
+func searchPos(l, q string, dir int) int {
+	i := strings.LastIndex(l, q)
+	if dir == searchForward {
+		i = strings.Index(l, q)
+	}
+	if i < 0 {
+		return len([]rune(l))
+	}
+	return len([]rune(l[:i]))
+}
+
+// searchPrompt returns the prompt displayed while incremental search is running like readline.
+func searchPrompt(dir int, q string, ok bool) string {
+	s := "i-search"
+	if dir == searchBackward {
+		s = "reverse-" + s
+	}
+	if !ok {
+		s = "failed " + s
+	}
+	return fmt.Sprintf("(%s)`%s': ", s, q)
+}
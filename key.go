@@ -0,0 +1,394 @@
+package linesqueak
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Key identifies a key which doesn't type a printable character.
+type Key int
+
+// Control keys. Their values are the control characters they send.
+const (
+	KeyCtrlA Key = iota + 1
+	KeyCtrlB
+	KeyCtrlC
+	KeyCtrlD
+	KeyCtrlE
+	KeyCtrlF
+	KeyCtrlG
+	KeyCtrlH
+	KeyCtrlI
+	KeyCtrlJ
+	KeyCtrlK
+	KeyCtrlL
+	KeyCtrlM
+	KeyCtrlN
+	KeyCtrlO
+	KeyCtrlP
+	KeyCtrlQ
+	KeyCtrlR
+	KeyCtrlS
+	KeyCtrlT
+	KeyCtrlU
+	KeyCtrlV
+	KeyCtrlW
+	KeyCtrlX
+	KeyCtrlY
+	KeyCtrlZ
+	KeyEsc
+	KeyCtrlBackslash
+	KeyCtrlRightBracket
+	KeyCtrlCaret
+	KeyCtrlUnderscore
+
+	KeyBackspace Key = 127
+
+	KeyTab   = KeyCtrlI
+	KeyEnter = KeyCtrlM
+)
+
+// Special keys. Their values are out of the range of Unicode so that they don't collide with characters.
+const (
+	KeyUp Key = iota + unicode.MaxRune + 1
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyShiftTab
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+)
+
+// Mod is a set of modifier keys.
+type Mod int
+
+// Modifier keys in the order of xterm's encoding.
+const (
+	ModShift Mod = 1 << iota
+	ModAlt
+	ModCtrl
+	ModMeta
+)
+
+// KeyEvent is a key stroke decoded from the terminal.
+type KeyEvent struct {
+	// Key is the control key or the special key e.g. KeyCtrlA or KeyF1. It's 0 for printable characters.
+	Key Key
+
+	// Rune is the typed character. Control keys are represented as control characters e.g. '\x01' for Ctrl-A.
+	// It's 0 for special keys e.g. arrow keys.
+	Rune rune
+
+	// Mod is the modifier keys pressed along with the key.
+	// Keys prefixed with ESC are reported with ModAlt. Control keys e.g. Ctrl-A don't have ModCtrl since it's a part of Key.
+	Mod Mod
+
+	// Sequence is the escape sequence sent by a special key e.g. "\x1b[A" for Up.
+	Sequence string
+
+	csi *csi // the parsed control sequence if it's ESC [.
+	ss3 rune // the character following ESC O if it's ESC O.
+}
+
+// internal tells if it's not a key stroke but a report from the terminal or the beginning of pasted text.
+func (k KeyEvent) internal() bool {
+	if k.csi == nil {
+		return false
+	}
+	c := k.csi
+	switch {
+	case c.private == '<', c.private == 0 && c.final == 'M' && len(c.params) == 0: // mouse
+		return true
+	case c.final == 'R': // cursor position report
+		return true
+	case c.final == '~' && len(c.params) > 0 && c.params[0] == 200: // bracketed paste
+		return true
+	default:
+		return false
+	}
+}
+
+// readKey reads a key stroke from the terminal.
+func (e *Editor) readKey(ctx context.Context) (KeyEvent, error) {
+	r, err := e.readRuneHinting(ctx)
+	if err != nil {
+		return KeyEvent{}, err
+	}
+
+	if r != esc {
+		return KeyEvent{Key: control(r), Rune: r}, nil
+	}
+
+	return e.readEscape(ctx)
+}
+
+// unreadKey pushes back k so that it's read again by the next readKey.
+func (e *Editor) unreadKey(k KeyEvent) {
+	var rs []rune
+	switch {
+	case k.Sequence != "":
+		rs = []rune(k.Sequence)
+	case k.Mod&ModAlt != 0:
+		rs = []rune{esc, k.Rune}
+	default:
+		rs = []rune{k.Rune}
+	}
+	for i := len(rs) - 1; i >= 0; i-- {
+		e.unreadRune(rs[i])
+	}
+}
+
+// readEscape reads the rest of a key stroke which starts with ESC.
+// If nothing follows ESC within EscapeTimeout, it's Esc by itself.
+func (e *Editor) readEscape(ctx context.Context) (KeyEvent, error) {
+	rctx := ctx
+	if e.EscapeTimeout > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(ctx, e.EscapeTimeout)
+		defer cancel()
+	}
+
+	r, err := e.readRune(rctx)
+	if e.EscapeTimeout > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return KeyEvent{Key: KeyEsc, Rune: esc}, nil
+	}
+	if e.EscapeTimeout > 0 && errors.Is(err, errNeedInput) {
+		// Feeder can't wait for EscapeTimeout. An escape sequence arrives at once, so ESC at the end of the fed input is Esc by itself.
+		return KeyEvent{Key: KeyEsc, Rune: esc}, nil
+	}
+	if err != nil {
+		return KeyEvent{}, err
+	}
+
+	switch r {
+	case '[':
+		c, ok, err := e.readCSI(ctx)
+		if err != nil {
+			return KeyEvent{}, err
+		}
+		if !ok {
+			return KeyEvent{Sequence: "\x1b[" + c.raw}, nil
+		}
+		return KeyEvent{Key: c.key(), Mod: c.mod(), Sequence: "\x1b[" + c.raw, csi: &c}, nil
+	case 'O':
+		// Some terminals send modifiers as parameters e.g. ESC O 5 P for Ctrl-F1.
+		var seq strings.Builder
+		seq.WriteString("\x1bO")
+		var p int
+		for {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return KeyEvent{}, err
+			}
+
+			if r < 0x20 || r == 0x7f {
+				// It's interrupted by a control character e.g. Ctrl-C.
+				e.unreadRune(r)
+				return KeyEvent{Sequence: seq.String()}, nil
+			}
+
+			if seq.Len() < maxSequence {
+				seq.WriteRune(r)
+			}
+
+			switch {
+			case isDigit(r):
+				if p <= maxParam {
+					p = p*10 + int(r-'0')
+				}
+			case r == ';':
+				p = 0
+			default:
+				return KeyEvent{Key: ss3Keys[r], Mod: modParam(p), Sequence: seq.String(), ss3: r}, nil
+			}
+		}
+	default:
+		return KeyEvent{Key: control(r), Rune: r, Mod: ModAlt}, nil
+	}
+}
+
+// csi is a control sequence following ESC [.
+// https://www.ecma-international.org/publications-and-standards/standards/ecma-48/
+type csi struct {
+	// private is a private parameter marker e.g. '<' or '?' if any.
+	private rune
+
+	// params are numeric parameters. Omitted parameters are 0.
+	// e.g. ESC [ 1 ; 5 C results in [1, 5].
+	// Sub-parameters separated by colons are ignored.
+	params []int
+
+	// intermediates are the characters between the parameters and the final character e.g. '$' or ' '.
+	intermediates string
+
+	// final is the character which terminates the sequence.
+	final rune
+
+	// raw is the sequence as it's read excluding ESC [.
+	raw string
+}
+
+const (
+	// maxSequence limits the length of control sequences so that a malicious client can't exhaust memory.
+	maxSequence = 64
+
+	// maxParam limits the value of numeric parameters so that they don't overflow.
+	maxParam = 1<<16 - 1
+)
+
+// readCSI reads a control sequence following ESC [.
+// If it's interrupted by a control character, the control character is pushed back and it returns false.
+func (e *Editor) readCSI(ctx context.Context) (csi, bool, error) {
+	var c csi
+	var p int
+	var param, sub bool
+	var raw, inter strings.Builder
+	for {
+		r, err := e.readRune(ctx)
+		if err != nil {
+			return c, false, err
+		}
+
+		if r < 0x20 || r == 0x7f {
+			e.unreadRune(r)
+			c.raw = raw.String()
+			return c, false, nil
+		}
+
+		if raw.Len() < maxSequence {
+			raw.WriteRune(r)
+		}
+
+		switch {
+		case '0' <= r && r <= '9' && inter.Len() == 0:
+			if !sub && p <= maxParam {
+				p = p*10 + int(r-'0')
+			}
+			param = true
+		case r == ';' && inter.Len() == 0:
+			if len(c.params) < maxSequence {
+				c.params = append(c.params, p)
+			}
+			p = 0
+			param, sub = true, false
+		case r == ':' && inter.Len() == 0:
+			sub = true
+		case '<' <= r && r <= '?' && !param && c.private == 0 && inter.Len() == 0:
+			c.private = r
+		case 0x20 <= r && r <= 0x2f: // intermediate character
+			if inter.Len() < maxSequence {
+				inter.WriteRune(r)
+			}
+		case 0x40 <= r && r <= 0x7e: // final character
+			if param && len(c.params) < maxSequence {
+				c.params = append(c.params, p)
+			}
+			c.intermediates = inter.String()
+			c.final = r
+			c.raw = raw.String()
+			return c, true, nil
+		}
+	}
+}
+
+// key returns the special key which sends the control sequence or 0 if it's unknown.
+func (c *csi) key() Key {
+	if c.private != 0 || c.intermediates != "" {
+		return 0
+	}
+
+	if c.final == '~' {
+		if len(c.params) == 0 {
+			return 0
+		}
+		return tildeKeys[c.params[0]]
+	}
+
+	// ESC [ R is a cursor position report rather than F3.
+	if c.final == 'R' {
+		return 0
+	}
+
+	return ss3Keys[c.final]
+}
+
+// ss3Keys are special keys identified by the final characters of ESC O or ESC [ sequences.
+var ss3Keys = map[rune]Key{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'Z': KeyShiftTab,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+}
+
+// tildeKeys are special keys identified by the first parameters of ESC [ ~ sequences.
+var tildeKeys = map[int]Key{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+}
+
+// mod returns the modifier keys encoded in the second parameter.
+func (c *csi) mod() Mod {
+	if c.private != 0 || len(c.params) < 2 {
+		return 0
+	}
+	return modParam(c.params[1])
+}
+
+// modParam decodes xterm's modifier parameter which is 1 + the modifier bits.
+func modParam(p int) Mod {
+	if p < 1 {
+		return 0
+	}
+	return Mod(p - 1)
+}
+
+// control returns the control key for r or 0 if r is not a control character.
+func control(r rune) Key {
+	if r < space || r == backspace {
+		return Key(r)
+	}
+	return 0
+}
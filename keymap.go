@@ -0,0 +1,126 @@
+package linesqueak
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Keymap binds key strokes to actions, named commands or nested keymaps for multi-key bindings e.g. Ctrl-X Ctrl-E.
+// Printable characters are identified by their code points e.g. Key('u').
+// Meta with a key is looked up as ESC followed by the key like readline e.g. Keymap{KeyEsc: {Keymap: Keymap{Key('b'): ...}}}.
+// Esc by itself, which is distinguished by EscapeTimeout, performs Action or Command of KeyEsc.
+// Key strokes with other modifiers e.g. Ctrl-Left aren't looked up.
+type Keymap map[Key]Binding
+
+// Binding is what a key stroke is bound to. Only one of the fields should be set.
+type Binding struct {
+	// Action is performed when the key stroke is typed.
+	Action Action
+
+	// Command is the name of a command performed when the key stroke is typed. See DoCommand.
+	Command string
+
+	// Keymap makes the key stroke a prefix. The following key stroke is looked up in Keymap.
+	Keymap Keymap
+}
+
+// ctrlXKeymap is the default multi-key bindings which start with Ctrl-X.
+var ctrlXKeymap = Keymap{
+	KeyCtrlU: {Action: ActionUndo},
+	Key('u'): {Action: ActionUndo},
+	KeyCtrlR: {Action: ActionRedo},
+	KeyCtrlE: {Action: ActionEditExternal},
+}
+
+// lookup calls f with the binding of k in m. If k is a prefix, f is called with the binding of the following key strokes
+// once they're typed. It returns false if k isn't bound in m.
+func (e *Editor) lookup(m Keymap, k KeyEvent, f func(Binding) error) (bool, error) {
+	key := k.Key
+	if key == 0 {
+		key = Key(k.Rune)
+	}
+	if key == 0 {
+		return false, nil
+	}
+
+	switch k.Mod {
+	case 0:
+	case ModAlt:
+		p, ok := m[KeyEsc]
+		if !ok || p.Keymap == nil {
+			return false, nil
+		}
+		m = p.Keymap
+	default:
+		return false, nil
+	}
+
+	b, ok := m[key]
+	if !ok {
+		return false, nil
+	}
+	if b.Keymap == nil || (key == KeyEsc && k.Mod == 0) {
+		// Esc by itself is distinguished by EscapeTimeout.
+		return true, f(b)
+	}
+	e.chord(b.Keymap, f)
+	return true, nil
+}
+
+// chord starts reading the next key stroke of a multi-key binding and calls f with its binding in m.
+// If it's not bound in m or KeymapTimeout passes before it's typed, f is called with the zero Binding which does nothing.
+func (e *Editor) chord(m Keymap, f func(Binding) error) {
+	var deadline time.Time
+	if e.KeymapTimeout > 0 {
+		deadline = time.Now().Add(e.KeymapTimeout)
+	}
+
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			kctx := ctx
+			if !deadline.IsZero() {
+				var cancel context.CancelFunc
+				kctx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+
+			k, err := e.readKey(kctx)
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+					return true, f(Binding{})
+				}
+				return false, err
+			}
+
+			if ok, err := e.lookup(m, k, f); ok {
+				return true, err
+			}
+			return true, f(Binding{})
+		},
+	})
+}
+
+// doBinding performs b. k is the key stroke which triggered it.
+// Commands are called without locking the editor.
+func (e *Editor) doBinding(ctx context.Context, b Binding, k KeyEvent) error {
+	switch {
+	case b.Command != "":
+		if c, ok := e.Commands[b.Command]; ok {
+			var err error
+			e.unlocked(func() {
+				err = c(e)
+			})
+			return err
+		}
+		a, ok := ActionByName(b.Command)
+		if !ok {
+			return e.beep()
+		}
+		return e.perform(ctx, a, k)
+	case b.Action != ActionNone:
+		return e.perform(ctx, b.Action, k)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package linesqueak
+
+import "fmt"
+
+// LineNumbers decides how the lines of multiline user input are numbered.
+type LineNumbers int
+
+const (
+	// LineNumbersNone doesn't number lines.
+	LineNumbersNone LineNumbers = iota
+
+	// LineNumbersAbsolute numbers lines from 1 at the beginning of the user input.
+	LineNumbersAbsolute
+
+	// LineNumbersRelative numbers lines by the distance from the line with the cursor like vi's relativenumber.
+	// The line with the cursor is numbered absolutely.
+	LineNumbersRelative
+)
+
+// continuationPrompts returns a function which returns the prompt for the n-th line of Buffer counting from 0.
+// The prompt is ContinuationPrompt or the result of ContinuationPromptFunc
+// preceded by the line number if LineNumbers is enabled.
+func (e *Editor) continuationPrompts() func(n int) string {
+	prompt := func(n int) string {
+		if e.ContinuationPromptFunc != nil {
+			return validUTF8(e.ContinuationPromptFunc(n + 1))
+		}
+		return validUTF8(e.ContinuationPrompt)
+	}
+	if e.LineNumbers == LineNumbersNone {
+		return prompt
+	}
+
+	lines, cur := 1, 0
+	for i, r := range e.Buffer {
+		if r != '\n' {
+			continue
+		}
+		lines++
+		if i < e.Pos {
+			cur++
+		}
+	}
+	w := len(fmt.Sprint(lines))
+
+	return func(n int) string {
+		num := n + 1
+		if e.LineNumbers == LineNumbersRelative && n != cur {
+			num = n - cur
+			if num < 0 {
+				num = -num
+			}
+		}
+		return fmt.Sprintf("%*d ", w, num) + prompt(n)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package localterm
+
+// enableVirtualTerminal does nothing since terminals other than Windows console interpret escape sequences by default.
+func enableVirtualTerminal() (func() error, error) {
+	return func() error { return nil }, nil
+}
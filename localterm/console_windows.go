@@ -0,0 +1,39 @@
+//go:build windows
+
+package localterm
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal makes the console interpret escape sequences written to the standard output
+// and send escape sequences for special keys to the standard input.
+// It returns a function to restore the console modes.
+func enableVirtualTerminal() (func() error, error) {
+	in, out := windows.Handle(os.Stdin.Fd()), windows.Handle(os.Stdout.Fd())
+
+	var inMode, outMode uint32
+	if err := windows.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	if err := windows.GetConsoleMode(out, &outMode); err != nil {
+		return nil, err
+	}
+
+	if err := windows.SetConsoleMode(in, inMode|windows.ENABLE_VIRTUAL_TERMINAL_INPUT); err != nil {
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(out, outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING|windows.DISABLE_NEWLINE_AUTO_RETURN); err != nil {
+		_ = windows.SetConsoleMode(in, inMode)
+		return nil, err
+	}
+
+	return func() error {
+		if err := windows.SetConsoleMode(out, outMode); err != nil {
+			return err
+		}
+		return windows.SetConsoleMode(in, inMode)
+	}, nil
+}
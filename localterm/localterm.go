@@ -0,0 +1,117 @@
+// Package localterm lets linesqueak.Editor edit lines on the process's own terminal.
+package localterm
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"runtime"
+
+	"golang.org/x/term"
+
+	"github.com/ichiban/linesqueak"
+)
+
+// ErrNotTerminal is returned by Open if the standard input is not a terminal e.g. it's redirected from a file.
+var ErrNotTerminal = errors.New("localterm: not a terminal")
+
+// Terminal is the process's own terminal in raw mode.
+type Terminal struct {
+	// Editor reads from the standard input and writes to the standard output.
+	// Its Cols and Rows are set to the size of the terminal and its Profile is guessed from TERM.
+	// NoColor is enabled if NO_COLOR is set.
+	Editor *linesqueak.Editor
+
+	fd      int
+	state   *term.State
+	console func() error // restores the console modes on Windows.
+}
+
+// Open puts the standard input into raw mode and returns a Terminal with an Editor bound to the standard input and output.
+// On Windows, it also enables virtual terminal processing of the console, which requires Windows 10 or later.
+// Close must be called to restore the terminal.
+func Open() (*Terminal, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, ErrNotTerminal
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	// On Windows, the console has to be told to speak escape sequences.
+	console, err := enableVirtualTerminal()
+	if err != nil {
+		_ = term.Restore(fd, state)
+		return nil, err
+	}
+
+	t := Terminal{
+		Editor: &linesqueak.Editor{
+			In:  bufio.NewReader(os.Stdin),
+			Out: bufio.NewWriter(os.Stdout),
+		},
+		fd:      fd,
+		state:   state,
+		console: console,
+	}
+
+	name := os.Getenv("TERM")
+	if name == "" && runtime.GOOS == "windows" {
+		name = "xterm-256color" // the console speaks escape sequences with virtual terminal processing.
+	}
+	profile := linesqueak.TermProfileFor(name)
+	t.Editor.Profile = &profile
+
+	// https://no-color.org/
+	if os.Getenv("NO_COLOR") != "" {
+		t.Editor.NoColor = true
+	}
+
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		t.Editor.Cols, t.Editor.Rows = w, h
+	}
+
+	return &t, nil
+}
+
+// Close closes the Editor and restores the terminal to the state before Open.
+func (t *Terminal) Close() error {
+	eerr := t.Editor.Close()
+	if err := t.console(); err != nil {
+		return err
+	}
+	if err := term.Restore(t.fd, t.state); err != nil {
+		return err
+	}
+	return eerr
+}
+
+// Run opens the terminal, calls f with the Editor, and restores the terminal even if f panics.
+// Note that os.Exit in f bypasses the restoration.
+//
+//	err := localterm.Run(func(e *linesqueak.Editor) error {
+//		e.Prompt = "> "
+//		for {
+//			line, err := e.Line()
+//			if err != nil {
+//				return err
+//			}
+//			fmt.Fprintf(e, "you have typed: %s\r\n", line)
+//		}
+//	})
+func Run(f func(e *linesqueak.Editor) error) (err error) {
+	t, err := Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := t.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return f(t.Editor)
+}
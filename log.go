@@ -0,0 +1,84 @@
+package linesqueak
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// LogWriter prints each line written to it above the editor region of Editor so that log lines don't corrupt
+// the user input. It's meant to be the output of log.Logger. See NewLogger.
+type LogWriter struct {
+	// Editor prints the lines.
+	Editor *Editor
+
+	// TimeFormat is the layout of the timestamp prepended to each line e.g. time.Kitchen.
+	// TimeFormat is OPTIONAL. If it's empty, no timestamp is prepended.
+	TimeFormat string
+
+	// Color is the text color of the lines.
+	// Color is OPTIONAL. If it's 0, the lines are printed in the default color.
+	Color Color
+
+	mu  sync.Mutex
+	buf []byte // the incomplete line.
+}
+
+// NewLogger returns a log.Logger which prints above the editor region of e.
+//
+//	logger := linesqueak.NewLogger(e, "", log.LstdFlags)
+//	go func() {
+//		for range time.Tick(time.Second) {
+//			logger.Print("tick")
+//		}
+//	}()
+func NewLogger(e *Editor, prefix string, flag int) *log.Logger {
+	return log.New(&LogWriter{Editor: e}, prefix, flag)
+}
+
+// Write prints the complete lines in p. An incomplete line is kept until the rest arrives.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l := w.buf[:i]
+		w.buf = w.buf[i+1:]
+		if err := w.print(l); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush prints the incomplete line if any.
+func (w *LogWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	l := w.buf
+	w.buf = nil
+	return w.print(l)
+}
+
+func (w *LogWriter) print(l []byte) error {
+	s := string(l)
+	if w.TimeFormat != "" {
+		s = time.Now().Format(w.TimeFormat) + " " + s
+	}
+	if w.Color != 0 {
+		s = fmt.Sprintf("\x1b[%dm%s\x1b[0m", w.Color, s)
+	}
+	_, err := w.Editor.Write([]byte(s + "\n"))
+	return err
+}
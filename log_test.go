@@ -0,0 +1,65 @@
+package linesqueak_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestLogWriter_Write(t *testing.T) {
+	out := &checkedWriter{
+		expectations: []string{
+			"\r\x1b[0K\x1b[31mfoo\x1b[0m\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r\x1b[0K\x1b[31mbar\x1b[0m\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r\x1b[0K\x1b[31mbaz\x1b[0m\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(bytes.NewBuffer(nil)),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+	w := &linesqueak.LogWriter{Editor: e, Color: linesqueak.Red}
+
+	for _, s := range []string{"foo\nba", "r\n", "baz"} {
+		n, err := w.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(s) {
+			t.Errorf("expected %d got %d", len(s), n)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if out.pos != len(out.expectations) {
+		t.Errorf("expected %d got %d", len(out.expectations), out.pos)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	out := &checkedWriter{
+		expectations: []string{
+			"\r\x1b[0K[app] foo\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(bytes.NewBuffer(nil)),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	linesqueak.NewLogger(e, "[app] ", 0).Print("foo")
+	if out.pos != len(out.expectations) {
+		t.Errorf("expected %d got %d", len(out.expectations), out.pos)
+	}
+}
@@ -0,0 +1,58 @@
+package linesqueak
+
+import (
+	"context"
+	"errors"
+)
+
+// mode is a modal command e.g. incremental search which handles the following key strokes by itself.
+// Instead of reading them in a loop, it handles one key stroke per step so that Line and Feeder share it.
+type mode struct {
+	// step reads the next key stroke and handles it. It returns true when the command is done.
+	// It may start another mode to go on e.g. completion listing the candidates page by page.
+	step func(ctx context.Context) (bool, error)
+
+	// leave restores the editor states when the command is done. OPTIONAL.
+	leave func()
+}
+
+// enter starts m. The following key strokes are handled by m until it's done.
+func (e *Editor) enter(m *mode) {
+	e.mode = m
+}
+
+// stepMode performs a step of the running mode.
+func (e *Editor) stepMode(ctx context.Context) error {
+	m := e.mode
+	done, err := m.step(ctx)
+	switch {
+	case errors.Is(err, errNeedInput):
+		return err
+	case !done && err == nil:
+		return nil
+	case e.mode != m && e.mode != nil:
+		// It goes on in another mode.
+		if m.leave != nil {
+			m.leave()
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return e.endMode(err)
+}
+
+// endMode ends the running mode with err and finishes the action which started it.
+func (e *Editor) endMode(err error) error {
+	if m := e.mode; m != nil {
+		e.mode = nil
+		if m.leave != nil {
+			m.leave()
+		}
+	}
+	if f := e.finish; f != nil {
+		e.finish = nil
+		err = f(err)
+	}
+	return err
+}
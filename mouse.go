@@ -0,0 +1,107 @@
+package linesqueak
+
+import "context"
+
+const (
+	// mouseOn enables reporting of button presses in SGR encoding.
+	mouseOn  = "\x1b[?1000h\x1b[?1006h"
+	mouseOff = "\x1b[?1006l\x1b[?1000l"
+
+	cursorPositionRequest = "\x1b[6n"
+)
+
+// cursorReported records where the editor region is on the screen.
+// The cursor position is requested when the cursor is at the top of the editor region.
+func (e *Editor) cursorReported(row, _ int) {
+	e.top = row - 1
+	e.topKnown = true
+}
+
+// editMouse handles a mouse event reported in either SGR encoding (ESC [ < b ; x ; y M)
+// or legacy X10 encoding (ESC [ M b x y).
+func (e *Editor) editMouse(c csi) error {
+	if c.private == '<' {
+		if len(c.params) != 3 {
+			return nil
+		}
+		return e.click(c.params[0], c.params[1], c.params[2], c.final == 'm')
+	}
+
+	// The 3 characters following ESC [ M are read one by one.
+	var rs []rune
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+			rs = append(rs, r)
+			if len(rs) < 3 {
+				return false, nil
+			}
+			b, x, y := int(rs[0])-32, int(rs[1])-32, int(rs[2])-32
+			return true, e.click(b, x, y, b&3 == 3)
+		},
+	})
+	return nil
+}
+
+// click handles a mouse event of button b at x and y.
+func (e *Editor) click(b, x, y int, release bool) error {
+	switch {
+	case b&64 != 0: // wheel
+		if b&1 == 0 {
+			return e.editHistoryPrev()
+		}
+		return e.editHistoryNext()
+	case release, b&3 != 0, b&32 != 0: // not a press of the left button
+		return nil
+	default:
+		return e.editMoveTo(y-1-e.top, x-1)
+	}
+}
+
+// editMoveTo moves the cursor to the position in Buffer which is displayed at row and col of the editor region.
+// Clicks outside the rows of the user input are ignored.
+func (e *Editor) editMoveTo(row, col int) error {
+	if !e.topKnown || row < 0 || row > e.MaxRows {
+		return nil
+	}
+
+	prompt := validUTF8(e.prompt())
+	var restore func()
+	if e.HorizontalScroll {
+		prompt, _, _, restore = e.enterWindow(prompt)
+	}
+
+	ps, _ := e.positions(prompt)
+	if last := ps[len(ps)-1]; row > last.rows {
+		if restore != nil {
+			restore()
+		}
+		return nil
+	}
+
+	// The runes aren't in the order of positions if Bidi reorders them.
+	// So it looks for the last one displayed at or before the clicked cell.
+	p := -1
+	for i, q := range ps {
+		if q.rows > row || (q.rows == row && q.cols > col) {
+			continue
+		}
+		if p < 0 || q.rows > ps[p].rows || (q.rows == ps[p].rows && q.cols >= ps[p].cols) {
+			p = i
+		}
+	}
+	if p < 0 {
+		p = 0
+	}
+
+	if restore != nil {
+		restore()
+		p += e.scroll
+	}
+
+	e.Pos = p
+	return e.refreshLine()
+}
@@ -0,0 +1,165 @@
+package linesqueak
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"unicode/utf8"
+)
+
+// ErrPasswordMismatch is returned by ReadNewPassword when the password and its confirmation differ.
+var ErrPasswordMismatch = errors.New("passwords don't match")
+
+// ReadPassword reads a password with prompt.
+// The user input is displayed with Mask or * if Mask isn't set, and History, hints, completion, Validate,
+// Clipboard, AutoClose, AutoIndent, OnAccept, ExternalEditor, OnKey and OnPaste are disabled while it's running
+// so that the password doesn't leak to them. The cursor moves to the next line once user presses Enter.
+// The password is returned as []byte so that you can zero it after use. The copies held by Editor are zeroed.
+func (e *Editor) ReadPassword(prompt string) ([]byte, error) {
+	saved := e.passwordSettings()
+	defer e.setPasswordSettings(saved)
+
+	mask := saved.Mask
+	if mask == 0 {
+		mask = '*'
+	}
+	e.setPasswordSettings(passwordSettings{Prompt: prompt, Mask: mask})
+
+	_, err := e.Line()
+	defer e.zeroBuffers()
+	if err != nil {
+		return nil, err
+	}
+
+	p := make([]byte, 0, len(e.Buffer)*utf8.UTFMax)
+	var buf [utf8.UTFMax]byte
+	for _, r := range e.Buffer {
+		n := utf8.EncodeRune(buf[:], r)
+		p = append(p, buf[:n]...)
+	}
+
+	if err := e.newline(""); err != nil {
+		zero(p)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ReadNewPassword reads a new password with prompt and then reads it again with confirmPrompt.
+// If they don't match, it returns ErrPasswordMismatch. See ReadPassword for details.
+func (e *Editor) ReadNewPassword(prompt, confirmPrompt string) ([]byte, error) {
+	p, err := e.ReadPassword(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := e.ReadPassword(confirmPrompt)
+	defer zero(c)
+	if err != nil {
+		zero(p)
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(p, c) != 1 {
+		zero(p)
+		return nil, ErrPasswordMismatch
+	}
+
+	return p, nil
+}
+
+// passwordSettings are the fields of Editor which ReadPassword overrides.
+type passwordSettings struct {
+	Prompt              string
+	PromptFunc          func() string
+	Hint                func(s string) *Hint
+	HintContext         func(ctx context.Context, s string) *Hint
+	Complete            func(s string) []string
+	CompleteCandidates  func(s string) []Candidate
+	CompleteAt          func(s string, pos int) ([]Candidate, error)
+	CompleteContext     func(ctx context.Context, s string) []Candidate
+	CompleteFromHistory bool
+	Validate            func(s string) error
+	History             History
+	SharedHistory       *SharedHistory
+	Clipboard           bool
+	AutoClose           bool
+	AutoIndent          bool
+	Indent              func(s string, pos int) string
+	OnAccept            func(s string) (string, error)
+	ExternalEditor      func(s string) (string, error)
+	OnKey               func(k KeyEvent) (handled bool)
+	OnPaste             func(s string) string
+	Mask                rune
+}
+
+func (e *Editor) passwordSettings() passwordSettings {
+	return passwordSettings{
+		Prompt:              e.Prompt,
+		PromptFunc:          e.PromptFunc,
+		Hint:                e.Hint,
+		HintContext:         e.HintContext,
+		Complete:            e.Complete,
+		CompleteCandidates:  e.CompleteCandidates,
+		CompleteAt:          e.CompleteAt,
+		CompleteContext:     e.CompleteContext,
+		CompleteFromHistory: e.CompleteFromHistory,
+		Validate:            e.Validate,
+		History:             e.History,
+		SharedHistory:       e.SharedHistory,
+		Clipboard:           e.Clipboard,
+		AutoClose:           e.AutoClose,
+		AutoIndent:          e.AutoIndent,
+		Indent:              e.Indent,
+		OnAccept:            e.OnAccept,
+		ExternalEditor:      e.ExternalEditor,
+		OnKey:               e.OnKey,
+		OnPaste:             e.OnPaste,
+		Mask:                e.Mask,
+	}
+}
+
+func (e *Editor) setPasswordSettings(s passwordSettings) {
+	e.Prompt = s.Prompt
+	e.PromptFunc = s.PromptFunc
+	e.Hint = s.Hint
+	e.HintContext = s.HintContext
+	e.Complete = s.Complete
+	e.CompleteCandidates = s.CompleteCandidates
+	e.CompleteAt = s.CompleteAt
+	e.CompleteContext = s.CompleteContext
+	e.CompleteFromHistory = s.CompleteFromHistory
+	e.Validate = s.Validate
+	e.History = s.History
+	e.SharedHistory = s.SharedHistory
+	e.Clipboard = s.Clipboard
+	e.AutoClose = s.AutoClose
+	e.AutoIndent = s.AutoIndent
+	e.Indent = s.Indent
+	e.OnAccept = s.OnAccept
+	e.ExternalEditor = s.ExternalEditor
+	e.OnKey = s.OnKey
+	e.OnPaste = s.OnPaste
+	e.Mask = s.Mask
+}
+
+// zeroBuffers overwrites the user input and its undo history with zeros.
+func (e *Editor) zeroBuffers() {
+	for i := range e.Buffer {
+		e.Buffer[i] = 0
+	}
+	for _, s := range append(e.undo, e.redo...) {
+		for i := range s.buffer {
+			s.buffer[i] = 0
+		}
+	}
+	e.Buffer, e.Pos = nil, 0
+	e.undo, e.redo = nil, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
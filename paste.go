@@ -0,0 +1,67 @@
+package linesqueak
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	pasteEnd          = "\x1b[201~"
+
+	// maxPaste limits the length of pasted text in bytes so that a malicious client can't exhaust memory.
+	maxPaste = 1 << 20
+)
+
+// editPaste reads pasted text until the end of bracketed paste and inserts it.
+// If it exceeds maxPaste, the rest is read as typed.
+func (e *Editor) editPaste() error {
+	var b strings.Builder
+	e.enter(&mode{
+		step: func(ctx context.Context) (bool, error) {
+			r, err := e.readRune(ctx)
+			if err != nil {
+				return false, err
+			}
+			b.WriteRune(r)
+			if !strings.HasSuffix(b.String(), pasteEnd) && b.Len() < maxPaste {
+				return false, nil
+			}
+			return true, e.paste(strings.TrimSuffix(b.String(), pasteEnd))
+		},
+	})
+	return nil
+}
+
+// paste inserts s pasted by user.
+func (e *Editor) paste(s string) error {
+	s = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s)
+
+	if e.OnPaste != nil {
+		e.unlocked(func() {
+			s = e.OnPaste(s)
+		})
+	}
+
+	if s == "" {
+		return nil
+	}
+
+	return e.editInsertString(s)
+}
+
+// editInsertString inserts s at the cursor at once.
+func (e *Editor) editInsertString(s string) error {
+	e.saveUndo()
+
+	rs := []rune(s)
+	b := make([]rune, 0, len(e.Buffer)+len(rs))
+	b = append(b, e.Buffer[:e.Pos]...)
+	b = append(b, rs...)
+	b = append(b, e.Buffer[e.Pos:]...)
+	e.Buffer = b
+	e.Pos += len(rs)
+
+	return e.refreshLine()
+}
@@ -0,0 +1,95 @@
+package linesqueak
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TermProfile describes the capabilities of a terminal so that Editor can avoid features the terminal lacks.
+type TermProfile struct {
+	// Colors is the number of colors the terminal supports: 0, 8, 256 or 1<<24 for true color.
+	Colors int
+
+	// Unicode tells if the terminal can display characters other than ASCII.
+	Unicode bool
+
+	// BracketedPaste tells if the terminal supports bracketed paste mode.
+	BracketedPaste bool
+
+	// SynchronizedOutput tells if the terminal supports synchronized output mode (DEC private mode 2026).
+	SynchronizedOutput bool
+}
+
+// fullProfile is assumed when Editor.Profile is not provided.
+var fullProfile = TermProfile{
+	Colors:             1 << 24,
+	Unicode:            true,
+	BracketedPaste:     true,
+	SynchronizedOutput: true,
+}
+
+// TermProfileFor guesses the capabilities of the terminal from the value of TERM e.g. "xterm-256color".
+// Unknown terminals are assumed to be VT100 compatible with 8 colors.
+func TermProfileFor(term string) TermProfile {
+	switch term {
+	case "", "dumb":
+		return TermProfile{}
+	case "vt100", "vt102", "vt220", "cons25":
+		return TermProfile{}
+	}
+
+	p := TermProfile{
+		Colors:  8,
+		Unicode: true,
+	}
+
+	switch {
+	case strings.Contains(term, "truecolor"), strings.Contains(term, "24bit"), strings.Contains(term, "direct"):
+		p.Colors = 1 << 24
+	case strings.Contains(term, "256color"):
+		p.Colors = 256
+	}
+
+	for _, prefix := range []string{"xterm", "screen", "tmux", "rxvt", "alacritty", "foot", "wezterm", "contour", "vte", "st-"} {
+		if strings.HasPrefix(term, prefix) {
+			p.BracketedPaste = true
+			break
+		}
+	}
+
+	for _, prefix := range []string{"xterm-kitty", "tmux", "alacritty", "foot", "wezterm", "contour"} {
+		if strings.HasPrefix(term, prefix) {
+			p.SynchronizedOutput = true
+			break
+		}
+	}
+
+	return p
+}
+
+// profile returns Profile or fullProfile if it's not provided.
+func (e *Editor) profile() *TermProfile {
+	if e.Profile == nil {
+		return &fullProfile
+	}
+	return e.Profile
+}
+
+// ascii returns fallback if the terminal can't display s.
+func (e *Editor) ascii(s, fallback string) string {
+	if e.profile().Unicode {
+		return s
+	}
+	return fallback
+}
+
+// sgrPattern matches SGR (Select Graphic Rendition) sequences which set colors and text attributes.
+var sgrPattern = regexp.MustCompile("\x1b\\[[0-9;:]*m")
+
+// uncolor strips SGR sequences from s if NoColor is enabled.
+func (e *Editor) uncolor(s string) string {
+	if !e.NoColor {
+		return s
+	}
+	return sgrPattern.ReplaceAllString(s, "")
+}
@@ -0,0 +1,30 @@
+package linesqueak_test
+
+import (
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestTermProfileFor(t *testing.T) {
+	tests := []struct {
+		term    string
+		profile linesqueak.TermProfile
+	}{
+		{term: "", profile: linesqueak.TermProfile{}},
+		{term: "dumb", profile: linesqueak.TermProfile{}},
+		{term: "vt100", profile: linesqueak.TermProfile{}},
+		{term: "linux", profile: linesqueak.TermProfile{Colors: 8, Unicode: true}},
+		{term: "xterm", profile: linesqueak.TermProfile{Colors: 8, Unicode: true, BracketedPaste: true}},
+		{term: "xterm-256color", profile: linesqueak.TermProfile{Colors: 256, Unicode: true, BracketedPaste: true}},
+		{term: "xterm-kitty", profile: linesqueak.TermProfile{Colors: 8, Unicode: true, BracketedPaste: true, SynchronizedOutput: true}},
+		{term: "tmux-256color", profile: linesqueak.TermProfile{Colors: 256, Unicode: true, BracketedPaste: true, SynchronizedOutput: true}},
+		{term: "xterm-direct", profile: linesqueak.TermProfile{Colors: 1 << 24, Unicode: true, BracketedPaste: true}},
+	}
+
+	for _, tt := range tests {
+		if p := linesqueak.TermProfileFor(tt.term); p != tt.profile {
+			t.Errorf("%s: expected %#v got %#v", tt.term, tt.profile, p)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package linesqueak
+
+import (
+	"errors"
+	"io"
+)
+
+// Run reads input lines with e and passes each of them to handler until user presses Ctrl-D on an empty line.
+// Non-empty lines are added to History with AddHistory before handler is called.
+// Ctrl-C discards the current line and starts a new one.
+//
+// The cursor is on a fresh line below the user input when handler is called
+// so that handler can print the result by writing to e e.g. fmt.Fprintln(e, result).
+//
+// Run returns nil on Ctrl-D. If Line or handler returns any other error, Run returns it.
+func Run(e *Editor, handler func(line string) error) error {
+	for {
+		l, err := e.Line()
+		switch {
+		case errors.Is(err, ErrInterrupt):
+			if err := e.newline("^C"); err != nil {
+				return err
+			}
+			continue
+		case errors.Is(err, io.EOF):
+			return e.newline("")
+		case err != nil:
+			return err
+		}
+
+		if err := e.newline(""); err != nil {
+			return err
+		}
+
+		if l != "" {
+			e.AddHistory(l)
+		}
+
+		if err := handler(l); err != nil {
+			return err
+		}
+	}
+}
+
+// newline writes s after the user input and moves the cursor to the beginning of the next line
+// so that following outputs don't overwrite the user input.
+func (e *Editor) newline(s string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.moveToBottom(); err != nil {
+		return err
+	}
+
+	if _, err := e.Out.WriteString(s + "\r\n"); err != nil {
+		return ioError("write", err)
+	}
+
+	// The editor region is left behind so that Write redraws an empty prompt below the output.
+	e.MaxRows, e.cursorRow = 0, 0
+	e.Buffer, e.Pos = nil, 0
+	e.fresh = true
+
+	return ioError("write", e.Out.Flush())
+}
@@ -0,0 +1,61 @@
+package linesqueak_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestRun(t *testing.T) {
+	in := bytes.NewBuffer([]byte("foo\x0d\x0dba\x03\x04"))
+	out := &checkedWriter{
+		expectations: []string{
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> f\x1b[0K\r\x1b[3C",
+			"\r> fo\x1b[0K\r\x1b[4C",
+			"\r> foo\x1b[0K\r\x1b[5C",
+			"\r\n",
+			"\r\x1b[0KFOO\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r\n",
+			"\r\x1b[0K\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r> b\x1b[0K\r\x1b[3C",
+			"\r> ba\x1b[0K\r\x1b[4C",
+			"^C\r\n",
+			"\r> \x1b[0K\r\x1b[2C",
+			"\r\n",
+		},
+	}
+
+	e := &linesqueak.Editor{
+		In:     bufio.NewReader(in),
+		Out:    bufio.NewWriter(out),
+		Prompt: "> ",
+	}
+
+	var lines []string
+	if err := linesqueak.Run(e, func(l string) error {
+		lines = append(lines, l)
+		_, err := fmt.Fprintln(e, strings.ToUpper(l))
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"foo", ""}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, lines)
+	}
+	expected = []string{"foo", ""}
+	if !reflect.DeepEqual(e.History.Lines, expected) {
+		t.Errorf("expected %#v got %#v", expected, e.History.Lines)
+	}
+}
@@ -0,0 +1,118 @@
+package linesqueak
+
+// enterWindow replaces Buffer and Pos with the part of the current line which fits in the terminal width
+// around the cursor in HorizontalScroll mode. It returns the prompt for the line,
+// the number of columns left after the line if it's entirely visible or -1 otherwise,
+// the marker to be displayed after the line if it's cut off on the right,
+// and a function to restore Buffer and Pos.
+// If ScrollEllipsis is enabled, the prompt ends with the marker if the line is cut off on the left.
+func (e *Editor) enterWindow(prompt string) (string, int, string, func()) {
+	s, end := e.lineStart(e.Pos), e.lineEnd(e.Pos)
+	if s > 0 {
+		var line int
+		for _, r := range e.Buffer[:s] {
+			if r == '\n' {
+				line++
+			}
+		}
+		prompt = e.continuationPrompts()(line)
+	}
+
+	f := e.width()
+	var pw int
+	for _, r := range stripEscapes(prompt) {
+		pw += f(r)
+	}
+
+	// The markers take a column on each side once the line is cut off there.
+	// Since the markers narrow the window, it's repeated until they settle.
+	var lm, rm, last int
+	for {
+		last = e.window(s, end, pw+lm, rm)
+		var l, r int
+		if e.ScrollEllipsis && e.scroll > s {
+			l = 1
+		}
+		if e.ScrollEllipsis && last < end {
+			r = 1
+		}
+		if l <= lm && r <= rm {
+			break
+		}
+		if l > lm {
+			lm = l
+		}
+		if r > rm {
+			rm = r
+		}
+	}
+
+	if lm > 0 {
+		if e.scroll > s {
+			prompt += e.ellipsis("<")
+		} else {
+			prompt += " "
+		}
+	}
+
+	var more string
+	if last < end && rm > 0 {
+		more = e.ellipsis(">")
+	}
+
+	left := -1
+	if e.scroll == s && last == end {
+		left = e.Cols - pw - lm - e.widthBetween(pw+lm, s, end)
+	}
+
+	b, p := e.Buffer, e.Pos
+	e.Buffer, e.Pos = e.Buffer[e.scroll:last], e.Pos-e.scroll
+	return prompt, left, more, func() {
+		e.Buffer, e.Pos = b, p
+	}
+}
+
+// window scrolls the line Buffer[s:end] so that the cursor is visible after the prompt pw columns wide
+// and returns the end of the visible part. rm columns are reserved on the right.
+func (e *Editor) window(s, end, pw, rm int) int {
+	// The cursor has to be on the terminal i.e. left of the right edge.
+	avail := e.Cols - pw - 1 - rm
+	if e.scroll < s || e.scroll > e.Pos {
+		e.scroll = s
+	}
+	for e.scroll < e.Pos && e.widthBetween(pw, e.scroll, e.Pos) > avail {
+		e.scroll++
+	}
+	for e.scroll > s && e.widthBetween(pw, e.scroll-1, end) <= avail {
+		e.scroll--
+	}
+
+	last := e.scroll
+	for last < end && pw+e.widthBetween(pw, e.scroll, last+1)+rm <= e.Cols {
+		last++
+	}
+	return last
+}
+
+// widthBetween returns the number of columns Buffer[i:j] occupies after the prompt pw columns wide.
+func (e *Editor) widthBetween(pw, i, j int) int {
+	f := e.width()
+	c := pw
+	for _, r := range e.Buffer[i:j] {
+		if r == tab {
+			c = e.tabStop(c)
+			continue
+		}
+		c += f(r)
+	}
+	return c - pw
+}
+
+// ellipsis returns the marker of the truncated ends of the line in ScrollEllipsis mode.
+// It's in ASCII if the terminal can display … wider than a column.
+func (e *Editor) ellipsis(fallback string) string {
+	if e.AmbiguousWide {
+		return fallback
+	}
+	return e.ascii("…", fallback)
+}
@@ -0,0 +1,161 @@
+package linesqueak
+
+import (
+	"sync"
+	"time"
+)
+
+// spinnerFrames are the frames of the spinner animation.
+// spinnerFramesASCII are used instead if the terminal can't display Unicode.
+var (
+	spinnerFrames      = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	spinnerFramesASCII = []string{"|", "/", "-", "\\"}
+)
+
+// spinnerInterval is the duration of each frame of the spinner animation.
+const spinnerInterval = 100 * time.Millisecond
+
+// Spinner is an animated indicator with a message which tells user that the application is processing a command.
+// While Line is running, it's displayed above the prompt.
+// Otherwise, it's displayed in place of the prompt once the cursor moves to a fresh line e.g. by Run or Write.
+// It's redrawn in coordination with Line and Write so that the output doesn't interleave.
+type Spinner struct {
+	e    *Editor
+	msg  string
+	pos  int
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartSpinner displays a spinner with msg until Stop is called.
+func (e *Editor) StartSpinner(msg string) *Spinner {
+	s := &Spinner{
+		e:    e,
+		msg:  msg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	e.spinner = s
+	_ = e.redraw()
+	e.mu.Unlock()
+
+	go s.run()
+	return s
+}
+
+func (s *Spinner) run() {
+	defer close(s.done)
+
+	t := time.NewTicker(spinnerInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.e.mu.Lock()
+			s.pos++
+			_ = s.e.redraw()
+			s.e.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// SetMessage changes the message e.g. to show the progress.
+func (s *Spinner) SetMessage(msg string) error {
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+	s.msg = msg
+	return s.e.redraw()
+}
+
+// Stop clears the spinner and restores the editor states if Line is running.
+// It's safe to call Stop more than once. The later calls do nothing and return nil.
+func (s *Spinner) Stop() error {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+
+	e := s.e
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.spinner != s {
+		return nil
+	}
+	e.spinner = nil
+	if e.closed {
+		return nil
+	}
+
+	if e.running {
+		return e.redraw()
+	}
+	if !e.fresh {
+		return nil
+	}
+	if _, err := e.Out.WriteString("\r\x1b[0K"); err != nil {
+		return ioError("write", err)
+	}
+	return ioError("write", e.Out.Flush())
+}
+
+// status returns the current frame followed by the message fitting in width columns.
+func (s *Spinner) status(width int) string {
+	frames := spinnerFrames
+	if !s.e.profile().Unicode {
+		frames = spinnerFramesASCII
+	}
+	st := frames[s.pos%len(frames)] + " " + validUTF8(s.msg)
+
+	f := s.e.width()
+	var w int
+	for _, r := range st {
+		w += f(r)
+	}
+	if w > width {
+		st, _ = s.e.truncate(st, width)
+	}
+	return st
+}
+
+// redraw redraws the spinner alone if Line isn't running or the editor states otherwise.
+func (e *Editor) redraw() error {
+	if e.closed {
+		return ErrClosed
+	}
+
+	e.init()
+	if e.handedOver {
+		// It'd be drawn over the screen of ExternalEditor or Suspend.
+		return nil
+	}
+	if e.spinner == nil || e.running {
+		return e.refreshLine()
+	}
+	if !e.fresh {
+		// It'd overwrite the last user input.
+		return nil
+	}
+
+	ew := &errWriter{w: e.Out}
+	ew.writeString("\r")
+	ew.writeString(e.uncolor(e.spinner.status(e.Cols - 1)))
+	ew.writeString("\x1b[0K")
+	ew.flush()
+	return ew.err
+}
+
+// leaveSpinner redraws the editor states without the spinner above the prompt when Line returns
+// so that the spinner doesn't remain on the screen.
+func (e *Editor) leaveSpinner() error {
+	if e.spinner == nil {
+		return nil
+	}
+	if err := e.refreshLine(); err != nil {
+		return err
+	}
+	return e.moveToBottom()
+}
@@ -0,0 +1,137 @@
+// Package sshutil connects linesqueak.Editor to SSH sessions served with golang.org/x/crypto/ssh.
+package sshutil
+
+import (
+	"bufio"
+	"errors"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ichiban/linesqueak"
+)
+
+// ErrNoShell is returned by Accept if the requests end before the client requests a shell.
+var ErrNoShell = errors.New("sshutil: no shell request")
+
+// Session is an interactive SSH session with an Editor attached.
+//
+//	conn, reqs, err := newChannel.Accept()
+//	if err != nil {
+//		// ...
+//	}
+//	s, err := sshutil.Accept(conn, reqs)
+//	if err != nil {
+//		// ...
+//	}
+//	s.Editor.Prompt = "> "
+//	for {
+//		line, err := s.Editor.Line()
+//		// ...
+//	}
+type Session struct {
+	// Editor reads from and writes to the channel.
+	// Its Rows and Cols are updated whenever the client's terminal is resized
+	// and its Profile is guessed from the terminal type.
+	Editor *linesqueak.Editor
+
+	// Term is the terminal type sent with pty-req e.g. "xterm-256color".
+	// It's empty if the client didn't request a pseudo terminal.
+	Term string
+
+	// Env holds the environment variables sent with env requests before the shell request.
+	Env map[string]string
+}
+
+// Accept handles pty-req, env and shell requests on reqs and returns a Session once the client requests a shell.
+// After that, it keeps handling window-change requests in the background until reqs is closed.
+// Other requests e.g. exec and subsystem are rejected.
+func Accept(ch ssh.Channel, reqs <-chan *ssh.Request) (*Session, error) {
+	s := Session{
+		Editor: &linesqueak.Editor{
+			In:  bufio.NewReader(ch),
+			Out: bufio.NewWriter(ch),
+		},
+		Env: map[string]string{},
+	}
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var p ptyRequest
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			s.Term = p.Term
+			profile := linesqueak.TermProfileFor(p.Term)
+			s.Editor.Profile = &profile
+			s.resize(p.Cols, p.Rows)
+			_ = req.Reply(true, nil)
+		case "env":
+			var p envRequest
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			s.Env[p.Name] = p.Value
+			_ = req.Reply(true, nil)
+		case "shell":
+			_ = req.Reply(true, nil)
+			go s.serve(reqs)
+			return &s, nil
+		default:
+			s.handle(req)
+		}
+	}
+
+	return nil, ErrNoShell
+}
+
+// serve handles the requests following the shell request.
+func (s *Session) serve(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		s.handle(req)
+	}
+}
+
+func (s *Session) handle(req *ssh.Request) {
+	if req.Type != "window-change" {
+		_ = req.Reply(false, nil)
+		return
+	}
+
+	var p windowChangeRequest
+	if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+		return
+	}
+	s.resize(p.Cols, p.Rows)
+}
+
+// resize resizes the Editor. A write error is left to be reported by Line.
+func (s *Session) resize(cols, rows uint32) {
+	_ = s.Editor.Resize(int(cols), int(rows))
+}
+
+// https://datatracker.ietf.org/doc/html/rfc4254#section-6.2
+type ptyRequest struct {
+	Term   string
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+	Modes  string
+}
+
+// https://datatracker.ietf.org/doc/html/rfc4254#section-6.4
+type envRequest struct {
+	Name  string
+	Value string
+}
+
+// https://datatracker.ietf.org/doc/html/rfc4254#section-6.7
+type windowChangeRequest struct {
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+}
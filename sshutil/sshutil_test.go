@@ -0,0 +1,74 @@
+package sshutil_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ichiban/linesqueak/sshutil"
+)
+
+type channel struct {
+	bytes.Buffer
+}
+
+func (c *channel) Close() error {
+	return nil
+}
+
+func (c *channel) CloseWrite() error {
+	return nil
+}
+
+func (c *channel) SendRequest(string, bool, []byte) (bool, error) {
+	return false, nil
+}
+
+func (c *channel) Stderr() io.ReadWriter {
+	return &bytes.Buffer{}
+}
+
+func TestAccept(t *testing.T) {
+	reqs := make(chan *ssh.Request, 4)
+	reqs <- &ssh.Request{Type: "pty-req", Payload: ssh.Marshal(struct {
+		Term                      string
+		Cols, Rows, Width, Height uint32
+		Modes                     string
+	}{Term: "xterm", Cols: 120, Rows: 40})}
+	reqs <- &ssh.Request{Type: "env", Payload: ssh.Marshal(struct {
+		Name, Value string
+	}{Name: "LANG", Value: "en_US.UTF-8"})}
+	reqs <- &ssh.Request{Type: "shell"}
+	defer close(reqs)
+
+	s, err := sshutil.Accept(&channel{}, reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Term != "xterm" {
+		t.Errorf(`expected "xterm" got %#v`, s.Term)
+	}
+	if s.Editor.Profile == nil || s.Editor.Profile.Colors != 8 {
+		t.Errorf("unexpected profile %#v", s.Editor.Profile)
+	}
+	if s.Editor.Cols != 120 || s.Editor.Rows != 40 {
+		t.Errorf("expected 120x40 got %dx%d", s.Editor.Cols, s.Editor.Rows)
+	}
+	if expected := map[string]string{"LANG": "en_US.UTF-8"}; !reflect.DeepEqual(s.Env, expected) {
+		t.Errorf("expected %#v got %#v", expected, s.Env)
+	}
+}
+
+func TestAccept_NoShell(t *testing.T) {
+	reqs := make(chan *ssh.Request, 1)
+	reqs <- &ssh.Request{Type: "exec", Payload: ssh.Marshal(struct{ Command string }{Command: "ls"})}
+	close(reqs)
+
+	if _, err := sshutil.Accept(&channel{}, reqs); !errors.Is(err, sshutil.ErrNoShell) {
+		t.Errorf("expected %v got %v", sshutil.ErrNoShell, err)
+	}
+}
@@ -0,0 +1,93 @@
+package linesqueak
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TextStyle is the colors and attributes of text. The zero value is the default appearance of the terminal.
+type TextStyle struct {
+	// Foreground is the text color.
+	Foreground Color
+
+	// Background is the background color.
+	Background Color
+
+	Bold      bool
+	Faint     bool
+	Italic    bool
+	Underline bool
+	Reverse   bool
+}
+
+// Style decides the appearance of each part of the editor states.
+// Zero values leave the parts as they are by default.
+type Style struct {
+	// Prompt is applied to Prompt, ContinuationPrompt and the results of PromptFunc and ContinuationPromptFunc.
+	Prompt TextStyle
+
+	// Hint is applied to hints. Color and Bold of Hint take precedence.
+	Hint TextStyle
+
+	// Message is applied to messages displayed below the user input e.g. errors from Validate and completion lists.
+	Message TextStyle
+
+	// ControlCharacter is applied to control characters in caret notation e.g. ^C. By default, they're in reverse video.
+	ControlCharacter TextStyle
+
+	// SearchMatch is applied to the parts of the user input which match the query of incremental search.
+	// By default, they're underlined.
+	SearchMatch TextStyle
+
+	// Whitespace is applied to the markers of spaces and tabs displayed by ShowWhitespace. By default, they're faint.
+	Whitespace TextStyle
+}
+
+// apply decorates s with the style. Colors are dropped if the terminal doesn't support them.
+func (t TextStyle) apply(s string, p *TermProfile) string {
+	on := t.sgr(p)
+	if on == "" {
+		return s
+	}
+	return on + s + "\x1b[0m"
+}
+
+// matchStyle returns the sequences to turn on and off Style.SearchMatch.
+func (e *Editor) matchStyle() (string, string) {
+	if e.Style.SearchMatch == (TextStyle{}) {
+		return "\x1b[4m", "\x1b[24m"
+	}
+	return e.Style.SearchMatch.sgr(e.profile()), "\x1b[0m"
+}
+
+// sgr returns the SGR sequence to turn on the style or "" if it's the default appearance.
+func (t TextStyle) sgr(p *TermProfile) string {
+	var ps []string
+	if t.Bold {
+		ps = append(ps, "1")
+	}
+	if t.Faint {
+		ps = append(ps, "2")
+	}
+	if t.Italic {
+		ps = append(ps, "3")
+	}
+	if t.Underline {
+		ps = append(ps, "4")
+	}
+	if t.Reverse {
+		ps = append(ps, "7")
+	}
+	if p.Colors > 0 {
+		if t.Foreground != 0 {
+			ps = append(ps, strconv.Itoa(int(t.Foreground)))
+		}
+		if t.Background != 0 {
+			ps = append(ps, strconv.Itoa(int(t.Background)+10))
+		}
+	}
+	if len(ps) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(ps, ";") + "m"
+}
@@ -0,0 +1,7 @@
+package linesqueak
+
+// https://gist.github.com/christianparpart/d8a62cc1ab659194337d73e399004036
+const (
+	synchronizedOutputOn  = "\x1b[?2026h"
+	synchronizedOutputOff = "\x1b[?2026l"
+)
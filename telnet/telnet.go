@@ -0,0 +1,274 @@
+// Package telnet lets linesqueak.Editor talk to telnet clients.
+//
+// It negotiates the options for character-at-a-time input with remote echo (ECHO and SGA) and the window size (NAWS),
+// filters IAC sequences out of the input, and escapes IAC in the output.
+// https://datatracker.ietf.org/doc/html/rfc854
+package telnet
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/ichiban/linesqueak"
+)
+
+// Telnet commands.
+const (
+	se   = 240
+	sb   = 250
+	will = 251
+	wont = 252
+	do   = 253
+	dont = 254
+	iac  = 255
+)
+
+// Telnet options.
+const (
+	optEcho = 1  // https://datatracker.ietf.org/doc/html/rfc857
+	optSGA  = 3  // https://datatracker.ietf.org/doc/html/rfc858
+	optNAWS = 31 // https://datatracker.ietf.org/doc/html/rfc1073
+)
+
+// maxSubnegotiation limits the length of subnegotiations so that a malicious client can't exhaust memory.
+const maxSubnegotiation = 64
+
+// Conn is a telnet connection.
+// Read returns the bytes typed by the user without IAC sequences and Write escapes IAC.
+type Conn struct {
+	// OnResize is called with the window size whenever the client reports it via NAWS.
+	// OnResize is OPTIONAL.
+	OnResize func(cols, rows int)
+
+	r *bufio.Reader
+	w io.Writer
+
+	mu sync.Mutex // guards w.
+
+	will, do [256]bool // options enabled on our side and the client side.
+	cr       bool      // the last byte was CR.
+}
+
+// NewConn returns a telnet connection over rw.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{
+		r: bufio.NewReader(rw),
+		w: rw,
+	}
+}
+
+// Negotiate asks the client to send each character as it's typed without echoing it and to report the window size.
+func (c *Conn) Negotiate() error {
+	c.will[optEcho], c.will[optSGA], c.do[optSGA], c.do[optNAWS] = true, true, true, true
+	return c.send(
+		iac, will, optEcho,
+		iac, will, optSGA,
+		iac, do, optSGA,
+		iac, do, optNAWS,
+	)
+}
+
+// Read reads the data sent by the client. IAC sequences are handled and removed.
+// CR LF and CR NUL, which telnet clients send for Enter, are read as CR.
+func (c *Conn) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if n > 0 && c.r.Buffered() == 0 {
+			break
+		}
+
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+
+		cr := c.cr
+		c.cr = false
+
+		switch {
+		case b == iac:
+			b, err := c.command()
+			if err != nil {
+				return n, err
+			}
+			if b == iac { // escaped 0xff.
+				p[n] = b
+				n++
+			}
+		case cr && (b == '\n' || b == 0):
+			continue
+		default:
+			c.cr = b == '\r'
+			p[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Write writes p to the client with IAC escaped.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int
+	for len(p) > 0 {
+		i := 0
+		for i < len(p) && p[i] != iac {
+			i++
+		}
+		if i < len(p) {
+			i++ // including IAC.
+		}
+
+		m, err := c.w.Write(p[:i])
+		n += m
+		if err != nil {
+			return n, err
+		}
+
+		if p[i-1] == iac {
+			if _, err := c.w.Write([]byte{iac}); err != nil {
+				return n, err
+			}
+		}
+
+		p = p[i:]
+	}
+	return n, nil
+}
+
+// command handles a command following IAC. It returns IAC if it's an escaped 0xff.
+func (c *Conn) command() (byte, error) {
+	cmd, err := c.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch cmd {
+	case iac:
+		return iac, nil
+	case will, wont, do, dont:
+		opt, err := c.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		return cmd, c.negotiate(cmd, opt)
+	case sb:
+		return cmd, c.subnegotiation()
+	default: // NOP, AYT, etc. are ignored.
+		return cmd, nil
+	}
+}
+
+// negotiate responds to the client's request so that both sides agree on the option.
+// It doesn't respond to acknowledgements so that negotiation doesn't loop.
+func (c *Conn) negotiate(cmd, opt byte) error {
+	switch cmd {
+	case do:
+		if opt != optEcho && opt != optSGA {
+			return c.send(iac, wont, opt)
+		}
+		if c.will[opt] {
+			return nil
+		}
+		c.will[opt] = true
+		return c.send(iac, will, opt)
+	case dont:
+		if !c.will[opt] {
+			return nil
+		}
+		c.will[opt] = false
+		return c.send(iac, wont, opt)
+	case will:
+		if opt != optSGA && opt != optNAWS {
+			return c.send(iac, dont, opt)
+		}
+		if c.do[opt] {
+			return nil
+		}
+		c.do[opt] = true
+		return c.send(iac, do, opt)
+	default: // wont
+		if !c.do[opt] {
+			return nil
+		}
+		c.do[opt] = false
+		return c.send(iac, dont, opt)
+	}
+}
+
+// subnegotiation reads the parameters until IAC SE and handles NAWS.
+func (c *Conn) subnegotiation() error {
+	var buf []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if b == iac {
+			b, err = c.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if b == se {
+				break
+			}
+		}
+
+		if len(buf) < maxSubnegotiation {
+			buf = append(buf, b)
+		}
+	}
+
+	if len(buf) == 5 && buf[0] == optNAWS && c.OnResize != nil {
+		cols := int(buf[1])<<8 | int(buf[2])
+		rows := int(buf[3])<<8 | int(buf[4])
+		c.OnResize(cols, rows)
+	}
+	return nil
+}
+
+func (c *Conn) send(b ...byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.w.Write(b)
+	return err
+}
+
+// NewEditor negotiates over rw and returns an Editor which talks to the telnet client.
+// The Editor's Cols and Rows are updated whenever the client reports the window size.
+// If rw supports read deadlines e.g. net.Conn, it's set to the Editor's Conn.
+//
+//	conn, err := listener.Accept()
+//	if err != nil {
+//		// ...
+//	}
+//	e, err := telnet.NewEditor(conn)
+//	if err != nil {
+//		// ...
+//	}
+//	e.Prompt = "> "
+//	for {
+//		line, err := e.Line()
+//		// ...
+//	}
+func NewEditor(rw io.ReadWriter) (*linesqueak.Editor, error) {
+	c := NewConn(rw)
+	e := &linesqueak.Editor{
+		In:  bufio.NewReader(c),
+		Out: bufio.NewWriter(c),
+	}
+	c.OnResize = func(cols, rows int) {
+		_ = e.Resize(cols, rows) // A write error is left to be reported by Line.
+	}
+	if d, ok := rw.(linesqueak.ReadDeadliner); ok { // e.g. net.Conn
+		e.Conn = d
+	}
+	if err := c.Negotiate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,84 @@
+package telnet_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ichiban/linesqueak/telnet"
+)
+
+type conn struct {
+	in  io.Reader
+	out bytes.Buffer
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
+
+func TestConn_Read(t *testing.T) {
+	c := &conn{in: bytes.NewReader([]byte("a\xff\xfd\x01b\xff\xfb\x18c\xff\xffd\xff\xfa\x1f\x00\x78\x00\x28\xff\xf0\r\x00e\r\nf"))}
+	var cols, rows int
+	tc := telnet.NewConn(c)
+	tc.OnResize = func(c, r int) {
+		cols, rows = c, r
+	}
+
+	b, err := io.ReadAll(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "abc\xffd\re\rf"; string(b) != expected {
+		t.Errorf("expected %q got %q", expected, string(b))
+	}
+	if expected := "\xff\xfb\x01\xff\xfe\x18"; c.out.String() != expected {
+		t.Errorf("expected %q got %q", expected, c.out.String())
+	}
+	if cols != 120 || rows != 40 {
+		t.Errorf("expected 120x40 got %dx%d", cols, rows)
+	}
+}
+
+func TestConn_Write(t *testing.T) {
+	c := &conn{}
+	tc := telnet.NewConn(c)
+
+	n, err := tc.Write([]byte("a\xffb\xff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 got %d", n)
+	}
+	if expected := "a\xff\xffb\xff\xff"; c.out.String() != expected {
+		t.Errorf("expected %q got %q", expected, c.out.String())
+	}
+}
+
+func TestNewEditor(t *testing.T) {
+	c := &conn{in: bytes.NewReader([]byte("\xff\xfd\x01\xff\xfb\x1f\xff\xfa\x1f\x00\x64\x00\x1e\xff\xf0foo\r\x00"))}
+	e, err := telnet.NewEditor(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\xff\xfb\x01\xff\xfb\x03\xff\xfd\x03\xff\xfd\x1f"; c.out.String() != expected {
+		t.Errorf("expected %q got %q", expected, c.out.String())
+	}
+
+	e.Prompt = "> "
+	l, err := e.Line()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != "foo" {
+		t.Errorf(`expected "foo" got %#v`, l)
+	}
+	if e.Cols != 100 || e.Rows != 30 {
+		t.Errorf("expected 100x30 got %dx%d", e.Cols, e.Rows)
+	}
+}
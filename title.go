@@ -0,0 +1,59 @@
+package linesqueak
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SetTitle sets the window title of the terminal via OSC 2.
+// The original title is saved on the first call so that ResetTitle can restore it.
+// Control characters in title are removed so that they don't terminate the sequence early.
+// It's safe to call from another goroutine while Line is running.
+func (e *Editor) SetTitle(title string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	ew := errWriter{w: e.Out}
+	if !e.titleSaved {
+		ew.writeString("\x1b[22;0t") // push the title onto the stack
+		e.titleSaved = true
+	}
+	ew.writeString("\x1b]2;")
+	ew.writeString(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, title))
+	ew.writeString("\a")
+	ew.flush()
+	return ew.err
+}
+
+// ResetTitle restores the window title of the terminal which was saved by SetTitle.
+func (e *Editor) ResetTitle() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	if !e.titleSaved {
+		return nil
+	}
+
+	ew := errWriter{w: e.Out}
+	ew.writeString("\x1b[23;0t") // pop the title from the stack
+	ew.flush()
+	if ew.err != nil {
+		return ew.err
+	}
+
+	e.titleSaved = false
+	return nil
+}
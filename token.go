@@ -0,0 +1,126 @@
+package linesqueak
+
+import "strings"
+
+// Token is a shell-like word in the user input.
+type Token struct {
+	// Start is the position of the first rune of the token.
+	Start int
+
+	// End is the position right after the last rune of the token.
+	End int
+
+	// Value is the token without quotes and escapes.
+	Value string
+
+	// Quote is the quote character left open at the end of the token, or 0 if all quotes are closed.
+	Quote rune
+}
+
+// Tokenize splits rs into shell-like words separated by whitespaces.
+// Whitespaces in quotes (' or ") or escaped by \ are part of words.
+// Positions of tokens are indices of rs, which means they're comparable with Editor's Pos.
+func Tokenize(rs []rune) []Token {
+	var ts []Token
+	var t *Token
+	var b strings.Builder
+	var escaped bool
+	for i, r := range rs {
+		if t == nil {
+			if isSpace(r) {
+				continue
+			}
+			ts = append(ts, Token{Start: i})
+			t = &ts[len(ts)-1]
+			b.Reset()
+		}
+
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case t.Quote != 0:
+			switch {
+			case r == t.Quote:
+				t.Quote = 0
+			case r == '\\' && t.Quote == '"':
+				escaped = true
+			default:
+				b.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '\'' || r == '"':
+			t.Quote = r
+		case isSpace(r):
+			t.End = i
+			t.Value = b.String()
+			t = nil
+			continue
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	if t != nil {
+		t.End = len(rs)
+		t.Value = b.String()
+	}
+
+	return ts
+}
+
+// ValidateShell is a Validate function for shell-like input. It returns ErrIncomplete
+// if s ends with \ or has an unclosed quote so that user can continue on the next line.
+func ValidateShell(s string) error {
+	var quote rune
+	var escaped bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '\'':
+			if r == quote {
+				quote = 0
+			}
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		}
+	}
+	if escaped || quote != 0 {
+		return ErrIncomplete
+	}
+	return nil
+}
+
+func isSpace(r rune) bool {
+	return r == space || r == tab || r == '\n'
+}
+
+// tokenBackward returns the position of the beginning of the current or previous shell-like word.
+func (e *Editor) tokenBackward() int {
+	var p int
+	for _, t := range Tokenize(e.Buffer) {
+		if t.Start >= e.Pos {
+			break
+		}
+		p = t.Start
+	}
+	return p
+}
+
+// tokenForward returns the position of the end of the current or next shell-like word.
+func (e *Editor) tokenForward() int {
+	for _, t := range Tokenize(e.Buffer) {
+		if t.End > e.Pos {
+			return t.End
+		}
+	}
+	return len(e.Buffer)
+}
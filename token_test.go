@@ -0,0 +1,63 @@
+package linesqueak_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected []linesqueak.Token
+	}{
+		{input: "", expected: nil},
+		{input: "  ", expected: nil},
+		{input: "foo bar", expected: []linesqueak.Token{
+			{Start: 0, End: 3, Value: "foo"},
+			{Start: 4, End: 7, Value: "bar"},
+		}},
+		{input: ` cp 'a b' "c \"d\""  e\ f `, expected: []linesqueak.Token{
+			{Start: 1, End: 3, Value: "cp"},
+			{Start: 4, End: 9, Value: "a b"},
+			{Start: 10, End: 19, Value: `c "d"`},
+			{Start: 21, End: 25, Value: "e f"},
+		}},
+		{input: `echo "foo b`, expected: []linesqueak.Token{
+			{Start: 0, End: 4, Value: "echo"},
+			{Start: 5, End: 11, Value: "foo b", Quote: '"'},
+		}},
+		{input: "日本 語", expected: []linesqueak.Token{
+			{Start: 0, End: 2, Value: "日本"},
+			{Start: 3, End: 4, Value: "語"},
+		}},
+	} {
+		if ts := linesqueak.Tokenize([]rune(tc.input)); !reflect.DeepEqual(ts, tc.expected) {
+			t.Errorf("%q: expected %#v got %#v", tc.input, tc.expected, ts)
+		}
+	}
+}
+
+func TestValidateShell(t *testing.T) {
+	for _, tc := range []struct {
+		input      string
+		incomplete bool
+	}{
+		{input: "", incomplete: false},
+		{input: "echo foo", incomplete: false},
+		{input: `echo foo \`, incomplete: true},
+		{input: `echo foo \\`, incomplete: false},
+		{input: "echo foo \\\nbar", incomplete: false},
+		{input: `echo "foo`, incomplete: true},
+		{input: `echo "foo \"bar\""`, incomplete: false},
+		{input: `echo 'foo \`, incomplete: true},
+		{input: `echo 'foo \'`, incomplete: false},
+	} {
+		err := linesqueak.ValidateShell(tc.input)
+		if incomplete := errors.Is(err, linesqueak.ErrIncomplete); incomplete != tc.incomplete {
+			t.Errorf("%q: expected %t got %t", tc.input, tc.incomplete, incomplete)
+		}
+	}
+}
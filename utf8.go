@@ -0,0 +1,60 @@
+package linesqueak
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// InvalidUTF8Policy decides what Editor does when it reads invalid UTF-8 from the terminal.
+type InvalidUTF8Policy int
+
+const (
+	// InvalidUTF8Replace replaces each invalid byte with U+FFFD.
+	InvalidUTF8Replace InvalidUTF8Policy = iota
+
+	// InvalidUTF8Drop silently drops invalid bytes.
+	InvalidUTF8Drop
+
+	// InvalidUTF8Error makes Line return ErrInvalidUTF8.
+	InvalidUTF8Error
+)
+
+// ErrInvalidUTF8 is returned by Line when it reads invalid UTF-8 and InvalidUTF8 is InvalidUTF8Error.
+var ErrInvalidUTF8 = errors.New("invalid UTF-8")
+
+// readValidRune reads a rune from in and deals with invalid UTF-8 according to p.
+func readValidRune(in *bufio.Reader, p InvalidUTF8Policy) (rune, error) {
+	for {
+		r, n, err := in.ReadRune()
+		if err != nil {
+			return r, ioError("read", err)
+		}
+		if r != utf8.RuneError || n != 1 {
+			return r, nil
+		}
+
+		switch p {
+		case InvalidUTF8Drop:
+			continue
+		case InvalidUTF8Error:
+			return r, ErrInvalidUTF8
+		default:
+			return r, nil
+		}
+	}
+}
+
+// validUTF8 replaces invalid bytes in s with U+FFFD so that raw invalid bytes are never written to the terminal.
+// Each invalid byte is replaced with one U+FFFD so that it's consistent with the width calculation.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(r)
+	}
+	return b.String()
+}
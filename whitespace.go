@@ -0,0 +1,56 @@
+package linesqueak
+
+// Whitespace decides which spaces and tabs in the user input are made visible.
+type Whitespace int
+
+const (
+	// WhitespaceHidden displays spaces and tabs as they are.
+	WhitespaceHidden Whitespace = iota
+
+	// WhitespaceTrailing displays spaces and tabs at the end of each line as · and ».
+	WhitespaceTrailing
+
+	// WhitespaceAll displays all the spaces and tabs as · and ».
+	WhitespaceAll
+)
+
+// visibleWhitespace returns which runes in Buffer are displayed as whitespace markers or nil if there's none.
+func (e *Editor) visibleWhitespace() []bool {
+	if e.ShowWhitespace == WhitespaceHidden {
+		return nil
+	}
+	vs := make([]bool, len(e.Buffer))
+	trailing := true
+	for i := len(e.Buffer) - 1; i >= 0; i-- {
+		switch r := e.Buffer[i]; {
+		case r == '\n':
+			trailing = true
+		case r != ' ' && r != tab:
+			trailing = false
+		default:
+			vs[i] = trailing || e.ShowWhitespace == WhitespaceAll
+		}
+	}
+	return vs
+}
+
+// whitespaceMarker returns the marker for a space or a tab.
+// It's in ASCII if the terminal can display the marker wider than a space.
+func (e *Editor) whitespaceMarker(r rune) string {
+	s, fallback := "·", "."
+	if r == tab {
+		s, fallback = "»", ">"
+	}
+	if e.AmbiguousWide {
+		return fallback
+	}
+	return e.ascii(s, fallback)
+}
+
+// whitespaceStyle returns the sequences to turn on and off Style.Whitespace.
+func (e *Editor) whitespaceStyle() (string, string) {
+	if e.Style.Whitespace == (TextStyle{}) {
+		return "\x1b[2m", "\x1b[22m"
+	}
+	return e.Style.Whitespace.sgr(e.profile()), "\x1b[0m"
+}
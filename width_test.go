@@ -0,0 +1,52 @@
+package linesqueak_test
+
+import (
+	"testing"
+
+	"github.com/ichiban/linesqueak"
+)
+
+func TestRuneWidth(t *testing.T) {
+	for _, tc := range []struct {
+		r rune
+		w int
+	}{
+		{r: 'a', w: 1},
+		{r: 'é', w: 1},
+		{r: 'あ', w: 2},
+		{r: '漢', w: 2},
+		{r: '한', w: 2},
+		{r: 'Ａ', w: 2},
+		{r: 'ｱ', w: 1},
+		{r: '😀', w: 2},
+		{r: '́', w: 0}, // combining acute accent
+		{r: '‍', w: 0}, // zero width joiner
+		{r: '️', w: 0}, // variation selector
+	} {
+		if w := linesqueak.RuneWidth(tc.r); w != tc.w {
+			t.Errorf("%U: expected %d got %d", tc.r, tc.w, w)
+		}
+	}
+}
+
+func TestEastAsianRuneWidth(t *testing.T) {
+	for _, tc := range []struct {
+		r rune
+		w int
+	}{
+		{r: 'a', w: 1},
+		{r: 'é', w: 2},
+		{r: 'α', w: 2},
+		{r: 'Ж', w: 2},
+		{r: '○', w: 2},
+		{r: '─', w: 2},
+		{r: 'あ', w: 2},
+		{r: 'ｱ', w: 1},
+		{r: '́', w: 0}, // combining acute accent
+		{r: '️', w: 0}, // variation selector
+	} {
+		if w := linesqueak.EastAsianRuneWidth(tc.r); w != tc.w {
+			t.Errorf("%U: expected %d got %d", tc.r, tc.w, w)
+		}
+	}
+}